@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/index"
+	"log"
+)
+
+func main() {
+
+	ctx := context.Background()
+
+	fs, err := index.NewConcordancesFlagSet(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to create new flagset, %v", err)
+	}
+
+	flagset.Parse(fs)
+
+	results, err := index.LookupConcordancesWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to look up concordances, %v", err)
+	}
+
+	enc_results, err := json.Marshal(results)
+
+	if err != nil {
+		log.Fatalf("Failed to marshal results, %v", err)
+	}
+
+	fmt.Println(string(enc_results))
+}
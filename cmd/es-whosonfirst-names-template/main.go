@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/index"
+	"log"
+	"os"
+)
+
+func main() {
+
+	ctx := context.Background()
+
+	fs, err := index.NewNamesTemplateFlagSet(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to create new flagset, %v", err)
+	}
+
+	flagset.Parse(fs)
+
+	err = index.InstallNamesTemplateWithFlagSet(ctx, fs, os.Stdout)
+
+	if err != nil {
+		log.Fatalf("Failed to install names template, %v", err)
+	}
+}
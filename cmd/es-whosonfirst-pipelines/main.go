@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/index"
+	"log"
+)
+
+func main() {
+
+	ctx := context.Background()
+
+	fs, err := index.NewPipelinesFlagSet(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to create new flagset, %v", err)
+	}
+
+	flagset.Parse(fs)
+
+	pipelines, err := index.InstallPipelinesWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to install pipelines, %v", err)
+	}
+
+	enc_pipelines, err := json.Marshal(pipelines)
+
+	if err != nil {
+		log.Fatalf("Failed to marshal pipelines, %v", err)
+	}
+
+	fmt.Println(string(enc_pipelines))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/index"
+	"log"
+)
+
+func main() {
+
+	ctx := context.Background()
+
+	fs, err := index.NewPlacetypeAliasesFlagSet(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to create new flagset, %v", err)
+	}
+
+	flagset.Parse(fs)
+
+	aliases, err := index.UpdatePlacetypeAliasesWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to update placetype aliases, %v", err)
+	}
+
+	enc_aliases, err := json.Marshal(aliases)
+
+	if err != nil {
+		log.Fatalf("Failed to marshal aliases, %v", err)
+	}
+
+	fmt.Println(string(enc_aliases))
+}
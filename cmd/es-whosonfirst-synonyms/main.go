@@ -0,0 +1,41 @@
+package main
+
+import (
+	_ "github.com/whosonfirst/go-whosonfirst-iterate-git/v2"
+)
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/index"
+	"log"
+)
+
+func main() {
+
+	ctx := context.Background()
+
+	fs, err := index.NewSynonymsFlagSet(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to create new flagset, %v", err)
+	}
+
+	flagset.Parse(fs)
+
+	paths, err := index.RunSynonymsWithFlagSet(ctx, fs)
+
+	if err != nil {
+		log.Fatalf("Failed to export synonyms, %v", err)
+	}
+
+	enc_paths, err := json.Marshal(paths)
+
+	if err != nil {
+		log.Fatalf("Failed to marshal paths, %v", err)
+	}
+
+	fmt.Println(string(enc_paths))
+}
@@ -0,0 +1,122 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"strings"
+)
+
+// AltGeomFromLabel derives a `uri.AltGeom` instance from an alternate geometry label (the `src:alt_label` property)
+// such as "quattroshapes" or "naturalearth-display-terrestrial-zoom6". This is meant to be used when an alternate
+// geometry's details can not be derived from its path using `uri.AltGeomFromPath`.
+func AltGeomFromLabel(label string) (*uri.AltGeom, error) {
+
+	parts := strings.Split(label, "-")
+
+	for _, p := range parts {
+
+		if strings.TrimSpace(p) == "" {
+			return nil, fmt.Errorf("Invalid alternate geometry label '%s'", label)
+		}
+	}
+
+	alt_geom := &uri.AltGeom{
+		Source: parts[0],
+	}
+
+	if len(parts) > 1 {
+		alt_geom.Function = parts[1]
+	}
+
+	if len(parts) > 2 {
+		alt_geom.Extras = parts[2:]
+	}
+
+	return alt_geom, nil
+}
+
+// AlternateGeometryDocumentId returns the document ID for the alternate geometry 'alt_geom' of the Who's On First record
+// 'wof_id', in the form of "{WOF_ID}-{ALT_LABEL}" (for example "101736545-quattroshapes"). The label is derived using
+// `uri.AltGeom.String` so that the same alternate geometry is assigned the same document ID by all indexers.
+func AlternateGeometryDocumentId(wof_id int64, alt_geom *uri.AltGeom) (string, error) {
+
+	if alt_geom == nil {
+		return "", errors.New("Missing alternate geometry")
+	}
+
+	label, err := alt_geom.String()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive alternate geometry label, %w", err)
+	}
+
+	return fmt.Sprintf("%d-%s", wof_id, label), nil
+}
+
+// AppendAlternateGeometryProperties appends properties describing an alternate geometry to a Who's On First document.
+// Specifically:
+// * The ID of the record the alternate geometry belongs to (`alt:parent_id`)
+// * The alternate geometry label (`alt:label`)
+// * The source of the alternate geometry (`alt:source`)
+// * The function of the alternate geometry, if present (`alt:function`)
+// * Any extra qualifiers for the alternate geometry (`alt:extras`)
+func AppendAlternateGeometryProperties(ctx context.Context, body []byte, alt_geom *uri.AltGeom) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	id_rsp := root.Get("wof:id")
+
+	if !id_rsp.Exists() {
+		return nil, errors.New("Missing wof:id property")
+	}
+
+	label, err := alt_geom.String()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive alternate geometry label, %w", err)
+	}
+
+	extras := alt_geom.Extras
+
+	if extras == nil {
+		extras = make([]string, 0)
+	}
+
+	details := map[string]interface{}{
+		"alt:parent_id": id_rsp.Int(),
+		"alt:label":     label,
+		"alt:source":    alt_geom.Source,
+		"alt:extras":    extras,
+	}
+
+	if alt_geom.Function != "" {
+		details["alt:function"] = alt_geom.Function
+	}
+
+	for k, v := range details {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
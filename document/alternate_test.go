@@ -0,0 +1,171 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"strings"
+	"testing"
+)
+
+func TestAltGeomFromLabel(t *testing.T) {
+
+	tests := map[string]*uri.AltGeom{
+		"quattroshapes": &uri.AltGeom{
+			Source: "quattroshapes",
+		},
+		"uscensus-display": &uri.AltGeom{
+			Source:   "uscensus",
+			Function: "display",
+		},
+		"naturalearth-display-terrestrial-zoom6": &uri.AltGeom{
+			Source:   "naturalearth",
+			Function: "display",
+			Extras:   []string{"terrestrial", "zoom6"},
+		},
+	}
+
+	for label, expected := range tests {
+
+		alt_geom, err := AltGeomFromLabel(label)
+
+		if err != nil {
+			t.Fatalf("Failed to derive alternate geometry from '%s', %v", label, err)
+		}
+
+		if alt_geom.Source != expected.Source || alt_geom.Function != expected.Function {
+			t.Fatalf("Unexpected alternate geometry for '%s': %v", label, alt_geom)
+		}
+
+		if strings.Join(alt_geom.Extras, ",") != strings.Join(expected.Extras, ",") {
+			t.Fatalf("Unexpected alternate geometry extras for '%s': %v", label, alt_geom.Extras)
+		}
+
+		str_label, err := alt_geom.String()
+
+		if err != nil {
+			t.Fatalf("Failed to stringify alternate geometry for '%s', %v", label, err)
+		}
+
+		if str_label != label {
+			t.Fatalf("Expected alternate geometry label '%s' to round-trip, got '%s'", label, str_label)
+		}
+	}
+
+	for _, label := range []string{"", "-display", "naturalearth--zoom6", "naturalearth-", " "} {
+
+		_, err := AltGeomFromLabel(label)
+
+		if err == nil {
+			t.Fatalf("Expected malformed label '%s' to fail", label)
+		}
+	}
+}
+
+func TestAlternateGeometryDocumentId(t *testing.T) {
+
+	// The same alternate geometry should have the same document ID whether it was derived from a path or a label
+
+	from_path, err := uri.AltGeomFromPath("101736545-alt-naturalearth-display-terrestrial-zoom6.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to derive alternate geometry from path, %v", err)
+	}
+
+	from_label, err := AltGeomFromLabel("naturalearth-display-terrestrial-zoom6")
+
+	if err != nil {
+		t.Fatalf("Failed to derive alternate geometry from label, %v", err)
+	}
+
+	for _, alt_geom := range []*uri.AltGeom{from_path, from_label} {
+
+		doc_id, err := AlternateGeometryDocumentId(101736545, alt_geom)
+
+		if err != nil {
+			t.Fatalf("Failed to derive document ID, %v", err)
+		}
+
+		if doc_id != "101736545-naturalearth-display-terrestrial-zoom6" {
+			t.Fatalf("Unexpected document ID: %s", doc_id)
+		}
+	}
+
+	_, err = AlternateGeometryDocumentId(101736545, nil)
+
+	if err == nil {
+		t.Fatalf("Expected missing alternate geometry to fail")
+	}
+}
+
+func TestAppendAlternateGeometryProperties(t *testing.T) {
+
+	ctx := context.Background()
+
+	alt_geom := &uri.AltGeom{
+		Source:   "naturalearth",
+		Function: "display",
+		Extras:   []string{"terrestrial", "zoom6"},
+	}
+
+	feature := []byte(`{"type": "Feature", "properties": {"wof:id": 101736545, "src:alt_label": "naturalearth-display-terrestrial-zoom6"}, "geometry": null}`)
+
+	body, err := AppendAlternateGeometryProperties(ctx, feature, alt_geom)
+
+	if err != nil {
+		t.Fatalf("Failed to append alternate geometry properties, %v", err)
+	}
+
+	expected := map[string]string{
+		"alt:parent_id": "101736545",
+		"alt:label":     "naturalearth-display-terrestrial-zoom6",
+		"alt:source":    "naturalearth",
+		"alt:function":  "display",
+		"alt:extras":    `["terrestrial","zoom6"]`,
+	}
+
+	for k, v := range expected {
+
+		rsp := gjson.GetBytes(body, "properties."+k)
+
+		value := rsp.String()
+
+		if rsp.IsArray() {
+			value = rsp.Raw
+		}
+
+		if value != v {
+			t.Fatalf("Unexpected value for %s: %s (expected %s)", k, value, v)
+		}
+	}
+
+	// Properties-only document, without a function or extras
+
+	props := []byte(`{"wof:id": 101736545}`)
+
+	body, err = AppendAlternateGeometryProperties(ctx, props, &uri.AltGeom{Source: "quattroshapes"})
+
+	if err != nil {
+		t.Fatalf("Failed to append alternate geometry properties, %v", err)
+	}
+
+	if gjson.GetBytes(body, "alt:label").String() != "quattroshapes" {
+		t.Fatalf("Unexpected alt:label for properties-only document")
+	}
+
+	if gjson.GetBytes(body, "alt:function").Exists() {
+		t.Fatalf("Unexpected alt:function for alternate geometry without a function")
+	}
+
+	if gjson.GetBytes(body, "alt:extras").Raw != "[]" {
+		t.Fatalf("Expected empty alt:extras, got %s", gjson.GetBytes(body, "alt:extras").Raw)
+	}
+
+	// Missing wof:id
+
+	_, err = AppendAlternateGeometryProperties(ctx, []byte(`{"wof:name": "Null Island"}`), alt_geom)
+
+	if err == nil {
+		t.Fatalf("Expected document without wof:id to fail")
+	}
+}
@@ -0,0 +1,187 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// re_machinetag matches machine tag strings in the form of `namespace:predicate=value`.
+var re_machinetag = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_]*):([a-zA-Z][a-zA-Z0-9_]*)=(.+)$`)
+
+// re_nonword matches sequences of characters that are not letters, digits or underscores.
+var re_nonword = regexp.MustCompile(`[^\p{L}\p{N}_]+`)
+
+type machineTag struct {
+	namespace string
+	predicate string
+	value     string
+}
+
+// String returns the `namespace:predicate=value` representation of 'mt'.
+func (mt *machineTag) String() string {
+	return fmt.Sprintf("%s:%s=%s", mt.namespace, mt.predicate, mt.value)
+}
+
+// parseMachineTag parses 'str' as a `namespace:predicate=value` machine tag. Namespaces and predicates are lowercased.
+func parseMachineTag(str string) (*machineTag, bool) {
+
+	m := re_machinetag.FindStringSubmatch(strings.TrimSpace(str))
+
+	if len(m) != 4 {
+		return nil, false
+	}
+
+	value := strings.TrimSpace(m[3])
+
+	if value == "" {
+		return nil, false
+	}
+
+	mt := &machineTag{
+		namespace: strings.ToLower(m[1]),
+		predicate: strings.ToLower(m[2]),
+		value:     value,
+	}
+
+	return mt, true
+}
+
+// normalizeMachineTagComponent lowercases 'str' and replaces any sequence of characters that are not letters, digits
+// or underscores with a single underscore.
+func normalizeMachineTagComponent(str string) string {
+	str = strings.ToLower(strings.TrimSpace(str))
+	str = re_nonword.ReplaceAllString(str, "_")
+	return strings.Trim(str, "_")
+}
+
+// AppendCategories appends the categories and machine tags fields used by the Spelunker v1 schema to a Who's On First
+// document. Machine tags (strings in the form of `namespace:predicate=value`) are derived from:
+// * The `wof:categories` property
+// * Any machine tag strings in the `wof:tags` property
+// * The `sg:classifiers` property, where each classifier produces `sg:{type}={category}` and `sg:{category}={subcategory}` machine tags
+// The following properties are appended:
+// * The unique set of machine tags (`categories:all`)
+// * The unique set of namespaces, predicates and values (`categories:namespaces`, `categories:predicates`, `categories:values`)
+// * The unique set of namespace and predicate pairs (`categories:namespaces_predicates`), for example `sg:services`
+// * The unique set of predicate and value pairs (`categories:predicates_values`), for example `services=professional`
+// * The number of machine tags (`counts:categories`)
+// Documents without any machine tags are returned unchanged. Strings in `wof:categories` that are not valid machine
+// tags are counted in the `categories:invalid` key of the `Report` associated with the context, if present.
+func AppendCategories(ctx context.Context, body []byte) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	report := ReportFromContext(ctx)
+
+	tags := make([]*machineTag, 0)
+
+	for _, v := range root.Get("wof:categories").Array() {
+
+		mt, ok := parseMachineTag(v.String())
+
+		if !ok {
+			report.Increment("categories:invalid", 1)
+			continue
+		}
+
+		tags = append(tags, mt)
+	}
+
+	// Plain (non machine) tags are valid so don't count them as invalid
+
+	for _, v := range root.Get("wof:tags").Array() {
+
+		mt, ok := parseMachineTag(v.String())
+
+		if ok {
+			tags = append(tags, mt)
+		}
+	}
+
+	for _, cl := range root.Get("sg:classifiers").Array() {
+
+		sg_type := normalizeMachineTagComponent(cl.Get("type").String())
+		sg_category := normalizeMachineTagComponent(cl.Get("category").String())
+		sg_subcategory := normalizeMachineTagComponent(cl.Get("subcategory").String())
+
+		if sg_type != "" && sg_category != "" {
+			tags = append(tags, &machineTag{namespace: "sg", predicate: sg_type, value: sg_category})
+		}
+
+		if sg_category != "" && sg_subcategory != "" {
+			tags = append(tags, &machineTag{namespace: "sg", predicate: sg_category, value: sg_subcategory})
+		}
+	}
+
+	if len(tags) == 0 {
+		return body, nil
+	}
+
+	all := make(map[string]bool)
+	namespaces := make(map[string]bool)
+	predicates := make(map[string]bool)
+	values := make(map[string]bool)
+	namespaces_predicates := make(map[string]bool)
+	predicates_values := make(map[string]bool)
+
+	for _, mt := range tags {
+		all[mt.String()] = true
+		namespaces[mt.namespace] = true
+		predicates[mt.predicate] = true
+		values[mt.value] = true
+		namespaces_predicates[fmt.Sprintf("%s:%s", mt.namespace, mt.predicate)] = true
+		predicates_values[fmt.Sprintf("%s=%s", mt.predicate, mt.value)] = true
+	}
+
+	sorted := func(m map[string]bool) []string {
+
+		keys := make([]string, 0, len(m))
+
+		for k, _ := range m {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+		return keys
+	}
+
+	to_assign := map[string]interface{}{
+		"categories:all":                   sorted(all),
+		"categories:namespaces":            sorted(namespaces),
+		"categories:predicates":            sorted(predicates),
+		"categories:values":                sorted(values),
+		"categories:namespaces_predicates": sorted(namespaces_predicates),
+		"categories:predicates_values":     sorted(predicates_values),
+		"counts:categories":                len(all),
+	}
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,59 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendCategories(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"properties": {"wof:categories": ["wof:venue=museum", "not a machine tag"], "wof:tags": ["art", "Aviation:type=museum"], "sg:classifiers": [{"type": "Services", "category": "Professional", "subcategory": "Legal & Financial"}]}}`
+
+	new_body, err := AppendCategories(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append categories, %v", err)
+	}
+
+	expected := map[string][]string{
+		"properties.categories:all":                   []string{"aviation:type=museum", "sg:professional=legal_financial", "sg:services=professional", "wof:venue=museum"},
+		"properties.categories:namespaces":            []string{"aviation", "sg", "wof"},
+		"properties.categories:namespaces_predicates": []string{"aviation:type", "sg:professional", "sg:services", "wof:venue"},
+		"properties.categories:predicates_values":     []string{"professional=legal_financial", "services=professional", "type=museum", "venue=museum"},
+	}
+
+	for path, values := range expected {
+
+		rsp := gjson.GetBytes(new_body, path).Array()
+
+		if len(rsp) != len(values) {
+			t.Fatalf("Unexpected number of values for %s, expected %d but got %d", path, len(values), len(rsp))
+		}
+
+		for idx, v := range values {
+
+			if rsp[idx].String() != v {
+				t.Fatalf("Unexpected value for %s at offset %d, expected '%s' but got '%s'", path, idx, v, rsp[idx].String())
+			}
+		}
+	}
+
+	count := gjson.GetBytes(new_body, "properties.counts:categories").Int()
+
+	if count != 4 {
+		t.Fatalf("Unexpected count, expected 4 but got %d", count)
+	}
+
+	unchanged, err := AppendCategories(ctx, []byte(`{"properties": {"wof:tags": ["art"]}}`))
+
+	if err != nil {
+		t.Fatalf("Failed to append categories, %v", err)
+	}
+
+	if gjson.GetBytes(unchanged, "properties.categories:all").Exists() {
+		t.Fatalf("Expected document without machine tags to be unchanged")
+	}
+}
@@ -0,0 +1,478 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"math"
+	"sort"
+	"strings"
+)
+
+const geohash_alphabet string = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// DEFAULT_GEOHASH_PRECISIONS is the default list of geohash precisions assigned by `AppendSpatialCells`.
+var DEFAULT_GEOHASH_PRECISIONS = []int{1, 2, 3, 4, 5, 6, 7}
+
+// DEFAULT_COVER_PRECISION is the default geohash precision used to derive polygon coverage cells.
+const DEFAULT_COVER_PRECISION int = 5
+
+// DEFAULT_MAX_COVER_CELLS is the default maximum number of polygon coverage cells.
+const DEFAULT_MAX_COVER_CELLS int = 1024
+
+// CELLS_GEOHASH_PROPERTY is the property containing the list of geohashes, one for each precision and ordered from
+// coarsest to finest, for a record's centroid. It should be mapped as a `keyword` field.
+const CELLS_GEOHASH_PROPERTY string = "cells:geohash"
+
+// CELLS_QUADKEY_PROPERTY is the property containing the list of (Web Mercator) map tile quadkeys, one for each zoom
+// level and ordered from coarsest to finest, for a record's centroid. It should be mapped as a `keyword` field.
+const CELLS_QUADKEY_PROPERTY string = "cells:quadkey"
+
+// type AppendSpatialCellsOptions defines configuration options for deriving spatial cell identifiers for a Who's On First document.
+type AppendSpatialCellsOptions struct {
+	// GeohashPrecisions is the list of geohash precisions (1-12) to derive cell identifiers for. Default is `DEFAULT_GEOHASH_PRECISIONS`.
+	GeohashPrecisions []int
+	// TileZooms is an optional list of (Web Mercator) map tile zoom levels (1-23) to derive quadkey identifiers for.
+	TileZooms []int
+	// CentroidPrecedence is the ordered list of property prefixes used to derive a centroid. Default is `DEFAULT_CENTROID_PRECEDENCE`.
+	CentroidPrecedence []string
+	// CoverPolygons is a boolean flag indicating whether to derive the set of geohash cells covering a record's polygons.
+	CoverPolygons bool
+	// CoverPrecision is the geohash precision used to derive polygon coverage cells. Default is `DEFAULT_COVER_PRECISION`.
+	CoverPrecision int
+	// MaxCoverCells is the maximum number of polygon coverage cells. If a polygon would be covered by more cells than this
+	// the precision is reduced until it is not. Default is `DEFAULT_MAX_COVER_CELLS`.
+	MaxCoverCells int
+}
+
+// AppendSpatialCells appends hierarchical spatial cell identifiers to a Who's On First document using the default
+// `AppendSpatialCellsOptions`. See `NewAppendSpatialCellsFunc` for details.
+func AppendSpatialCells(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendSpatialCellsOptions{}
+	return appendSpatialCells(ctx, body, opts)
+}
+
+// NewAppendSpatialCellsFunc returns a `PrepareDocumentFunc` that appends hierarchical spatial cell identifiers,
+// derived from a record's centroid, to a Who's On First document. These are meant to be indexed as `keyword`
+// properties so that terms aggregations can be used to count records per cell without geo-grid queries. Specifically:
+// * A `cells:geohash` property containing the geohash for each precision in `opts.GeohashPrecisions`, ordered from
+// coarsest to finest (for example ["9", "9q8yy", "9q8yyk8yt"]).
+// * A `cells:quadkey` property containing the quadkey for each zoom level in `opts.TileZooms`, ordered from coarsest
+// to finest (for example ["0", "023"]).
+// * If `opts.CoverPolygons` is true, a `cells:geohash_cover` property containing the list of geohashes that cover
+// a record's (multi) polygon geometry and a `cells:geohash_cover_precision` property with the precision used.
+// The centroid is derived using the same rules as `NewAppendLocationFunc`. Everything is computed locally.
+func NewAppendSpatialCellsFunc(ctx context.Context, opts *AppendSpatialCellsOptions) (PrepareDocumentFunc, error) {
+
+	for _, p := range opts.GeohashPrecisions {
+
+		if p < 1 || p > 12 {
+			return nil, fmt.Errorf("Invalid geohash precision %d", p)
+		}
+	}
+
+	for _, z := range opts.TileZooms {
+
+		if z < 1 || z > 23 {
+			return nil, fmt.Errorf("Invalid tile zoom level %d", z)
+		}
+	}
+
+	if opts.CoverPrecision < 0 || opts.CoverPrecision > 12 {
+		return nil, fmt.Errorf("Invalid cover precision %d", opts.CoverPrecision)
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendSpatialCells(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendSpatialCells(ctx context.Context, body []byte, opts *AppendSpatialCellsOptions) ([]byte, error) {
+
+	precedence := opts.CentroidPrecedence
+
+	if len(precedence) == 0 {
+		precedence = DEFAULT_CENTROID_PRECEDENCE
+	}
+
+	precisions := opts.GeohashPrecisions
+
+	if len(precisions) == 0 {
+		precisions = DEFAULT_GEOHASH_PRECISIONS
+	}
+
+	loc := deriveLocation(body, precedence)
+
+	to_assign := make(map[string]interface{})
+
+	if loc.source != "" {
+
+		max_precision := 0
+
+		for _, p := range precisions {
+			max_precision = int(math.Max(float64(max_precision), float64(p)))
+		}
+
+		hash := encodeGeohash(loc.latitude, loc.longitude, max_precision)
+
+		geohashes := make([]string, 0)
+
+		for _, p := range uniqueSortedInts(precisions) {
+			geohashes = append(geohashes, hash[0:p])
+		}
+
+		to_assign[CELLS_GEOHASH_PROPERTY] = geohashes
+
+		if len(opts.TileZooms) > 0 {
+
+			quadkeys := make([]string, 0)
+
+			for _, z := range uniqueSortedInts(opts.TileZooms) {
+				quadkeys = append(quadkeys, encodeQuadkey(loc.latitude, loc.longitude, z))
+			}
+
+			to_assign[CELLS_QUADKEY_PROPERTY] = quadkeys
+		}
+	}
+
+	if opts.CoverPolygons && loc.geometry != nil {
+
+		cover_precision := opts.CoverPrecision
+
+		if cover_precision == 0 {
+			cover_precision = DEFAULT_COVER_PRECISION
+		}
+
+		max_cells := opts.MaxCoverCells
+
+		if max_cells == 0 {
+			max_cells = DEFAULT_MAX_COVER_CELLS
+		}
+
+		polygons := make([]polygon, 0)
+
+		var collect func(g *geometry)
+
+		collect = func(g *geometry) {
+
+			polygons = append(polygons, g.polygons...)
+
+			for _, child := range g.geometries {
+				collect(child)
+			}
+		}
+
+		collect(loc.geometry)
+
+		if len(polygons) > 0 {
+
+			cells, precision := coverPolygons(polygons, cover_precision, max_cells)
+
+			if len(cells) > 0 {
+				to_assign["cells:geohash_cover"] = cells
+				to_assign["cells:geohash_cover_precision"] = precision
+			}
+		}
+	}
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+// encodeGeohash returns the geohash for 'lat' and 'lon' at 'precision'.
+func encodeGeohash(lat float64, lon float64, precision int) string {
+
+	min_lat, max_lat := -90.0, 90.0
+	min_lon, max_lon := -180.0, 180.0
+
+	var hash strings.Builder
+
+	bit := 0
+	ch := 0
+	even := true
+
+	for hash.Len() < precision {
+
+		if even {
+
+			mid := (min_lon + max_lon) / 2.0
+
+			if lon >= mid {
+				ch = (ch << 1) | 1
+				min_lon = mid
+			} else {
+				ch = ch << 1
+				max_lon = mid
+			}
+
+		} else {
+
+			mid := (min_lat + max_lat) / 2.0
+
+			if lat >= mid {
+				ch = (ch << 1) | 1
+				min_lat = mid
+			} else {
+				ch = ch << 1
+				max_lat = mid
+			}
+		}
+
+		even = !even
+		bit += 1
+
+		if bit == 5 {
+			hash.WriteByte(geohash_alphabet[ch])
+			bit = 0
+			ch = 0
+		}
+	}
+
+	return hash.String()
+}
+
+// geohashCellSize returns the width and height, in decimal degrees, of a geohash cell at 'precision'.
+func geohashCellSize(precision int) (float64, float64) {
+
+	bits := precision * 5
+
+	lon_bits := (bits + 1) / 2
+	lat_bits := bits / 2
+
+	w := 360.0 / math.Pow(2, float64(lon_bits))
+	h := 180.0 / math.Pow(2, float64(lat_bits))
+
+	return w, h
+}
+
+// encodeQuadkey returns the (Bing Maps) quadkey of the Web Mercator map tile containing 'lat' and 'lon' at 'zoom'.
+func encodeQuadkey(lat float64, lon float64, zoom int) string {
+
+	lat = math.Max(math.Min(lat, 85.05112878), -85.05112878)
+
+	n := math.Pow(2, float64(zoom))
+
+	lat_rad := radians(lat)
+
+	x := int(math.Floor((lon + 180.0) / 360.0 * n))
+	y := int(math.Floor((1.0 - math.Log(math.Tan(lat_rad)+1.0/math.Cos(lat_rad))/math.Pi) / 2.0 * n))
+
+	max := int(n) - 1
+
+	x = int(math.Max(0, math.Min(float64(x), float64(max))))
+	y = int(math.Max(0, math.Min(float64(y), float64(max))))
+
+	var key strings.Builder
+
+	for i := zoom; i > 0; i-- {
+
+		digit := 0
+		mask := 1 << (i - 1)
+
+		if x&mask != 0 {
+			digit += 1
+		}
+
+		if y&mask != 0 {
+			digit += 2
+		}
+
+		key.WriteByte(byte('0' + digit))
+	}
+
+	return key.String()
+}
+
+// coverPolygons returns the sorted list of geohashes, at 'precision' or lower, that cover 'polygons'. A cell covers a
+// polygon if its centre is inside the polygon or if any of the polygon's edges pass through it. If the number of
+// candidate cells for the bounding box of 'polygons' exceeds 'max_cells' the precision is reduced until it does not.
+// Returns the list of geohashes and the precision used.
+func coverPolygons(polygons []polygon, precision int, max_cells int) ([]string, int) {
+
+	min_x := math.Inf(1)
+	min_y := math.Inf(1)
+	max_x := math.Inf(-1)
+	max_y := math.Inf(-1)
+
+	for _, poly := range polygons {
+
+		if len(poly) == 0 {
+			continue
+		}
+
+		for _, pt := range poly[0] {
+			min_x = math.Min(min_x, pt[0])
+			min_y = math.Min(min_y, pt[1])
+			max_x = math.Max(max_x, pt[0])
+			max_y = math.Max(max_y, pt[1])
+		}
+	}
+
+	if math.IsInf(min_x, 0) {
+		return nil, precision
+	}
+
+	for precision > 1 {
+
+		w, h := geohashCellSize(precision)
+
+		cols := math.Floor((max_x+180.0)/w) - math.Floor((min_x+180.0)/w) + 1
+		rows := math.Floor((max_y+90.0)/h) - math.Floor((min_y+90.0)/h) + 1
+
+		if cols*rows <= float64(max_cells) {
+			break
+		}
+
+		precision -= 1
+	}
+
+	w, h := geohashCellSize(precision)
+
+	cells := make(map[string]bool)
+
+	// Cells whose centres are inside the polygon
+
+	start_x := math.Floor((min_x+180.0)/w)*w - 180.0
+	start_y := math.Floor((min_y+90.0)/h)*h - 90.0
+
+	for x := start_x; x <= max_x; x += w {
+
+		for y := start_y; y <= max_y; y += h {
+
+			centre := point{x + (w / 2.0), y + (h / 2.0)}
+
+			for _, poly := range polygons {
+
+				if polygonContains(poly, centre) {
+					cells[encodeGeohash(centre[1], centre[0], precision)] = true
+					break
+				}
+			}
+		}
+	}
+
+	// Cells that polygon edges pass through, sampled at intervals smaller than a cell
+
+	step := math.Min(w, h) / 4.0
+
+	for _, poly := range polygons {
+
+		for _, r := range poly {
+
+			for i := 0; i < len(r)-1; i++ {
+
+				a := r[i]
+				b := r[i+1]
+
+				d := math.Hypot(b[0]-a[0], b[1]-a[1])
+				count := int(math.Ceil(d / step))
+
+				for j := 0; j <= count; j++ {
+
+					t := 0.0
+
+					if count > 0 {
+						t = float64(j) / float64(count)
+					}
+
+					lon := a[0] + t*(b[0]-a[0])
+					lat := a[1] + t*(b[1]-a[1])
+
+					cells[encodeGeohash(lat, lon, precision)] = true
+				}
+			}
+		}
+	}
+
+	hashes := make([]string, 0, len(cells))
+
+	for hash, _ := range cells {
+		hashes = append(hashes, hash)
+	}
+
+	sort.Strings(hashes)
+
+	return hashes, precision
+}
+
+// polygonContains returns a boolean value indicating whether 'pt' is inside 'poly' (and not inside any of its holes)
+// using the ray casting algorithm.
+func polygonContains(poly polygon, pt point) bool {
+
+	if len(poly) == 0 || !ringContains(poly[0], pt) {
+		return false
+	}
+
+	for _, hole := range poly[1:] {
+
+		if ringContains(hole, pt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ringContains(r ring, pt point) bool {
+
+	inside := false
+	count := len(r)
+
+	for i, j := 0, count-1; i < count; j, i = i, i+1 {
+
+		a := r[i]
+		b := r[j]
+
+		if (a[1] > pt[1]) != (b[1] > pt[1]) {
+
+			x := (b[0]-a[0])*(pt[1]-a[1])/(b[1]-a[1]) + a[0]
+
+			if pt[0] < x {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
+
+// uniqueSortedInts returns a sorted copy of 'values' with duplicates removed.
+func uniqueSortedInts(values []int) []int {
+
+	seen := make(map[int]bool)
+	unique := make([]int, 0)
+
+	for _, v := range values {
+
+		if seen[v] {
+			continue
+		}
+
+		seen[v] = true
+		unique = append(unique, v)
+	}
+
+	sort.Ints(unique)
+	return unique
+}
@@ -0,0 +1,119 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendSpatialCells(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"type": "Feature", "properties": {"lbl:latitude": 37.7749, "lbl:longitude": -122.4194}, "geometry": {"type": "Polygon", "coordinates": [[[-122.5,37.7],[-122.35,37.7],[-122.35,37.8],[-122.5,37.8],[-122.5,37.7]]]}}`
+
+	opts := &AppendSpatialCellsOptions{
+		GeohashPrecisions: []int{1, 5, 9},
+		TileZooms:         []int{1, 3},
+		CoverPolygons:     true,
+		CoverPrecision:    6,
+		MaxCoverCells:     64,
+	}
+
+	cells_func, err := NewAppendSpatialCellsFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial cells func, %v", err)
+	}
+
+	new_body, err := cells_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append spatial cells, %v", err)
+	}
+
+	expected := map[string][]string{
+		"properties.cells:geohash": []string{"9", "9q8yy", "9q8yyk8yt"},
+		"properties.cells:quadkey": []string{"0", "023"},
+	}
+
+	for path, values := range expected {
+
+		rsp := gjson.GetBytes(new_body, path).Array()
+
+		if len(rsp) != len(values) {
+			t.Fatalf("Unexpected value for %s, expected %v but got %s", path, values, gjson.GetBytes(new_body, path).Raw)
+		}
+
+		for idx, v := range values {
+
+			if rsp[idx].String() != v {
+				t.Fatalf("Unexpected value for %s, expected %v but got %s", path, values, gjson.GetBytes(new_body, path).Raw)
+			}
+		}
+	}
+
+	precision := gjson.GetBytes(new_body, "properties.cells:geohash_cover_precision").Int()
+
+	if precision >= 6 {
+		t.Fatalf("Expected cover precision to be reduced, got %d", precision)
+	}
+
+	cover := gjson.GetBytes(new_body, "properties.cells:geohash_cover").Array()
+
+	if len(cover) == 0 || len(cover) > 64 {
+		t.Fatalf("Unexpected number of cover cells, %d", len(cover))
+	}
+}
+
+func TestAppendSpatialCellsDefaults(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"lbl:latitude": 37.7749, "lbl:longitude": -122.4194}`
+
+	new_body, err := AppendSpatialCells(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append spatial cells, %v", err)
+	}
+
+	geohashes := gjson.GetBytes(new_body, "cells:geohash").Array()
+
+	if len(geohashes) != len(DEFAULT_GEOHASH_PRECISIONS) {
+		t.Fatalf("Unexpected number of geohashes, %s", string(new_body))
+	}
+
+	for idx, h := range geohashes {
+
+		if len(h.String()) != DEFAULT_GEOHASH_PRECISIONS[idx] {
+			t.Fatalf("Unexpected geohash at position %d, %s", idx, string(new_body))
+		}
+	}
+
+	if gjson.GetBytes(new_body, "cells:quadkey").Exists() {
+		t.Fatalf("Unexpected cells:quadkey property, %s", string(new_body))
+	}
+
+	// Precisions are sorted and duplicates removed
+
+	opts := &AppendSpatialCellsOptions{
+		GeohashPrecisions: []int{3, 1, 3},
+	}
+
+	cells_func, err := NewAppendSpatialCellsFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create spatial cells func, %v", err)
+	}
+
+	new_body, err = cells_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append spatial cells, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "cells:geohash").Raw != `["9","9q8"]` {
+		t.Fatalf("Unexpected cells:geohash property, %s", string(new_body))
+	}
+}
@@ -5,12 +5,186 @@ import (
 	"fmt"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-sources"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
+// CONCORDANCES_IDS_PROPERTY is the property containing the normalized "{SOURCE}:{KEY}={ID}" pairs (for example "gn:id=5391959")
+// for the concordances of a Who's On First record, suitable for mapping as a `keyword` field.
+const CONCORDANCES_IDS_PROPERTY string = "concordances:ids"
+
+// CONCORDANCES_SOURCES_PROPERTY is the property containing the details (full name, URL and license) of the sources of the
+// concordances of a Who's On First record.
+const CONCORDANCES_SOURCES_PROPERTY string = "concordances:sources"
+
+// CONCORDANCES_UNKNOWN_SOURCES_PROPERTY is the property containing the concordance prefixes of a Who's On First record that
+// are not defined by the `whosonfirst/go-whosonfirst-sources` package.
+const CONCORDANCES_UNKNOWN_SOURCES_PROPERTY string = "concordances:unknown_sources"
+
+// type Concordance defines a single identifier for a Who's On First record in an external source.
+type Concordance struct {
+	// Source is the source prefix, for example "gn".
+	Source string `json:"source"`
+	// Key is the complete concordance key, for example "gn:id".
+	Key string `json:"key"`
+	// Id is the normalized (string) identifier, for example "5391959".
+	Id string `json:"id"`
+}
+
+// String returns 'c' as a "{KEY}={ID}" pair, for example "gn:id=5391959".
+func (c *Concordance) String() string {
+	return fmt.Sprintf("%s=%s", c.Key, c.Id)
+}
+
+var sources_by_prefix map[string]*sources.WOFSource
+
+var sources_by_prefix_init sync.Once
+
+// concordanceSource returns the `sources.WOFSource` definition for the concordance prefix 'prefix'. Prefixes are
+// resolved by (source) name first and then by (source) prefix since, for example, the "gn" prefix belongs to the
+// "geonames" source.
+func concordanceSource(prefix string) (*sources.WOFSource, bool) {
+
+	src, err := sources.GetSourceByName(prefix)
+
+	if err == nil {
+		return src, true
+	}
+
+	sources_by_prefix_init.Do(func() {
+
+		sources_by_prefix = make(map[string]*sources.WOFSource)
+
+		spec, err := sources.Spec()
+
+		if err != nil {
+			return
+		}
+
+		for _, details := range *spec {
+			src := details
+			sources_by_prefix[src.Prefix] = &src
+		}
+	})
+
+	src, ok := sources_by_prefix[prefix]
+	return src, ok
+}
+
+// concordanceId returns the normalized string form of the concordance identifier 'v'. Numeric identifiers are
+// rendered without exponents or trailing decimals so that, for example, 5391959, 5391959.0 and "5391959" are
+// equivalent. The second value is false if 'v' is empty or not a string or number.
+func concordanceId(v gjson.Result) (string, bool) {
+
+	switch v.Type {
+	case gjson.Number:
+
+		i, err := strconv.ParseInt(v.Raw, 10, 64)
+
+		if err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+
+		if v.Num == float64(int64(v.Num)) {
+			return strconv.FormatInt(int64(v.Num), 10), true
+		}
+
+		return strconv.FormatFloat(v.Num, 'f', -1, 64), true
+
+	case gjson.String:
+
+		id := strings.TrimSpace(v.String())
+
+		if id == "" {
+			return "", false
+		}
+
+		return id, true
+
+	default:
+		return "", false
+	}
+}
+
+// DeriveConcordances returns the list of `Concordance` instances, sorted by key and identifier, defined by the
+// `wof:concordances` property of a Who's On First document. Concordances whose value is a list yield one `Concordance`
+// per (string or numeric) element. Empty values are excluded.
+func DeriveConcordances(ctx context.Context, body []byte) ([]*Concordance, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	concordances := make([]*Concordance, 0)
+	seen := make(map[string]bool)
+
+	for k, v := range root.Get("wof:concordances").Map() {
+
+		k = strings.TrimSpace(k)
+		prefix := strings.SplitN(k, ":", 2)[0]
+
+		if prefix == "" {
+			continue
+		}
+
+		values := []gjson.Result{v}
+
+		if v.IsArray() {
+			values = v.Array()
+		}
+
+		for _, value := range values {
+
+			id, ok := concordanceId(value)
+
+			if !ok {
+				continue
+			}
+
+			c := &Concordance{
+				Source: prefix,
+				Key:    k,
+				Id:     id,
+			}
+
+			if seen[c.String()] {
+				continue
+			}
+
+			seen[c.String()] = true
+			concordances = append(concordances, c)
+		}
+	}
+
+	sort.Slice(concordances, func(i, j int) bool {
+
+		if concordances[i].Key != concordances[j].Key {
+			return concordances[i].Key < concordances[j].Key
+		}
+
+		return concordances[i].Id < concordances[j].Id
+	})
+
+	return concordances, nil
+}
+
 // AppendConcordancesStats appends statistics about the `wof:concordances` properties in a Who's On First document.
 // Specifically:
 // * An array containing the set of source prefixes for concordances
 // * The total number of concordances in a record.
+// * An array of normalized "{SOURCE}:{KEY}={ID}" pairs (`concordances:ids`), for example "gn:id=5391959" or "wd:id=Q62".
+// * An array containing the prefix, key, full name, URL and license of each source, as defined by the
+// `whosonfirst/go-whosonfirst-sources` package (`concordances:sources`).
+// * An array containing the prefixes of sources that are not defined by the `whosonfirst/go-whosonfirst-sources` package
+// (`concordances:unknown_sources`) and the number of those sources (`counts:concordances_unknown`). Each unknown source is
+// also counted in the `concordances:unknown_source` key of the `Report` associated with the context, if present.
 func AppendConcordancesStats(ctx context.Context, body []byte) ([]byte, error) {
 
 	root := gjson.ParseBytes(body)
@@ -27,18 +201,69 @@ func AppendConcordancesStats(ctx context.Context, body []byte) ([]byte, error) {
 		return body, nil
 	}
 
-	sources := make([]string, 0)
+	report := ReportFromContext(ctx)
+
+	keys := make([]string, 0)
 
 	for k, _ := range concordances_rsp.Map() {
-		sources = append(sources, k)
+		keys = append(keys, k)
 	}
 
-	stats := map[string]interface{}{
-		"wof:concordances_sources":  sources,
-		"counts:concordances_total": len(sources),
+	sort.Strings(keys)
+
+	concordances, err := DeriveConcordances(ctx, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(concordances))
+
+	for idx, c := range concordances {
+		ids[idx] = c.String()
+	}
+
+	details := make([]map[string]string, 0)
+	unknown := make([]string, 0)
+
+	seen := make(map[string]bool)
+
+	for _, k := range keys {
+
+		prefix := strings.SplitN(k, ":", 2)[0]
+
+		if seen[prefix] {
+			continue
+		}
+
+		seen[prefix] = true
+
+		src, ok := concordanceSource(prefix)
+
+		if !ok {
+			unknown = append(unknown, prefix)
+			report.Increment("concordances:unknown_source", 1)
+			continue
+		}
+
+		details = append(details, map[string]string{
+			"prefix":   prefix,
+			"key":      k,
+			"name":     src.Name,
+			"fullname": src.Fullname,
+			"url":      src.URL,
+			"license":  src.License,
+		})
 	}
 
-	var err error
+	stats := map[string]interface{}{
+		"wof:concordances_sources":            keys,
+		"counts:concordances_total":           len(keys),
+		"counts:concordances_unknown":         len(unknown),
+		CONCORDANCES_IDS_PROPERTY:             ids,
+		CONCORDANCES_SOURCES_PROPERTY:         details,
+		CONCORDANCES_UNKNOWN_SOURCES_PROPERTY: unknown,
+	}
 
 	for k, v := range stats {
 
@@ -0,0 +1,112 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendConcordancesStats(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := []byte(`{"properties": {"wof:name": "San Francisco", "wof:concordances": {"gn:id": 5391959, "wd:id": "Q62", "gp:id": 2487956.0, "tgn:id": "7014456", "bogus:id": 1234, "empty:id": ""}}}`)
+
+	report := NewReport()
+	report_ctx := WithReport(ctx, report)
+
+	new_body, err := AppendConcordancesStats(report_ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to append concordances stats, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "properties.counts:concordances_total").Int() != 6 {
+		t.Fatalf("Unexpected concordances total")
+	}
+
+	expected_ids := []string{
+		"bogus:id=1234",
+		"gn:id=5391959",
+		"gp:id=2487956",
+		"tgn:id=7014456",
+		"wd:id=Q62",
+	}
+
+	ids := gjson.GetBytes(new_body, "properties.concordances:ids").Array()
+
+	if len(ids) != len(expected_ids) {
+		t.Fatalf("Unexpected concordances ids: %v", ids)
+	}
+
+	for idx, id := range ids {
+
+		if id.String() != expected_ids[idx] {
+			t.Fatalf("Unexpected concordance id at offset %d: %s", idx, id.String())
+		}
+	}
+
+	sources := gjson.GetBytes(new_body, "properties.concordances:sources").Array()
+
+	if len(sources) != 4 {
+		t.Fatalf("Unexpected concordances sources: %v", sources)
+	}
+
+	gn := sources[0]
+
+	if gn.Get("prefix").String() != "gn" || gn.Get("fullname").String() != "GeoNames" {
+		t.Fatalf("Unexpected source details for gn: %s", gn.Raw)
+	}
+
+	if gn.Get("url").String() == "" || gn.Get("license").String() == "" {
+		t.Fatalf("Missing URL or license for gn: %s", gn.Raw)
+	}
+
+	unknown := gjson.GetBytes(new_body, "properties.concordances:unknown_sources").Array()
+
+	if len(unknown) != 2 || unknown[0].String() != "bogus" || unknown[1].String() != "empty" {
+		t.Fatalf("Unexpected unknown sources: %v", unknown)
+	}
+
+	if gjson.GetBytes(new_body, "properties.counts:concordances_unknown").Int() != 2 {
+		t.Fatalf("Unexpected count of unknown sources")
+	}
+
+	if report.Count("concordances:unknown_source") != 2 {
+		t.Fatalf("Unexpected report count for unknown sources")
+	}
+}
+
+func TestDeriveConcordances(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := []byte(`{"properties": {"wof:concordances": {"gn:id": [5391959, "5391959", 5391960], "wd:id": " Q62 "}}}`)
+
+	concordances, err := DeriveConcordances(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to derive concordances, %v", err)
+	}
+
+	expected := []string{
+		"gn:id=5391959",
+		"gn:id=5391960",
+		"wd:id=Q62",
+	}
+
+	if len(concordances) != len(expected) {
+		t.Fatalf("Unexpected concordances: %v", concordances)
+	}
+
+	for idx, c := range concordances {
+
+		if c.String() != expected[idx] {
+			t.Fatalf("Unexpected concordance at offset %d: %s", idx, c.String())
+		}
+	}
+
+	if concordances[2].Source != "wd" || concordances[2].Id != "Q62" {
+		t.Fatalf("Unexpected concordance details: %v", concordances[2])
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/sfomuseum/go-edtf/parser"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	wh_edtf "github.com/whosonfirst/go-whosonfirst-edtf"
 	_ "log"
+	"time"
 )
 
 type date_span struct {
@@ -20,9 +22,97 @@ type date_range struct {
 	inner *date_span
 }
 
+// EDTF_OPEN_NOW maps open ("..") `edtf:cessation` dates to the time a document is prepared.
+const EDTF_OPEN_NOW string = "now"
+
+// EDTF_OPEN_FUTURE maps open ("..") `edtf:cessation` dates to a far-future date.
+const EDTF_OPEN_FUTURE string = "future"
+
+const (
+	// EDTF_STATUS_KNOWN indicates that a date range was derived from a valid EDTF string.
+	EDTF_STATUS_KNOWN string = "known"
+	// EDTF_STATUS_OPEN indicates an open ("..") EDTF string for which no date range was assigned.
+	EDTF_STATUS_OPEN string = "open"
+	// EDTF_STATUS_OPEN_NOW indicates an open EDTF string that was mapped to the time a document was prepared.
+	EDTF_STATUS_OPEN_NOW string = "open_now"
+	// EDTF_STATUS_OPEN_FUTURE indicates an open EDTF string that was mapped to a far-future date.
+	EDTF_STATUS_OPEN_FUTURE string = "open_future"
+	// EDTF_STATUS_OPEN_WIDEST indicates an open EDTF string that was mapped to the widest plausible date range.
+	EDTF_STATUS_OPEN_WIDEST string = "open_widest"
+	// EDTF_STATUS_UNKNOWN indicates an unknown ("" or "uuuu") EDTF string for which no date range was assigned.
+	EDTF_STATUS_UNKNOWN string = "unknown"
+	// EDTF_STATUS_UNKNOWN_WIDEST indicates an unknown EDTF string that was mapped to the widest plausible date range.
+	EDTF_STATUS_UNKNOWN_WIDEST string = "unknown_widest"
+	// EDTF_STATUS_INVALID indicates an EDTF string that could not be parsed.
+	EDTF_STATUS_INVALID string = "invalid"
+)
+
+// DEFAULT_EDTF_EARLIEST is the default earliest plausible date used when mapping unknown EDTF strings.
+var DEFAULT_EDTF_EARLIEST = time.Date(-9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DEFAULT_EDTF_LATEST is the default latest plausible (far-future) date used when mapping open and unknown EDTF strings.
+var DEFAULT_EDTF_LATEST = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// type AppendEDTFRangesOptions defines configuration options for deriving date ranges from EDTF strings.
+type AppendEDTFRangesOptions struct {
+	// OpenCessation defines how open ("..") `edtf:cessation` dates are mapped. Valid options are `EDTF_OPEN_NOW` and
+	// `EDTF_OPEN_FUTURE`. If empty no date range is assigned.
+	OpenCessation string
+	// WidenUnknown is a boolean value indicating whether unknown (and open `edtf:inception`) dates should be mapped to
+	// the widest plausible date range. If false no date range is assigned.
+	WidenUnknown bool
+	// Earliest is the earliest plausible date. Default is `DEFAULT_EDTF_EARLIEST`.
+	Earliest time.Time
+	// Latest is the latest plausible (far-future) date. Default is `DEFAULT_EDTF_LATEST`.
+	Latest time.Time
+	// Now is the time used for `EDTF_OPEN_NOW` and as the latest plausible date for unknown inception dates.
+	// Default is the time a document is prepared.
+	Now time.Time
+	// DateRanges is a boolean value indicating whether Elasticsearch `date_range` properties should also be assigned.
+	// These are `date:inception_inner_range`, `date:inception_outer_range`, `date:cessation_inner_range`,
+	// `date:cessation_outer_range` and `date:existence_range` which spans the outer start of the inception date
+	// to the outer end of the cessation date. Values are epoch seconds so the properties should be mapped using
+	// the `epoch_second` format.
+	DateRanges bool
+	// RecordErrors is a boolean value indicating whether EDTF strings that can not be parsed should be recorded, with a
+	// status of `EDTF_STATUS_INVALID` and in the `date:parse_errors` property, rather than returning an error.
+	RecordErrors bool
+}
+
 // AppendEDTFRanges appends numeric date ranges derived from `edtf:inception` and `edtf:cessation` properties
-// to a Who's On First document.
+// to a Who's On First document using the default `AppendEDTFRangesOptions`. See `NewAppendEDTFRangesFunc` for details.
 func AppendEDTFRanges(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendEDTFRangesOptions{}
+	return appendEDTFRanges(ctx, body, opts)
+}
+
+// NewAppendEDTFRangesFunc returns a `PrepareDocumentFunc` that appends numeric date ranges derived from `edtf:inception`
+// and `edtf:cessation` properties to a Who's On First document. Each property is assigned inner and outer start and end
+// dates (for example `date:inception_inner_start`) and a status (`date:inception_status` or `date:cessation_status`)
+// recording how the range was derived. Open and unknown EDTF strings are handled as follows:
+// * Open cessation dates are mapped to the time the document is prepared (`EDTF_OPEN_NOW`) or `opts.Latest` (`EDTF_OPEN_FUTURE`).
+// * Unknown inception dates, and open inception dates, are mapped to the range between `opts.Earliest` and the outer end of the
+// cessation date (or `opts.Now` if the cessation date is not known) when `opts.WidenUnknown` is true.
+// * Unknown cessation dates are mapped to the range between the outer start of the inception date (or `opts.Earliest` if the
+// inception date is not known) and `opts.Latest` when `opts.WidenUnknown` is true.
+// Otherwise no date range is assigned and the status is `EDTF_STATUS_OPEN` or `EDTF_STATUS_UNKNOWN`.
+func NewAppendEDTFRangesFunc(ctx context.Context, opts *AppendEDTFRangesOptions) (PrepareDocumentFunc, error) {
+
+	switch opts.OpenCessation {
+	case "", EDTF_OPEN_NOW, EDTF_OPEN_FUTURE:
+		// pass
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported open cessation mapping '%s'", opts.OpenCessation)
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendEDTFRanges(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendEDTFRanges(ctx context.Context, body []byte, opts *AppendEDTFRangesOptions) ([]byte, error) {
 
 	props := gjson.ParseBytes(body)
 
@@ -32,19 +122,131 @@ func AppendEDTFRanges(ctx context.Context, body []byte) ([]byte, error) {
 		props = props_rsp
 	}
 
+	earliest := opts.Earliest
+
+	if earliest.IsZero() {
+		earliest = DEFAULT_EDTF_EARLIEST
+	}
+
+	latest := opts.Latest
+
+	if latest.IsZero() {
+		latest = DEFAULT_EDTF_LATEST
+	}
+
+	now := opts.Now
+
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	parse_errors := make([]string, 0)
+
+	inception_status := ""
+	cessation_status := ""
+
 	inception_range, err := deriveRanges(props, "edtf:inception")
 
 	if err != nil {
-		return nil, fmt.Errorf("Failed to derive inception ranges, %w", err)
+
+		if !opts.RecordErrors {
+			return nil, fmt.Errorf("Failed to derive inception ranges, %w", err)
+		}
+
+		ReportFromContext(ctx).Increment("edtf:parse_error", 1)
+		parse_errors = append(parse_errors, "edtf:inception")
+		inception_status = EDTF_STATUS_INVALID
 	}
 
 	cessation_range, err := deriveRanges(props, "edtf:cessation")
 
 	if err != nil {
-		return nil, fmt.Errorf("Failed to derive cessation ranges, %w", err)
+
+		if !opts.RecordErrors {
+			return nil, fmt.Errorf("Failed to derive cessation ranges, %w", err)
+		}
+
+		ReportFromContext(ctx).Increment("edtf:parse_error", 1)
+		parse_errors = append(parse_errors, "edtf:cessation")
+		cessation_status = EDTF_STATUS_INVALID
 	}
 
-	to_assign := make(map[string]int64)
+	inception_rsp := props.Get("edtf:inception")
+	cessation_rsp := props.Get("edtf:cessation")
+
+	if inception_rsp.Exists() && inception_status == "" {
+
+		inception_str := inception_rsp.String()
+
+		switch {
+		case inception_range != nil:
+			inception_status = EDTF_STATUS_KNOWN
+		case isOpen(inception_str) || isUnknown(inception_str) || isUnspecified(inception_str):
+
+			inception_status = EDTF_STATUS_UNKNOWN
+
+			if isOpen(inception_str) {
+				inception_status = EDTF_STATUS_OPEN
+			}
+
+			if opts.WidenUnknown {
+
+				upper := now.Unix()
+
+				if cessation_range != nil {
+					upper = cessation_range.outer.end
+				}
+
+				inception_range = newDateRange(earliest.Unix(), upper)
+
+				if inception_status == EDTF_STATUS_OPEN {
+					inception_status = EDTF_STATUS_OPEN_WIDEST
+				} else {
+					inception_status = EDTF_STATUS_UNKNOWN_WIDEST
+				}
+			}
+		}
+	}
+
+	if cessation_rsp.Exists() && cessation_status == "" {
+
+		cessation_str := cessation_rsp.String()
+
+		switch {
+		case cessation_range != nil:
+			cessation_status = EDTF_STATUS_KNOWN
+		case isOpen(cessation_str):
+
+			cessation_status = EDTF_STATUS_OPEN
+
+			switch opts.OpenCessation {
+			case EDTF_OPEN_NOW:
+				cessation_range = newDateRange(now.Unix(), now.Unix())
+				cessation_status = EDTF_STATUS_OPEN_NOW
+			case EDTF_OPEN_FUTURE:
+				cessation_range = newDateRange(latest.Unix(), latest.Unix())
+				cessation_status = EDTF_STATUS_OPEN_FUTURE
+			}
+
+		case isUnknown(cessation_str) || isUnspecified(cessation_str):
+
+			cessation_status = EDTF_STATUS_UNKNOWN
+
+			if opts.WidenUnknown {
+
+				lower := earliest.Unix()
+
+				if inception_status == EDTF_STATUS_KNOWN {
+					lower = inception_range.outer.start
+				}
+
+				cessation_range = newDateRange(lower, latest.Unix())
+				cessation_status = EDTF_STATUS_UNKNOWN_WIDEST
+			}
+		}
+	}
+
+	to_assign := make(map[string]interface{})
 
 	if inception_range != nil {
 		to_assign["date:inception_inner_start"] = inception_range.inner.start
@@ -60,6 +262,196 @@ func AppendEDTFRanges(ctx context.Context, body []byte) ([]byte, error) {
 		to_assign["date:cessation_outer_end"] = cessation_range.outer.end
 	}
 
+	if opts.DateRanges {
+
+		existence := make(map[string]int64)
+
+		if inception_range != nil {
+			to_assign["date:inception_inner_range"] = inception_range.inner.esDateRange()
+			to_assign["date:inception_outer_range"] = inception_range.outer.esDateRange()
+			existence["gte"] = inception_range.outer.start
+		}
+
+		if cessation_range != nil {
+			to_assign["date:cessation_inner_range"] = cessation_range.inner.esDateRange()
+			to_assign["date:cessation_outer_range"] = cessation_range.outer.esDateRange()
+			existence["lte"] = cessation_range.outer.end
+		}
+
+		// A missing bound means the range is unbounded in that direction
+
+		if len(existence) > 0 {
+			to_assign["date:existence_range"] = existence
+		}
+	}
+
+	if inception_status != "" {
+		to_assign["date:inception_status"] = inception_status
+	}
+
+	if cessation_status != "" {
+		to_assign["date:cessation_status"] = cessation_status
+	}
+
+	if len(parse_errors) > 0 {
+		to_assign["date:parse_errors"] = parse_errors
+	}
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s (%v), %w", path, v, err)
+		}
+	}
+
+	return body, nil
+}
+
+// esDateRange returns 's' as an Elasticsearch `date_range` value.
+func (s *date_span) esDateRange() map[string]int64 {
+
+	// Inner spans for very fuzzy dates may have an end before their start
+
+	start := s.start
+	end := s.end
+
+	if end < start {
+		start, end = end, start
+	}
+
+	return map[string]int64{
+		"gte": start,
+		"lte": end,
+	}
+}
+
+// PrepareEDTF applies EDTF-related updates to a Who's On First document using the default `AppendEDTFRangesOptions`.
+// See `NewPrepareEDTFFunc` for details.
+func PrepareEDTF(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendEDTFRangesOptions{}
+	return prepareEDTF(ctx, body, opts)
+}
+
+// NewPrepareEDTFFunc returns a `PrepareDocumentFunc` that applies all the EDTF-related updates to a Who's On First
+// document. Specifically:
+// * Deprecated EDTF strings ("open", "uuuu") are replaced using the `whosonfirst/go-whosonfirst-edtf` package.
+// * Date ranges are appended as described in `NewAppendEDTFRangesFunc`, using 'opts'.
+// * The year, decade and century of known `edtf:inception` and `edtf:cessation` dates are appended (for example
+// `date:inception_year` (1970), `date:inception_decade` ("1970s") and `date:inception_century` ("1900s")).
+// Problems are recorded (in the `date:parse_errors` property and the `Report` associated with the context, if present)
+// rather than returned as errors. This function works with both complete GeoJSON Features and properties-only documents.
+func NewPrepareEDTFFunc(ctx context.Context, opts *AppendEDTFRangesOptions) (PrepareDocumentFunc, error) {
+
+	_, err := NewAppendEDTFRangesFunc(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return prepareEDTF(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func prepareEDTF(ctx context.Context, body []byte, opts *AppendEDTFRangesOptions) ([]byte, error) {
+
+	report := ReportFromContext(ctx)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	// The whosonfirst/go-whosonfirst-edtf package expects a "properties" dictionary
+
+	wrapped := body
+
+	if !props_rsp.Exists() {
+
+		var err error
+		wrapped, err = sjson.SetRawBytes([]byte(`{}`), "properties", body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to wrap properties, %w", err)
+		}
+	}
+
+	// Note that edtf.UpdateBytes returns a nil body when there is an error
+
+	changed, updated, err := wh_edtf.UpdateBytes(wrapped)
+
+	if err != nil {
+		report.Increment("edtf:update_error", 1)
+	} else if changed {
+
+		if props_rsp.Exists() {
+			body = updated
+		} else {
+			body = []byte(gjson.GetBytes(updated, "properties").Raw)
+		}
+	}
+
+	ranges_opts := *opts
+	ranges_opts.RecordErrors = true
+
+	body, err = appendEDTFRanges(ctx, body, &ranges_opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return appendEDTFFacets(ctx, body)
+}
+
+// appendEDTFFacets appends year, decade and century properties derived from the inner start of known `edtf:inception`
+// dates and the inner end of known `edtf:cessation` dates.
+func appendEDTFFacets(ctx context.Context, body []byte) ([]byte, error) {
+
+	props := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		props = props_rsp
+	}
+
+	facets := map[string]string{
+		"inception": "date:inception_inner_start",
+		"cessation": "date:cessation_inner_end",
+	}
+
+	to_assign := make(map[string]interface{})
+
+	for label, ts_path := range facets {
+
+		status_rsp := props.Get(fmt.Sprintf("date:%s_status", label))
+
+		if status_rsp.String() != EDTF_STATUS_KNOWN {
+			continue
+		}
+
+		ts_rsp := props.Get(ts_path)
+
+		if !ts_rsp.Exists() {
+			continue
+		}
+
+		year := time.Unix(ts_rsp.Int(), 0).UTC().Year()
+
+		to_assign[fmt.Sprintf("date:%s_year", label)] = year
+		to_assign[fmt.Sprintf("date:%s_decade", label)] = fmt.Sprintf("%ds", floorInt(year, 10))
+		to_assign[fmt.Sprintf("date:%s_century", label)] = fmt.Sprintf("%ds", floorInt(year, 100))
+	}
+
+	var err error
+
 	for k, v := range to_assign {
 
 		path := k
@@ -71,13 +463,38 @@ func AppendEDTFRanges(ctx context.Context, body []byte) ([]byte, error) {
 		body, err = sjson.SetBytes(body, path, v)
 
 		if err != nil {
-			return nil, fmt.Errorf("Failed to assign %s (%d), %w", path, v, err)
+			return nil, fmt.Errorf("Failed to assign %s (%v), %w", path, v, err)
 		}
 	}
 
 	return body, nil
 }
 
+// floorInt rounds 'v' down to the nearest multiple of 'm', accounting for negative numbers.
+func floorInt(v int, m int) int {
+
+	if v < 0 && v%m != 0 {
+		return ((v / m) - 1) * m
+	}
+
+	return (v / m) * m
+}
+
+// newDateRange returns a `date_range` whose inner and outer spans are both 'start' to 'end'.
+func newDateRange(start int64, end int64) *date_range {
+
+	return &date_range{
+		outer: &date_span{
+			start: start,
+			end:   end,
+		},
+		inner: &date_span{
+			start: start,
+			end:   end,
+		},
+	}
+}
+
 func deriveRanges(props gjson.Result, path string) (*date_range, error) {
 
 	edtf_rsp := props.Get(path)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/tidwall/gjson"
 	"testing"
+	"time"
 )
 
 func TestAppendEDTFRanges(t *testing.T) {
@@ -52,3 +53,240 @@ func TestAppendEDTFRanges(t *testing.T) {
 		// fmt.Println(string(new_body))
 	}
 }
+
+func TestAppendEDTFRangesSentinels(t *testing.T) {
+
+	ctx := context.Background()
+
+	now := time.Date(2021, 10, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		opts                     *AppendEDTFRangesOptions
+		body                     string
+		inception_status         string
+		cessation_status         string
+		cessation_outer_end      int64
+		expected_cessation_range bool
+	}{
+		{
+			opts:             &AppendEDTFRangesOptions{},
+			body:             `{"properties": {"edtf:inception": "1970-01-01", "edtf:cessation": ".." }}`,
+			inception_status: EDTF_STATUS_KNOWN,
+			cessation_status: EDTF_STATUS_OPEN,
+		},
+		{
+			opts:                     &AppendEDTFRangesOptions{OpenCessation: EDTF_OPEN_NOW, Now: now},
+			body:                     `{"properties": {"edtf:inception": "1970-01-01", "edtf:cessation": ".." }}`,
+			inception_status:         EDTF_STATUS_KNOWN,
+			cessation_status:         EDTF_STATUS_OPEN_NOW,
+			cessation_outer_end:      now.Unix(),
+			expected_cessation_range: true,
+		},
+		{
+			opts:                     &AppendEDTFRangesOptions{OpenCessation: EDTF_OPEN_FUTURE},
+			body:                     `{"properties": {"edtf:inception": "1970-01-01", "edtf:cessation": "open" }}`,
+			inception_status:         EDTF_STATUS_KNOWN,
+			cessation_status:         EDTF_STATUS_OPEN_FUTURE,
+			cessation_outer_end:      DEFAULT_EDTF_LATEST.Unix(),
+			expected_cessation_range: true,
+		},
+		{
+			opts:             &AppendEDTFRangesOptions{OpenCessation: EDTF_OPEN_NOW},
+			body:             `{"properties": {"edtf:inception": "uuuu", "edtf:cessation": "" }}`,
+			inception_status: EDTF_STATUS_UNKNOWN,
+			cessation_status: EDTF_STATUS_UNKNOWN,
+		},
+		{
+			opts:                     &AppendEDTFRangesOptions{WidenUnknown: true, Now: now},
+			body:                     `{"properties": {"edtf:inception": "uuuu", "edtf:cessation": "uuuu" }}`,
+			inception_status:         EDTF_STATUS_UNKNOWN_WIDEST,
+			cessation_status:         EDTF_STATUS_UNKNOWN_WIDEST,
+			cessation_outer_end:      DEFAULT_EDTF_LATEST.Unix(),
+			expected_cessation_range: true,
+		},
+		{
+			opts:                     &AppendEDTFRangesOptions{WidenUnknown: true, Now: now},
+			body:                     `{"properties": {"edtf:inception": "..", "edtf:cessation": "1980-07-01" }}`,
+			inception_status:         EDTF_STATUS_OPEN_WIDEST,
+			cessation_status:         EDTF_STATUS_KNOWN,
+			cessation_outer_end:      time.Date(1980, 7, 1, 23, 59, 59, 0, time.UTC).Unix(),
+			expected_cessation_range: true,
+		},
+	}
+
+	for idx, test := range tests {
+
+		edtf_func, err := NewAppendEDTFRangesFunc(ctx, test.opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create EDTF ranges func for test %d, %v", idx, err)
+		}
+
+		new_body, err := edtf_func(ctx, []byte(test.body))
+
+		if err != nil {
+			t.Fatalf("Failed to append EDTF ranges for test %d, %v", idx, err)
+		}
+
+		inception_status := gjson.GetBytes(new_body, "properties.date:inception_status").String()
+
+		if inception_status != test.inception_status {
+			t.Fatalf("Unexpected inception status for test %d, expected '%s' but got '%s'", idx, test.inception_status, inception_status)
+		}
+
+		cessation_status := gjson.GetBytes(new_body, "properties.date:cessation_status").String()
+
+		if cessation_status != test.cessation_status {
+			t.Fatalf("Unexpected cessation status for test %d, expected '%s' but got '%s'", idx, test.cessation_status, cessation_status)
+		}
+
+		cessation_rsp := gjson.GetBytes(new_body, "properties.date:cessation_outer_end")
+
+		if cessation_rsp.Exists() != test.expected_cessation_range {
+			t.Fatalf("Unexpected cessation range for test %d (%s)", idx, string(new_body))
+		}
+
+		if test.expected_cessation_range && cessation_rsp.Int() != test.cessation_outer_end {
+			t.Fatalf("Unexpected cessation outer end for test %d, expected %d but got %d", idx, test.cessation_outer_end, cessation_rsp.Int())
+		}
+
+		inception_rsp := gjson.GetBytes(new_body, "properties.date:inception_outer_start")
+
+		if test.inception_status == EDTF_STATUS_UNKNOWN_WIDEST || test.inception_status == EDTF_STATUS_OPEN_WIDEST {
+
+			if inception_rsp.Int() != DEFAULT_EDTF_EARLIEST.Unix() {
+				t.Fatalf("Unexpected inception outer start for test %d, %d", idx, inception_rsp.Int())
+			}
+		}
+	}
+}
+
+func TestAppendEDTFRangesDateRanges(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := &AppendEDTFRangesOptions{
+		OpenCessation: EDTF_OPEN_FUTURE,
+		DateRanges:    true,
+	}
+
+	edtf_func, err := NewAppendEDTFRangesFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create EDTF ranges func, %v", err)
+	}
+
+	body := `{"properties": {"edtf:inception": "1970-01-01", "edtf:cessation": ".." }}`
+
+	new_body, err := edtf_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append EDTF ranges, %v", err)
+	}
+
+	expected := []string{
+		"date:inception_inner_range",
+		"date:inception_outer_range",
+		"date:cessation_inner_range",
+		"date:cessation_outer_range",
+	}
+
+	for _, k := range expected {
+
+		path := fmt.Sprintf("properties.%s", k)
+
+		rsp := gjson.GetBytes(new_body, path)
+
+		if !rsp.Exists() || !rsp.Get("gte").Exists() || !rsp.Get("lte").Exists() {
+			t.Fatalf("Updated body missing or invalid %s property (%s)", path, string(new_body))
+		}
+	}
+
+	gte := gjson.GetBytes(new_body, "properties.date:existence_range.gte").Int()
+	lte := gjson.GetBytes(new_body, "properties.date:existence_range.lte").Int()
+
+	if gte != time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Fatalf("Unexpected existence range start, %d", gte)
+	}
+
+	if lte != DEFAULT_EDTF_LATEST.Unix() {
+		t.Fatalf("Unexpected existence range end, %d", lte)
+	}
+
+	// date_range properties are not assigned by default
+
+	new_body, err = AppendEDTFRanges(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append EDTF ranges, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "properties.date:existence_range").Exists() {
+		t.Fatalf("Unexpected existence range when date ranges are disabled")
+	}
+}
+
+func TestPrepareEDTF(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"properties": {"edtf:inception": "~1969", "edtf:cessation": "open" }}`
+
+	new_body, err := PrepareEDTF(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to prepare EDTF, %v", err)
+	}
+
+	expected := map[string]string{
+		"properties.edtf:cessation":         "..",
+		"properties.date:inception_year":    "1969",
+		"properties.date:inception_decade":  "1960s",
+		"properties.date:inception_century": "1900s",
+		"properties.date:cessation_status":  EDTF_STATUS_OPEN,
+	}
+
+	for path, v := range expected {
+
+		rsp := gjson.GetBytes(new_body, path)
+
+		if rsp.String() != v {
+			t.Fatalf("Unexpected value for %s, expected '%s' but got '%s'", path, v, rsp.String())
+		}
+	}
+
+	if gjson.GetBytes(new_body, "properties.date:cessation_year").Exists() {
+		t.Fatalf("Unexpected cessation year for open cessation date")
+	}
+
+	// Properties-only documents and parse failures
+
+	props := `{"edtf:inception": "not a date", "edtf:cessation": "1980-07-01"}`
+
+	report := NewReport()
+	report_ctx := WithReport(ctx, report)
+
+	new_body, err = PrepareEDTF(report_ctx, []byte(props))
+
+	if err != nil {
+		t.Fatalf("Failed to prepare EDTF for properties-only document, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "date:inception_status").String() != EDTF_STATUS_INVALID {
+		t.Fatalf("Expected invalid inception status (%s)", string(new_body))
+	}
+
+	parse_errors := gjson.GetBytes(new_body, "date:parse_errors").Array()
+
+	if len(parse_errors) != 1 || parse_errors[0].String() != "edtf:inception" {
+		t.Fatalf("Unexpected parse errors (%s)", string(new_body))
+	}
+
+	if gjson.GetBytes(new_body, "date:cessation_year").Int() != 1980 {
+		t.Fatalf("Unexpected cessation year (%s)", string(new_body))
+	}
+
+	if report.Count("edtf:parse_error") != 1 {
+		t.Fatalf("Expected parse error to be reported")
+	}
+}
@@ -0,0 +1,378 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"math"
+)
+
+// The code in this file is a minimal set of GeoJSON geometry primitives shared by the
+// geometry-related `PrepareDocumentFunc` functions in this package. It is not meant to
+// be a general purpose geometry library.
+
+// type point is a GeoJSON position. Positions have at least two ordinates (x, y); any additional ordinates
+// (for example Z values) are preserved but otherwise ignored.
+type point []float64
+
+// equals returns a boolean value indicating whether 'p' and 'other' have the same ordinates.
+func (p point) equals(other point) bool {
+
+	if len(p) != len(other) {
+		return false
+	}
+
+	for idx, v := range p {
+
+		if v != other[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withXY returns a copy of 'p' whose x and y ordinates have been replaced by 'x' and 'y'. Any additional ordinates are retained.
+func (p point) withXY(x float64, y float64) point {
+
+	new_pt := make(point, len(p))
+	copy(new_pt, p)
+
+	new_pt[0] = x
+	new_pt[1] = y
+
+	return new_pt
+}
+
+type ring []point
+
+type polygon []ring
+
+type geometry struct {
+	kind       string
+	points     []point
+	lines      [][]point
+	polygons   []polygon
+	geometries []*geometry
+}
+
+// parseGeometry parses a GeoJSON geometry in to a `geometry` instance.
+func parseGeometry(geom_rsp gjson.Result) (*geometry, error) {
+
+	type_rsp := geom_rsp.Get("type")
+
+	if !type_rsp.Exists() {
+		return nil, fmt.Errorf("Geometry is missing type property")
+	}
+
+	g := &geometry{
+		kind: type_rsp.String(),
+	}
+
+	if g.kind == "GeometryCollection" {
+
+		for _, child_rsp := range geom_rsp.Get("geometries").Array() {
+
+			child, err := parseGeometry(child_rsp)
+
+			if err != nil {
+				return nil, err
+			}
+
+			g.geometries = append(g.geometries, child)
+		}
+
+		return g, nil
+	}
+
+	coords_rsp := geom_rsp.Get("coordinates")
+
+	if !coords_rsp.Exists() {
+		return nil, fmt.Errorf("%s geometry is missing coordinates property", g.kind)
+	}
+
+	raw := []byte(coords_rsp.Raw)
+
+	var err error
+
+	switch g.kind {
+	case "Point":
+
+		var pt point
+		err = json.Unmarshal(raw, &pt)
+
+		g.points = []point{pt}
+
+	case "MultiPoint", "LineString":
+		err = json.Unmarshal(raw, &g.points)
+	case "MultiLineString":
+		err = json.Unmarshal(raw, &g.lines)
+	case "Polygon":
+
+		var poly polygon
+		err = json.Unmarshal(raw, &poly)
+
+		g.polygons = []polygon{poly}
+
+	case "MultiPolygon":
+		err = json.Unmarshal(raw, &g.polygons)
+	default:
+		return nil, fmt.Errorf("Unsupported geometry type '%s'", g.kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s coordinates, %w", g.kind, err)
+	}
+
+	err = g.validatePositions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s coordinates, %w", g.kind, err)
+	}
+
+	return g, nil
+}
+
+// validatePositions returns an error if any of the positions in 'g' has fewer than two ordinates.
+func (g *geometry) validatePositions() error {
+
+	check := func(pts []point) error {
+
+		for _, pt := range pts {
+
+			if len(pt) < 2 {
+				return fmt.Errorf("Position %v has fewer than two ordinates", []float64(pt))
+			}
+		}
+
+		return nil
+	}
+
+	err := check(g.points)
+
+	if err != nil {
+		return err
+	}
+
+	for _, l := range g.lines {
+
+		err := check(l)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, poly := range g.polygons {
+
+		for _, r := range poly {
+
+			err := check(r)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// value returns a JSON-serializable representation of 'g' suitable for assigning using `sjson.SetBytes`.
+// Polygon geometries with more than one polygon are returned as MultiPolygon geometries and MultiPolygon
+// geometries with a single polygon are returned as Polygon geometries.
+func (g *geometry) value() map[string]interface{} {
+
+	if g.kind == "GeometryCollection" {
+
+		geometries := make([]interface{}, len(g.geometries))
+
+		for idx, child := range g.geometries {
+			geometries[idx] = child.value()
+		}
+
+		return map[string]interface{}{
+			"type":       g.kind,
+			"geometries": geometries,
+		}
+	}
+
+	kind := g.kind
+	var coords interface{}
+
+	switch kind {
+	case "Point":
+		coords = g.points[0]
+	case "MultiPoint", "LineString":
+		coords = g.points
+	case "MultiLineString":
+		coords = g.lines
+	case "Polygon", "MultiPolygon":
+
+		if len(g.polygons) == 1 {
+			kind = "Polygon"
+			coords = g.polygons[0]
+		} else {
+			kind = "MultiPolygon"
+			coords = g.polygons
+		}
+	}
+
+	return map[string]interface{}{
+		"type":        kind,
+		"coordinates": coords,
+	}
+}
+
+// vertices returns the list of all the points in 'g'.
+func (g *geometry) vertices() []point {
+
+	vertices := make([]point, 0)
+
+	vertices = append(vertices, g.points...)
+
+	for _, line := range g.lines {
+		vertices = append(vertices, line...)
+	}
+
+	for _, poly := range g.polygons {
+		for _, r := range poly {
+			vertices = append(vertices, r...)
+		}
+	}
+
+	for _, child := range g.geometries {
+		vertices = append(vertices, child.vertices()...)
+	}
+
+	return vertices
+}
+
+// bbox returns the minimum x, minimum y, maximum x and maximum y values for 'g'.
+func (g *geometry) bbox() (float64, float64, float64, float64, bool) {
+
+	vertices := g.vertices()
+
+	if len(vertices) == 0 {
+		return 0, 0, 0, 0, false
+	}
+
+	min_x := math.Inf(1)
+	min_y := math.Inf(1)
+	max_x := math.Inf(-1)
+	max_y := math.Inf(-1)
+
+	for _, pt := range vertices {
+		min_x = math.Min(min_x, pt[0])
+		min_y = math.Min(min_y, pt[1])
+		max_x = math.Max(max_x, pt[0])
+		max_y = math.Max(max_y, pt[1])
+	}
+
+	return min_x, min_y, max_x, max_y, true
+}
+
+// signedArea returns the planar signed area of 'r' where counter-clockwise rings have a positive area.
+func (r ring) signedArea() float64 {
+
+	area := 0.0
+	count := len(r)
+
+	for i := 0; i < count-1; i++ {
+		area += (r[i][0] * r[i+1][1]) - (r[i+1][0] * r[i][1])
+	}
+
+	return area / 2.0
+}
+
+// reverse returns a copy of 'r' with its points in reverse order.
+func (r ring) reverse() ring {
+
+	count := len(r)
+	reversed := make(ring, count)
+
+	for idx, pt := range r {
+		reversed[count-1-idx] = pt
+	}
+
+	return reversed
+}
+
+// isClosed returns a boolean value indicating whether the first and last points of 'r' are the same.
+func (r ring) isClosed() bool {
+
+	if len(r) == 0 {
+		return false
+	}
+
+	return r[0].equals(r[len(r)-1])
+}
+
+// transform returns a copy of 'g' whose lists of points have been replaced by the output of 'fn'. The second
+// argument passed to 'fn' indicates whether the list of points is a (closed) polygon ring. If 'fn' returns a
+// polygon ring with fewer than four points, or a line with fewer than two points, the original list is retained.
+func (g *geometry) transform(fn func([]point, bool) []point) *geometry {
+
+	new_g := &geometry{
+		kind: g.kind,
+	}
+
+	switch g.kind {
+	case "Point", "MultiPoint":
+		new_g.points = fn(g.points, false)
+	case "LineString":
+
+		new_g.points = fn(g.points, false)
+
+		if len(new_g.points) < 2 {
+			new_g.points = g.points
+		}
+
+	case "MultiLineString":
+
+		new_g.lines = make([][]point, len(g.lines))
+
+		for idx, line := range g.lines {
+
+			new_line := fn(line, false)
+
+			if len(new_line) < 2 {
+				new_line = line
+			}
+
+			new_g.lines[idx] = new_line
+		}
+
+	case "Polygon", "MultiPolygon":
+
+		new_g.polygons = make([]polygon, len(g.polygons))
+
+		for i, poly := range g.polygons {
+
+			new_poly := make(polygon, len(poly))
+
+			for j, r := range poly {
+
+				new_r := ring(fn(r, true))
+
+				if len(new_r) < 4 {
+					new_r = r
+				}
+
+				new_poly[j] = new_r
+			}
+
+			new_g.polygons[i] = new_poly
+		}
+
+	case "GeometryCollection":
+
+		new_g.geometries = make([]*geometry, len(g.geometries))
+
+		for idx, child := range g.geometries {
+			new_g.geometries[idx] = child.transform(fn)
+		}
+	}
+
+	return new_g
+}
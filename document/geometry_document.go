@@ -0,0 +1,89 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strings"
+)
+
+// GEOMETRY_DOCUMENT_PROPERTIES is the list of properties retained by `PrepareGeometryDocument`.
+var GEOMETRY_DOCUMENT_PROPERTIES = []string{
+	"wof:id",
+	"wof:name",
+	"wof:placetype",
+	"wof:parent_id",
+	"wof:repo",
+	"wof:lastmodified",
+	"src:geom",
+	"src:alt_label",
+	"geom:bbox",
+}
+
+// PrepareGeometryDocument returns a GeoJSON Feature containing the geometry of a Who's On First document and only
+// the minimal set of properties needed to identify it (`GEOMETRY_DOCUMENT_PROPERTIES` and any `alt:` properties
+// assigned by `AppendAlternateGeometryProperties`). This is meant to be used to index geometries in a separate
+// ("companion") index from properties-only documents. Documents without a `geometry` property, including properties-only
+// documents, are assigned a null geometry.
+func PrepareGeometryDocument(ctx context.Context, body []byte) ([]byte, error) {
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if !props_rsp.Exists() {
+		props_rsp = gjson.ParseBytes(body)
+	}
+
+	if !props_rsp.IsObject() {
+		return nil, errors.New("Invalid document")
+	}
+
+	id_rsp := props_rsp.Get("wof:id")
+
+	if !id_rsp.Exists() {
+		return nil, errors.New("Missing wof:id property")
+	}
+
+	to_retain := make(map[string]bool)
+
+	for _, k := range GEOMETRY_DOCUMENT_PROPERTIES {
+		to_retain[k] = true
+	}
+
+	props := make(map[string]interface{})
+
+	props_rsp.ForEach(func(k gjson.Result, v gjson.Result) bool {
+
+		key := k.String()
+
+		if to_retain[key] || strings.HasPrefix(key, "alt:") {
+			props[key] = v.Value()
+		}
+
+		return true
+	})
+
+	var geom interface{}
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if geom_rsp.Exists() {
+		geom = json.RawMessage(geom_rsp.Raw)
+	}
+
+	f := map[string]interface{}{
+		"type":       "Feature",
+		"id":         id_rsp.Int(),
+		"properties": props,
+		"geometry":   geom,
+	}
+
+	enc_f, err := json.Marshal(f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal geometry document, %w", err)
+	}
+
+	return enc_f, nil
+}
@@ -0,0 +1,74 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestPrepareGeometryDocument(t *testing.T) {
+
+	ctx := context.Background()
+
+	geom := `{"type":"Polygon","coordinates":[[[0,0,10],[1,0,10],[1,1,10],[0,1,10],[0,0,10]]]}`
+
+	body := `{"type": "Feature", "properties": {"wof:id": 1234, "wof:name": "Null Island", "wof:placetype": "locality", "wof:parent_id": -1, "wof:repo": "whosonfirst-data-admin-xy", "wof:lastmodified": 1600000000, "src:geom": "quattroshapes", "src:alt_label": "quattroshapes", "geom:bbox": "0,0,1,1", "alt:parent_id": 1234, "alt:source": "quattroshapes", "name:eng_x_preferred": ["Null Island"], "wof:hierarchy": [], "geom:area": 1.0}, "geometry": ` + geom + `}`
+
+	new_body, err := PrepareGeometryDocument(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to prepare geometry document, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "type").String() != "Feature" || gjson.GetBytes(new_body, "id").Int() != 1234 {
+		t.Fatalf("Unexpected geometry document, %s", string(new_body))
+	}
+
+	if gjson.GetBytes(new_body, "geometry").Raw != geom {
+		t.Fatalf("Expected geometry to be unchanged, %s", gjson.GetBytes(new_body, "geometry").Raw)
+	}
+
+	expected := append([]string{"alt:parent_id", "alt:source"}, GEOMETRY_DOCUMENT_PROPERTIES...)
+
+	props := gjson.GetBytes(new_body, "properties").Map()
+
+	if len(props) != len(expected) {
+		t.Fatalf("Unexpected properties, %s", gjson.GetBytes(new_body, "properties").Raw)
+	}
+
+	for _, k := range expected {
+
+		if _, ok := props[k]; !ok {
+			t.Fatalf("Missing %s property, %s", k, gjson.GetBytes(new_body, "properties").Raw)
+		}
+	}
+}
+
+func TestPrepareGeometryDocumentPropertiesOnly(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"wof:id": 1234, "wof:name": "Null Island", "name:eng_x_preferred": ["Null Island"]}`
+
+	new_body, err := PrepareGeometryDocument(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to prepare geometry document for properties-only document, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "geometry").Type != gjson.Null {
+		t.Fatalf("Expected null geometry, %s", string(new_body))
+	}
+
+	props := gjson.GetBytes(new_body, "properties").Map()
+
+	if len(props) != 2 || props["wof:name"].String() != "Null Island" {
+		t.Fatalf("Unexpected properties, %s", gjson.GetBytes(new_body, "properties").Raw)
+	}
+
+	_, err = PrepareGeometryDocument(ctx, []byte(`{"wof:name": "Null Island"}`))
+
+	if err == nil {
+		t.Fatalf("Expected document without wof:id to fail")
+	}
+}
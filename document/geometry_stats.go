@@ -0,0 +1,224 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"math"
+)
+
+// EARTH_RADIUS is the mean radius of the Earth, in meters, used to calculate geodesic areas and distances.
+const EARTH_RADIUS float64 = 6371008.8
+
+const (
+	// COMPLEXITY_POINT is the complexity bucket for (multi) point geometries.
+	COMPLEXITY_POINT string = "point"
+	// COMPLEXITY_SIMPLE is the complexity bucket for geometries with fewer than 100 vertices.
+	COMPLEXITY_SIMPLE string = "simple"
+	// COMPLEXITY_MODERATE is the complexity bucket for geometries with fewer than 1,000 vertices.
+	COMPLEXITY_MODERATE string = "moderate"
+	// COMPLEXITY_COMPLEX is the complexity bucket for geometries with fewer than 10,000 vertices.
+	COMPLEXITY_COMPLEX string = "complex"
+	// COMPLEXITY_VERY_COMPLEX is the complexity bucket for geometries with 10,000 or more vertices.
+	COMPLEXITY_VERY_COMPLEX string = "very_complex"
+)
+
+// AppendGeometryStats appends statistics derived from the GeoJSON `geometry` property of a Who's On First document.
+// Specifically:
+// * The geometry type (`geom:type`)
+// * The geodesic area, in square meters, of polygons (`geom:area_geodesic`)
+// * The geodesic perimeter, in meters, of polygons (`geom:perimeter_geodesic`)
+// * The geodesic length, in meters, of lines (`geom:length_geodesic`)
+// * A complexity bucket derived from the number of vertices (`geom:complexity`)
+// * The number of polygons, rings, holes and vertices (`counts:geom_polygons`, `counts:geom_rings`, `counts:geom_holes`, `counts:geom_vertices`)
+// Documents without a `geometry` property are returned unchanged.
+func AppendGeometryStats(ctx context.Context, body []byte) ([]byte, error) {
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if !geom_rsp.Exists() || geom_rsp.Type == gjson.Null {
+		return body, nil
+	}
+
+	g, err := parseGeometry(geom_rsp)
+
+	if err != nil {
+		ReportFromContext(ctx).Increment("geometry_stats:error", 1)
+		return body, nil
+	}
+
+	count_polygons := 0
+	count_rings := 0
+	count_holes := 0
+
+	area := 0.0
+	perimeter := 0.0
+	length := 0.0
+
+	has_lines := false
+	has_points := false
+
+	var collect func(g *geometry)
+
+	collect = func(g *geometry) {
+
+		switch g.kind {
+		case "Point", "MultiPoint":
+			has_points = true
+		case "LineString":
+			has_lines = true
+			length += geodesicLength(g.points)
+		case "MultiLineString":
+
+			has_lines = true
+
+			for _, line := range g.lines {
+				length += geodesicLength(line)
+			}
+		}
+
+		for _, poly := range g.polygons {
+
+			count_polygons += 1
+
+			for idx, r := range poly {
+
+				count_rings += 1
+
+				ring_area := math.Abs(geodesicRingArea(r))
+
+				if idx == 0 {
+					area += ring_area
+				} else {
+					area -= ring_area
+					count_holes += 1
+				}
+
+				perimeter += geodesicLength(r)
+			}
+		}
+
+		for _, child := range g.geometries {
+			collect(child)
+		}
+	}
+
+	collect(g)
+
+	count_vertices := len(g.vertices())
+
+	complexity := COMPLEXITY_VERY_COMPLEX
+
+	switch {
+	case has_points && count_polygons == 0 && !has_lines:
+		complexity = COMPLEXITY_POINT
+	case count_vertices < 100:
+		complexity = COMPLEXITY_SIMPLE
+	case count_vertices < 1000:
+		complexity = COMPLEXITY_MODERATE
+	case count_vertices < 10000:
+		complexity = COMPLEXITY_COMPLEX
+	}
+
+	stats := map[string]interface{}{
+		"geom:type":            g.kind,
+		"geom:complexity":      complexity,
+		"counts:geom_polygons": count_polygons,
+		"counts:geom_rings":    count_rings,
+		"counts:geom_holes":    count_holes,
+		"counts:geom_vertices": count_vertices,
+	}
+
+	if count_polygons > 0 {
+		stats["geom:area_geodesic"] = math.Round(math.Max(area, 0.0))
+		stats["geom:perimeter_geodesic"] = math.Round(perimeter)
+	}
+
+	if has_lines {
+		stats["geom:length_geodesic"] = math.Round(length)
+	}
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	for k, v := range stats {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return body, nil
+}
+
+// geodesicRingArea returns the signed area, in square meters, of 'r' on a sphere. This is the algorithm described in
+// "Some Algorithms for Polygons on a Sphere" (Chamberlain and Duquette, JPL Publication 07-03) and used by Turf.js.
+func geodesicRingArea(r []point) float64 {
+
+	count := len(r)
+
+	if count < 3 {
+		return 0.0
+	}
+
+	area := 0.0
+
+	for i := 0; i < count; i++ {
+
+		var lower, middle, upper int
+
+		switch i {
+		case count - 2:
+			lower, middle, upper = count-2, count-1, 0
+		case count - 1:
+			lower, middle, upper = count-1, 0, 1
+		default:
+			lower, middle, upper = i, i+1, i+2
+		}
+
+		p1 := r[lower]
+		p2 := r[middle]
+		p3 := r[upper]
+
+		area += (radians(p3[0]) - radians(p1[0])) * math.Sin(radians(p2[1]))
+	}
+
+	return area * EARTH_RADIUS * EARTH_RADIUS / 2.0
+}
+
+// geodesicLength returns the length, in meters, of the line defined by 'points' using the haversine formula.
+func geodesicLength(points []point) float64 {
+
+	length := 0.0
+
+	for i := 1; i < len(points); i++ {
+		length += haversine(points[i-1], points[i])
+	}
+
+	return length
+}
+
+func haversine(a point, b point) float64 {
+
+	lat1 := radians(a[1])
+	lat2 := radians(b[1])
+
+	dlat := lat2 - lat1
+	dlon := radians(b[0] - a[0])
+
+	h := math.Pow(math.Sin(dlat/2.0), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dlon/2.0), 2)
+
+	return 2.0 * EARTH_RADIUS * math.Asin(math.Min(1.0, math.Sqrt(h)))
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180.0
+}
@@ -0,0 +1,207 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"math"
+	"testing"
+)
+
+func TestAppendGeometryStats(t *testing.T) {
+
+	ctx := context.Background()
+
+	// A 1 x 1 degree cell at the equator is 12,363.72 km2 with a perimeter of 444,763 meters
+
+	cell := `{"properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,1],[0,0]]]}}`
+
+	body, err := AppendGeometryStats(ctx, []byte(cell))
+
+	if err != nil {
+		t.Fatalf("Failed to append geometry stats, %v", err)
+	}
+
+	area := gjson.GetBytes(body, "properties.geom:area_geodesic").Float() / 1000000.0
+
+	if math.Abs(area-12363.72) > 12363.72*0.001 {
+		t.Fatalf("Unexpected area for equatorial cell: %f km2", area)
+	}
+
+	perimeter := gjson.GetBytes(body, "properties.geom:perimeter_geodesic").Float()
+
+	if math.Abs(perimeter-444763.0) > 444763.0*0.001 {
+		t.Fatalf("Unexpected perimeter for equatorial cell: %f m", perimeter)
+	}
+
+	expected := map[string]interface{}{
+		"geom:type":            "Polygon",
+		"geom:complexity":      COMPLEXITY_SIMPLE,
+		"counts:geom_polygons": int64(1),
+		"counts:geom_rings":    int64(1),
+		"counts:geom_holes":    int64(0),
+		"counts:geom_vertices": int64(5),
+	}
+
+	checkGeometryStats(t, "cell", body, expected)
+
+	// Polygon with a hole (the inner ring is a quarter of the outer ring)
+
+	donut := `{"properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,1],[0,0]],[[0.25,0.25],[0.25,0.75],[0.75,0.75],[0.75,0.25],[0.25,0.25]]]}}`
+
+	body, err = AppendGeometryStats(ctx, []byte(donut))
+
+	if err != nil {
+		t.Fatalf("Failed to append geometry stats for polygon with hole, %v", err)
+	}
+
+	donut_area := gjson.GetBytes(body, "properties.geom:area_geodesic").Float() / 1000000.0
+
+	if math.Abs(donut_area-(12363.72*0.75)) > 12363.72*0.001 {
+		t.Fatalf("Unexpected area for polygon with hole: %f km2", donut_area)
+	}
+
+	donut_perimeter := gjson.GetBytes(body, "properties.geom:perimeter_geodesic").Float()
+
+	if donut_perimeter <= perimeter*1.4 || donut_perimeter >= perimeter*1.6 {
+		t.Fatalf("Expected perimeter for polygon with hole to include inner ring: %f m", donut_perimeter)
+	}
+
+	checkGeometryStats(t, "donut", body, map[string]interface{}{
+		"counts:geom_polygons": int64(1),
+		"counts:geom_rings":    int64(2),
+		"counts:geom_holes":    int64(1),
+		"counts:geom_vertices": int64(10),
+	})
+
+	// MultiPolygon with two cells, one of which is at 60 degrees north
+
+	multi := `{"properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [[[[0,0],[1,0],[1,1],[0,1],[0,0]]],[[[0,60],[1,60],[1,61],[0,61],[0,60]]]]}}`
+
+	body, err = AppendGeometryStats(ctx, []byte(multi))
+
+	if err != nil {
+		t.Fatalf("Failed to append geometry stats for multipolygon, %v", err)
+	}
+
+	multi_area := gjson.GetBytes(body, "properties.geom:area_geodesic").Float() / 1000000.0
+
+	// The area of a 1 x 1 degree cell between 60 and 61 degrees north is R^2 * (1 degree in radians) * (sin(61) - sin(60))
+
+	north_area := math.Pow(EARTH_RADIUS/1000.0, 2) * radians(1) * (math.Sin(radians(61)) - math.Sin(radians(60)))
+
+	if math.Abs(multi_area-(12363.72+north_area)) > 12363.72*0.002 {
+		t.Fatalf("Unexpected area for multipolygon: %f km2 (expected %f)", multi_area, 12363.72+north_area)
+	}
+
+	checkGeometryStats(t, "multipolygon", body, map[string]interface{}{
+		"geom:type":            "MultiPolygon",
+		"counts:geom_polygons": int64(2),
+		"counts:geom_rings":    int64(2),
+		"counts:geom_holes":    int64(0),
+		"counts:geom_vertices": int64(10),
+	})
+
+	// Point
+
+	pt := `{"properties": {}, "geometry": {"type": "Point", "coordinates": [-122.4194, 37.7749]}}`
+
+	body, err = AppendGeometryStats(ctx, []byte(pt))
+
+	if err != nil {
+		t.Fatalf("Failed to append geometry stats for point, %v", err)
+	}
+
+	checkGeometryStats(t, "point", body, map[string]interface{}{
+		"geom:type":            "Point",
+		"geom:complexity":      COMPLEXITY_POINT,
+		"counts:geom_polygons": int64(0),
+		"counts:geom_vertices": int64(1),
+	})
+
+	for _, k := range []string{"geom:area_geodesic", "geom:perimeter_geodesic", "geom:length_geodesic"} {
+
+		if gjson.GetBytes(body, "properties."+k).Exists() {
+			t.Fatalf("Unexpected %s property for point", k)
+		}
+	}
+
+	// LineString along the equator
+
+	line := `{"properties": {}, "geometry": {"type": "LineString", "coordinates": [[0,0],[1,0]]}}`
+
+	body, err = AppendGeometryStats(ctx, []byte(line))
+
+	if err != nil {
+		t.Fatalf("Failed to append geometry stats for line, %v", err)
+	}
+
+	length := gjson.GetBytes(body, "properties.geom:length_geodesic").Float()
+
+	if math.Abs(length-111195.0) > 111195.0*0.001 {
+		t.Fatalf("Unexpected length for line: %f m", length)
+	}
+}
+
+func TestAppendGeometryStatsWithoutGeometry(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := []byte(`{"wof:id": 1234}`)
+
+	new_body, err := AppendGeometryStats(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to append geometry stats, %v", err)
+	}
+
+	if string(new_body) != string(body) {
+		t.Fatalf("Expected document without geometry to be unchanged")
+	}
+}
+
+func TestPrepareSpelunkerV1DocumentGeometryStats(t *testing.T) {
+
+	ctx := context.Background()
+
+	cell := `{"type": "Feature", "properties": {"wof:id": 1234, "wof:name": "Null Island", "wof:placetype": "locality"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,1],[0,0]]]}}`
+
+	body, err := PrepareSpelunkerV1Document(ctx, []byte(cell))
+
+	if err != nil {
+		t.Fatalf("Failed to prepare Spelunker v1 document, %v", err)
+	}
+
+	if gjson.GetBytes(body, "geometry").Exists() || gjson.GetBytes(body, "properties").Exists() {
+		t.Fatalf("Expected properties-only document")
+	}
+
+	if gjson.GetBytes(body, "geom:area_geodesic").Float() <= 0 {
+		t.Fatalf("Expected geometry stats to be derived before properties are extracted")
+	}
+}
+
+func checkGeometryStats(t *testing.T, label string, body []byte, expected map[string]interface{}) {
+
+	for k, v := range expected {
+
+		rsp := gjson.GetBytes(body, "properties."+k)
+
+		if !rsp.Exists() {
+			t.Fatalf("Missing %s property for %s", k, label)
+		}
+
+		switch v.(type) {
+		case int64:
+
+			if rsp.Int() != v.(int64) {
+				t.Fatalf("Unexpected %s value for %s: %d (expected %d)", k, label, rsp.Int(), v.(int64))
+			}
+
+		default:
+
+			if rsp.String() != v.(string) {
+				t.Fatalf("Unexpected %s value for %s: %s (expected %s)", k, label, rsp.String(), v.(string))
+			}
+		}
+	}
+}
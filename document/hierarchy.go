@@ -0,0 +1,172 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-placetypes"
+	"sort"
+	"strings"
+)
+
+const (
+	// BELONGSTO_DERIVED indicates that a document's `wof:belongsto` property was missing and has been derived from its hierarchies.
+	BELONGSTO_DERIVED string = "derived"
+	// BELONGSTO_CONSISTENT indicates that a document's `wof:belongsto` property matches the IDs in its hierarchies.
+	BELONGSTO_CONSISTENT string = "consistent"
+	// BELONGSTO_INCONSISTENT indicates that a document's `wof:belongsto` property does not match the IDs in its hierarchies.
+	BELONGSTO_INCONSISTENT string = "inconsistent"
+)
+
+// AppendHierarchyIds appends properties derived from the union of the ancestor IDs in all the `wof:hierarchy` entries
+// of a Who's On First document. Specifically:
+// * The unique set of ancestor IDs (`hierarchy:belongsto`). The document's own ID is excluded.
+// * The unique set of ancestor IDs for each placetype (for example `hierarchy:region_id`). Only placetypes defined by
+// the `whosonfirst/go-whosonfirst-placetypes` package are included; other keys are counted in the `hierarchy:unknown_placetype`
+// key of the `Report` associated with the context, if present.
+// * How the derived IDs compare to the `wof:belongsto` property (`hierarchy:belongsto_status`). If the `wof:belongsto`
+// property is missing it is assigned the derived IDs and the status is `BELONGSTO_DERIVED`. Otherwise the status is either
+// `BELONGSTO_CONSISTENT` or `BELONGSTO_INCONSISTENT`; inconsistent `wof:belongsto` properties are not updated.
+// Documents without a `wof:hierarchy` property are returned unchanged.
+func AppendHierarchyIds(ctx context.Context, body []byte) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	hierarchy_rsp := root.Get("wof:hierarchy")
+
+	if !hierarchy_rsp.Exists() {
+		return body, nil
+	}
+
+	report := ReportFromContext(ctx)
+
+	wof_id := root.Get("wof:id").Int()
+
+	derived := make(map[int64]bool)
+	by_placetype := make(map[string]map[int64]bool)
+
+	for _, h := range hierarchy_rsp.Array() {
+
+		for k, v := range h.Map() {
+
+			if !strings.HasSuffix(k, "_id") {
+				continue
+			}
+
+			id := v.Int()
+
+			if id <= 0 || id == wof_id {
+				continue
+			}
+
+			derived[id] = true
+
+			pt := strings.TrimSuffix(k, "_id")
+
+			if !placetypes.IsValidPlacetype(pt) {
+				report.Increment("hierarchy:unknown_placetype", 1)
+				continue
+			}
+
+			_, ok := by_placetype[pt]
+
+			if !ok {
+				by_placetype[pt] = make(map[int64]bool)
+			}
+
+			by_placetype[pt][id] = true
+		}
+	}
+
+	sorted := func(m map[int64]bool) []int64 {
+
+		ids := make([]int64, 0, len(m))
+
+		for id, _ := range m {
+			ids = append(ids, id)
+		}
+
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+
+		return ids
+	}
+
+	derived_ids := sorted(derived)
+
+	to_assign := map[string]interface{}{
+		"hierarchy:belongsto": derived_ids,
+	}
+
+	for pt, ids := range by_placetype {
+		to_assign[fmt.Sprintf("hierarchy:%s_id", pt)] = sorted(ids)
+	}
+
+	status := BELONGSTO_CONSISTENT
+
+	belongsto_rsp := root.Get("wof:belongsto")
+
+	if !belongsto_rsp.Exists() {
+
+		status = BELONGSTO_DERIVED
+		to_assign["wof:belongsto"] = derived_ids
+
+	} else {
+
+		stored := make(map[int64]bool)
+
+		for _, v := range belongsto_rsp.Array() {
+
+			id := v.Int()
+
+			if id <= 0 || id == wof_id {
+				continue
+			}
+
+			stored[id] = true
+		}
+
+		if len(stored) != len(derived) {
+			status = BELONGSTO_INCONSISTENT
+		} else {
+
+			for id, _ := range derived {
+
+				if !stored[id] {
+					status = BELONGSTO_INCONSISTENT
+					break
+				}
+			}
+		}
+	}
+
+	report.Increment(fmt.Sprintf("hierarchy:belongsto_%s", status), 1)
+	to_assign["hierarchy:belongsto_status"] = status
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,192 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"sort"
+	"strings"
+)
+
+// DEFAULT_LABEL_PLACETYPES is the default list of ancestor placetypes, ordered from most to least specific, used to
+// derive a display label for a Who's On First record.
+var DEFAULT_LABEL_PLACETYPES = []string{
+	"microhood",
+	"neighbourhood",
+	"macrohood",
+	"borough",
+	"locality",
+	"region",
+	"country",
+}
+
+// type AppendHierarchyNamesOptions defines configuration options for appending the names of ancestors to a Who's On First document.
+type AppendHierarchyNamesOptions struct {
+	// Reader is the `HierarchyReader` instance used to resolve ancestor IDs. Consider wrapping it in a `CachedHierarchyReader`.
+	Reader HierarchyReader
+	// LabelPlacetypes is the ordered list of ancestor placetypes used to derive a display label. Default is `DEFAULT_LABEL_PLACETYPES`.
+	LabelPlacetypes []string
+}
+
+// NewAppendHierarchyNamesFunc returns a `PrepareDocumentFunc` that appends the names of the ancestors listed in the
+// `wof:hierarchy` property of a Who's On First document, resolved using `opts.Reader`. Specifically:
+// * The unique set of ancestor names from all hierarchies (`wof:hierarchy_names`)
+// * The name of each ancestor, by placetype, in the first hierarchy (for example `hierarchy:locality_name`)
+// * A display label composed of the document's name followed by the names of the ancestors in `opts.LabelPlacetypes`
+// found in the first hierarchy (`hierarchy:label`), for example "Mission District, San Francisco, California, United States"
+// Ancestors that can not be found (`ErrHierarchyRecordNotFound`) are counted in the `hierarchy_names:missing` key of the
+// `Report` associated with the context, if present, and skipped. Any other error reading an ancestor is returned.
+func NewAppendHierarchyNamesFunc(ctx context.Context, opts *AppendHierarchyNamesOptions) (PrepareDocumentFunc, error) {
+
+	if opts.Reader == nil {
+		return nil, errors.New("Missing hierarchy reader")
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendHierarchyNames(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendHierarchyNames(ctx context.Context, body []byte, opts *AppendHierarchyNamesOptions) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	hierarchies := root.Get("wof:hierarchy").Array()
+
+	if len(hierarchies) == 0 {
+		return body, nil
+	}
+
+	label_placetypes := opts.LabelPlacetypes
+
+	if len(label_placetypes) == 0 {
+		label_placetypes = DEFAULT_LABEL_PLACETYPES
+	}
+
+	report := ReportFromContext(ctx)
+
+	wof_id := root.Get("wof:id").Int()
+
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	first := make(map[string]string)
+
+	for idx, h := range hierarchies {
+
+		h_map := h.Map()
+
+		keys := make([]string, 0, len(h_map))
+
+		for k, _ := range h_map {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+
+			if !strings.HasSuffix(k, "_id") {
+				continue
+			}
+
+			id := h_map[k].Int()
+
+			if id <= 0 || id == wof_id {
+				continue
+			}
+
+			rec, err := opts.Reader.ReadHierarchyRecord(ctx, id)
+
+			if err != nil {
+
+				if errors.Is(err, ErrHierarchyRecordNotFound) {
+					report.Increment("hierarchy_names:missing", 1)
+					continue
+				}
+
+				return nil, fmt.Errorf("Failed to read hierarchy record %d, %w", id, err)
+			}
+
+			if rec.Name == "" {
+				continue
+			}
+
+			if !seen[rec.Name] {
+				names = append(names, rec.Name)
+				seen[rec.Name] = true
+			}
+
+			if idx == 0 {
+				pt := strings.TrimSuffix(k, "_id")
+				first[pt] = rec.Name
+			}
+		}
+	}
+
+	to_assign := map[string]interface{}{
+		"wof:hierarchy_names": names,
+	}
+
+	for pt, name := range first {
+		to_assign[fmt.Sprintf("hierarchy:%s_name", pt)] = name
+	}
+
+	label := make([]string, 0)
+
+	name := root.Get("wof:name").String()
+
+	if name != "" {
+		label = append(label, name)
+	}
+
+	for _, pt := range label_placetypes {
+
+		ancestor_name, ok := first[pt]
+
+		if !ok {
+			continue
+		}
+
+		// Don't repeat names (for example a locality and a region that share the same name)
+
+		if len(label) > 0 && label[len(label)-1] == ancestor_name {
+			continue
+		}
+
+		label = append(label, ancestor_name)
+	}
+
+	if len(label) > 0 {
+		to_assign["hierarchy:label"] = strings.Join(label, ", ")
+	}
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
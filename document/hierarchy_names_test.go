@@ -0,0 +1,114 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"github.com/tidwall/gjson"
+	"strings"
+	"testing"
+)
+
+func TestAppendHierarchyNames(t *testing.T) {
+
+	ctx := context.Background()
+
+	lookup := strings.Join([]string{
+		`{"wof:id": 85922583, "wof:name": "San Francisco", "wof:placetype": "locality"}`,
+		`{"wof:id": 85688637, "wof:name": "California", "wof:placetype": "region"}`,
+		`{"type": "Feature", "properties": {"wof:id": 85633793, "wof:name": "United States", "wof:placetype": "country"}}`,
+	}, "\n")
+
+	lookup_r, err := NewLookupHierarchyReaderWithReader(ctx, strings.NewReader(lookup))
+
+	if err != nil {
+		t.Fatalf("Failed to create lookup reader, %v", err)
+	}
+
+	r, err := NewCachedHierarchyReader(ctx, lookup_r)
+
+	if err != nil {
+		t.Fatalf("Failed to create cached reader, %v", err)
+	}
+
+	opts := &AppendHierarchyNamesOptions{
+		Reader: r,
+	}
+
+	names_func, err := NewAppendHierarchyNamesFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create hierarchy names func, %v", err)
+	}
+
+	body := `{"properties": {"wof:id": 1108830809, "wof:name": "Mission District", "wof:hierarchy": [{"neighbourhood_id": 1108830809, "locality_id": 85922583, "region_id": 85688637, "country_id": 85633793, "county_id": 102087579}]}}`
+
+	report := NewReport()
+
+	new_body, err := names_func(WithReport(ctx, report), []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append hierarchy names, %v", err)
+	}
+
+	expected := map[string]string{
+		"properties.hierarchy:label":         "Mission District, San Francisco, California, United States",
+		"properties.hierarchy:locality_name": "San Francisco",
+		"properties.hierarchy:country_name":  "United States",
+	}
+
+	for path, v := range expected {
+
+		rsp := gjson.GetBytes(new_body, path)
+
+		if rsp.String() != v {
+			t.Fatalf("Unexpected value for %s, expected '%s' but got '%s'", path, v, rsp.String())
+		}
+	}
+
+	names := gjson.GetBytes(new_body, "properties.wof:hierarchy_names").Array()
+
+	if len(names) != 3 {
+		t.Fatalf("Unexpected number of hierarchy names, %d", len(names))
+	}
+
+	if report.Count("hierarchy_names:missing") != 1 {
+		t.Fatalf("Expected missing county to be reported")
+	}
+}
+
+type brokenHierarchyReader struct {
+	HierarchyReader
+}
+
+func (r *brokenHierarchyReader) ReadHierarchyRecord(ctx context.Context, id int64) (*HierarchyRecord, error) {
+	return nil, errors.New("Failed to parse record")
+}
+
+func TestAppendHierarchyNamesReaderError(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := &AppendHierarchyNamesOptions{
+		Reader: &brokenHierarchyReader{},
+	}
+
+	names_func, err := NewAppendHierarchyNamesFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create hierarchy names func, %v", err)
+	}
+
+	body := `{"wof:id": 1108830809, "wof:name": "Mission District", "wof:hierarchy": [{"locality_id": 85922583}]}`
+
+	report := NewReport()
+
+	_, err = names_func(WithReport(ctx, report), []byte(body))
+
+	if err == nil {
+		t.Fatalf("Expected reader error to be returned")
+	}
+
+	if report.Count("hierarchy_names:missing") != 0 {
+		t.Fatalf("Reader error was counted as a missing record")
+	}
+}
@@ -0,0 +1,240 @@
+package document
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrHierarchyRecordNotFound is returned by `HierarchyReader` implementations when a record can not be found.
+var ErrHierarchyRecordNotFound = errors.New("Hierarchy record not found")
+
+// type HierarchyRecord contains the details about a Who's On First record needed to enrich the hierarchies of other records.
+type HierarchyRecord struct {
+	// Id is the record's unique Who's On First ID
+	Id int64
+	// Name is the record's `wof:name` property
+	Name string
+	// Placetype is the record's `wof:placetype` property
+	Placetype string
+}
+
+// type HierarchyReader is an interface for resolving Who's On First IDs to `HierarchyRecord` instances.
+type HierarchyReader interface {
+	// ReadHierarchyRecord returns the `HierarchyRecord` for 'id' or `ErrHierarchyRecordNotFound` if it can not be found.
+	ReadHierarchyRecord(context.Context, int64) (*HierarchyRecord, error)
+}
+
+// hierarchyRecordFromBytes returns a `HierarchyRecord` derived from 'body' which may be either a GeoJSON Feature
+// or a properties-only document.
+func hierarchyRecordFromBytes(body []byte) (*HierarchyRecord, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	id_rsp := root.Get("wof:id")
+
+	if !id_rsp.Exists() {
+		return nil, errors.New("Missing wof:id property")
+	}
+
+	r := &HierarchyRecord{
+		Id:        id_rsp.Int(),
+		Name:      root.Get("wof:name").String(),
+		Placetype: root.Get("wof:placetype").String(),
+	}
+
+	return r, nil
+}
+
+// type LocalHierarchyReader implements the `HierarchyReader` interface for Who's On First records stored in a local
+// (Who's On First style) data directory.
+type LocalHierarchyReader struct {
+	HierarchyReader
+	root string
+}
+
+// NewLocalHierarchyReader returns a new `LocalHierarchyReader` instance for records stored in 'root', which is
+// expected to be the "data" directory of a Who's On First repository.
+func NewLocalHierarchyReader(ctx context.Context, root string) (HierarchyReader, error) {
+
+	info, err := os.Stat(root)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat %s, %w", root, err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	r := &LocalHierarchyReader{
+		root: root,
+	}
+
+	return r, nil
+}
+
+// ReadHierarchyRecord returns the `HierarchyRecord` for 'id'.
+func (r *LocalHierarchyReader) ReadHierarchyRecord(ctx context.Context, id int64) (*HierarchyRecord, error) {
+
+	path, err := uri.Id2AbsPath(r.root, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive path for %d, %w", id, err)
+	}
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+
+		if os.IsNotExist(err) {
+			return nil, ErrHierarchyRecordNotFound
+		}
+
+		return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	return hierarchyRecordFromBytes(body)
+}
+
+// type LookupHierarchyReader implements the `HierarchyReader` interface for Who's On First records loaded, in to memory,
+// from a lookup file.
+type LookupHierarchyReader struct {
+	HierarchyReader
+	lookup map[int64]*HierarchyRecord
+}
+
+// NewLookupHierarchyReader returns a new `LookupHierarchyReader` instance for the records in 'path'. 'path' is expected
+// to contain one JSON document per line. Each line may be a complete GeoJSON Feature (for example the output of a
+// `geojsonl` export) or a JSON dictionary containing `wof:id`, `wof:name` and `wof:placetype` properties.
+func NewLookupHierarchyReader(ctx context.Context, path string) (HierarchyReader, error) {
+
+	fh, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	defer fh.Close()
+
+	return NewLookupHierarchyReaderWithReader(ctx, fh)
+}
+
+// NewLookupHierarchyReaderWithReader returns a new `LookupHierarchyReader` instance for the records in 'r'. See
+// `NewLookupHierarchyReader` for details.
+func NewLookupHierarchyReaderWithReader(ctx context.Context, r io.Reader) (HierarchyReader, error) {
+
+	lookup := make(map[int64]*HierarchyRecord)
+
+	scanner := bufio.NewScanner(r)
+
+	// Allow for (large) GeoJSON Features
+
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+
+	lineno := 0
+
+	for scanner.Scan() {
+
+		lineno += 1
+
+		body := scanner.Bytes()
+
+		if len(body) == 0 {
+			continue
+		}
+
+		rec, err := hierarchyRecordFromBytes(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse line %d, %w", lineno, err)
+		}
+
+		lookup[rec.Id] = rec
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read lookup, %w", err)
+	}
+
+	hr := &LookupHierarchyReader{
+		lookup: lookup,
+	}
+
+	return hr, nil
+}
+
+// ReadHierarchyRecord returns the `HierarchyRecord` for 'id'.
+func (r *LookupHierarchyReader) ReadHierarchyRecord(ctx context.Context, id int64) (*HierarchyRecord, error) {
+
+	rec, ok := r.lookup[id]
+
+	if !ok {
+		return nil, ErrHierarchyRecordNotFound
+	}
+
+	return rec, nil
+}
+
+// type CachedHierarchyReader implements the `HierarchyReader` interface caching the results of another `HierarchyReader`
+// instance in memory.
+type CachedHierarchyReader struct {
+	HierarchyReader
+	reader HierarchyReader
+	cache  *sync.Map
+}
+
+// NewCachedHierarchyReader returns a new `CachedHierarchyReader` instance caching the results of 'r'. Records that
+// can not be found are cached too.
+func NewCachedHierarchyReader(ctx context.Context, r HierarchyReader) (HierarchyReader, error) {
+
+	cr := &CachedHierarchyReader{
+		reader: r,
+		cache:  new(sync.Map),
+	}
+
+	return cr, nil
+}
+
+// ReadHierarchyRecord returns the `HierarchyRecord` for 'id'.
+func (r *CachedHierarchyReader) ReadHierarchyRecord(ctx context.Context, id int64) (*HierarchyRecord, error) {
+
+	v, ok := r.cache.Load(id)
+
+	if ok {
+
+		if v == nil {
+			return nil, ErrHierarchyRecordNotFound
+		}
+
+		return v.(*HierarchyRecord), nil
+	}
+
+	rec, err := r.reader.ReadHierarchyRecord(ctx, id)
+
+	if err != nil {
+
+		if errors.Is(err, ErrHierarchyRecordNotFound) {
+			r.cache.Store(id, nil)
+		}
+
+		return nil, err
+	}
+
+	r.cache.Store(id, rec)
+	return rec, nil
+}
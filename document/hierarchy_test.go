@@ -0,0 +1,49 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendHierarchyIds(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := map[string]string{
+		`{"properties": {"wof:id": 1, "wof:hierarchy": [{"region_id": 10, "country_id": 100, "venue_id": 1}, {"region_id": 11, "country_id": 100}]}}`:                  BELONGSTO_DERIVED,
+		`{"properties": {"wof:id": 1, "wof:belongsto": [100, 11, 10], "wof:hierarchy": [{"region_id": 10, "country_id": 100}, {"region_id": 11, "country_id": 100}]}}`: BELONGSTO_CONSISTENT,
+		`{"properties": {"wof:id": 1, "wof:belongsto": [100, 10], "wof:hierarchy": [{"region_id": 10, "country_id": 100}, {"region_id": 11, "country_id": 100}]}}`:     BELONGSTO_INCONSISTENT,
+	}
+
+	for body, status := range tests {
+
+		new_body, err := AppendHierarchyIds(ctx, []byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to append hierarchy IDs, %v", err)
+		}
+
+		rsp := gjson.GetBytes(new_body, "properties.hierarchy:belongsto_status")
+
+		if rsp.String() != status {
+			t.Fatalf("Unexpected status, expected '%s' but got '%s' (%s)", status, rsp.String(), body)
+		}
+
+		region_ids := gjson.GetBytes(new_body, "properties.hierarchy:region_id").Array()
+
+		if len(region_ids) != 2 || region_ids[0].Int() != 10 || region_ids[1].Int() != 11 {
+			t.Fatalf("Unexpected region IDs, %s", string(new_body))
+		}
+
+		belongsto := gjson.GetBytes(new_body, "properties.wof:belongsto").Array()
+
+		if status == BELONGSTO_DERIVED && len(belongsto) != 3 {
+			t.Fatalf("Expected wof:belongsto to be derived, %s", string(new_body))
+		}
+
+		if status == BELONGSTO_INCONSISTENT && len(belongsto) != 2 {
+			t.Fatalf("Expected inconsistent wof:belongsto to be left unchanged, %s", string(new_body))
+		}
+	}
+}
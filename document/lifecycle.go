@@ -0,0 +1,136 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	// LIFECYCLE_CURRENT is the lifecycle status of records that are explicitly flagged as current.
+	LIFECYCLE_CURRENT string = "current"
+	// LIFECYCLE_NOT_CURRENT is the lifecycle status of records that are explicitly flagged as not current.
+	LIFECYCLE_NOT_CURRENT string = "not_current"
+	// LIFECYCLE_DEPRECATED is the lifecycle status of records that have been deprecated.
+	LIFECYCLE_DEPRECATED string = "deprecated"
+	// LIFECYCLE_SUPERSEDED is the lifecycle status of records that have been superseded by other records.
+	LIFECYCLE_SUPERSEDED string = "superseded"
+	// LIFECYCLE_CEASED is the lifecycle status of records that have ceased.
+	LIFECYCLE_CEASED string = "ceased"
+	// LIFECYCLE_UNKNOWN is the lifecycle status of records whose status can not be determined.
+	LIFECYCLE_UNKNOWN string = "unknown"
+)
+
+// AppendLifecycleProperties appends normalized lifecycle properties to a Who's On First document. Specifically:
+// * `is_deprecated` is true if the `edtf:deprecated` property is present and is not an unknown ("" or "uuuu") EDTF value.
+// * `is_superseded` is true if the `wof:superseded_by` property contains one or more IDs.
+// * `is_superseding` is true if the `wof:supersedes` property contains one or more IDs.
+// * `is_ceased` is true if the `edtf:cessation` property is present and is not an open ("..", "open") or unknown EDTF value.
+// * `lifecycle:status` is the first of the following rules to apply: `LIFECYCLE_DEPRECATED` if `is_deprecated` is true,
+// `LIFECYCLE_SUPERSEDED` if `is_superseded` is true, `LIFECYCLE_CEASED` if `is_ceased` is true, `LIFECYCLE_NOT_CURRENT` if
+// `mz:is_current` is 0, `LIFECYCLE_CURRENT` if `mz:is_current` is 1 and `LIFECYCLE_UNKNOWN` otherwise.
+// * `is_current` is true if `lifecycle:status` is `LIFECYCLE_CURRENT`.
+// Note that a record may both supersede, and be superseded by, other records and that a record explicitly flagged
+// as current (`mz:is_current=1`) which has been deprecated, superseded or ceased is not considered current.
+func AppendLifecycleProperties(ctx context.Context, body []byte) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	lc := deriveLifecycle(root)
+
+	to_assign := map[string]interface{}{
+		"is_current":       lc.Status == LIFECYCLE_CURRENT,
+		"is_deprecated":    lc.IsDeprecated,
+		"is_ceased":        lc.IsCeased,
+		"is_superseded":    lc.IsSuperseded,
+		"is_superseding":   lc.IsSuperseding,
+		"lifecycle:status": lc.Status,
+	}
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+// type lifecycle contains the lifecycle details derived from the properties of a Who's On First record.
+type lifecycle struct {
+	IsDeprecated  bool
+	IsCeased      bool
+	IsSuperseded  bool
+	IsSuperseding bool
+	// Status is one of the LIFECYCLE_* constants
+	Status string
+}
+
+// deriveLifecycle returns the lifecycle details for 'props', the properties of a Who's On First record. See
+// `AppendLifecycleProperties` for details.
+func deriveLifecycle(props gjson.Result) *lifecycle {
+
+	lc := &lifecycle{
+		Status: LIFECYCLE_UNKNOWN,
+	}
+
+	deprecated_rsp := props.Get("edtf:deprecated")
+
+	if deprecated_rsp.Exists() {
+
+		deprecated_str := deprecated_rsp.String()
+
+		if !isUnknown(deprecated_str) && !isUnspecified(deprecated_str) {
+			lc.IsDeprecated = true
+		}
+	}
+
+	cessation_rsp := props.Get("edtf:cessation")
+
+	if cessation_rsp.Exists() {
+
+		cessation_str := cessation_rsp.String()
+
+		if !isOpen(cessation_str) && !isUnknown(cessation_str) && !isUnspecified(cessation_str) {
+			lc.IsCeased = true
+		}
+	}
+
+	lc.IsSuperseded = len(props.Get("wof:superseded_by").Array()) > 0
+	lc.IsSuperseding = len(props.Get("wof:supersedes").Array()) > 0
+
+	current_rsp := props.Get("mz:is_current")
+
+	switch {
+	case lc.IsDeprecated:
+		lc.Status = LIFECYCLE_DEPRECATED
+	case lc.IsSuperseded:
+		lc.Status = LIFECYCLE_SUPERSEDED
+	case lc.IsCeased:
+		lc.Status = LIFECYCLE_CEASED
+	case current_rsp.Exists() && current_rsp.Int() == 0:
+		lc.Status = LIFECYCLE_NOT_CURRENT
+	case current_rsp.Exists() && current_rsp.Int() == 1:
+		lc.Status = LIFECYCLE_CURRENT
+	}
+
+	return lc
+}
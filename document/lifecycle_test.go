@@ -0,0 +1,85 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendLifecycleProperties(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := map[string]map[string]interface{}{
+		"current.geojson": {
+			"lifecycle:status": LIFECYCLE_CURRENT,
+			"is_current":       true,
+			"is_ceased":        false,
+		},
+		"deprecated.geojson": {
+			"lifecycle:status": LIFECYCLE_DEPRECATED,
+			"is_current":       false,
+			"is_deprecated":    true,
+		},
+		"superseded.geojson": {
+			"lifecycle:status": LIFECYCLE_SUPERSEDED,
+			"is_current":       false,
+			"is_superseded":    true,
+			"is_ceased":        true,
+		},
+		"superseding.geojson": {
+			"lifecycle:status": LIFECYCLE_CURRENT,
+			"is_current":       true,
+			"is_superseding":   true,
+		},
+		"ceased.geojson": {
+			"lifecycle:status": LIFECYCLE_CEASED,
+			"is_current":       false,
+			"is_ceased":        true,
+		},
+		"not-current.geojson": {
+			"lifecycle:status": LIFECYCLE_NOT_CURRENT,
+			"is_current":       false,
+			"is_ceased":        false,
+		},
+		"unknown.geojson": {
+			"lifecycle:status": LIFECYCLE_UNKNOWN,
+			"is_current":       false,
+			"is_deprecated":    false,
+			"is_superseded":    false,
+		},
+	}
+
+	for fname, expected := range tests {
+
+		path := filepath.Join("..", "fixtures", "lifecycle", fname)
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		new_body, err := AppendLifecycleProperties(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to append lifecycle properties for %s, %v", path, err)
+		}
+
+		for k, v := range expected {
+
+			rsp := gjson.GetBytes(new_body, fmt.Sprintf("properties.%s", k))
+
+			if !rsp.Exists() {
+				t.Fatalf("%s is missing %s property", fname, k)
+			}
+
+			if rsp.Value() != v {
+				t.Fatalf("Unexpected value for %s in %s, expected '%v' but got '%v'", k, fname, v, rsp.Value())
+			}
+		}
+	}
+}
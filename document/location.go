@@ -0,0 +1,315 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_CENTROID_PRECEDENCE is the default order of precedence for property prefixes used to derive a record's centroid.
+var DEFAULT_CENTROID_PRECEDENCE = []string{
+	"lbl",
+	"reversegeo",
+	"geom",
+}
+
+// DEFAULT_LOCATION_PROPERTY is the default name of the `geo_point` property assigned by `AppendLocation`.
+const DEFAULT_LOCATION_PROPERTY string = "location"
+
+// DEFAULT_ENVELOPE_PROPERTY is the default name of the `geo_shape` envelope property assigned by `AppendLocation`.
+const DEFAULT_ENVELOPE_PROPERTY string = "envelope"
+
+// type AppendLocationOptions defines configuration options for deriving location properties from a Who's On First document.
+type AppendLocationOptions struct {
+	// CentroidPrecedence is the ordered list of property prefixes used to derive a centroid. For each prefix
+	// the `{PREFIX}:latitude` and `{PREFIX}:longitude` properties are consulted. Default is `DEFAULT_CENTROID_PRECEDENCE`.
+	CentroidPrecedence []string
+	// LocationProperty is the name of the `geo_point` property to assign. Default is `DEFAULT_LOCATION_PROPERTY`.
+	LocationProperty string
+	// EnvelopeProperty is the name of the `geo_shape` envelope property to assign. Default is `DEFAULT_ENVELOPE_PROPERTY`.
+	EnvelopeProperty string
+}
+
+// AppendLocation appends `geo_point` and `geo_shape` envelope properties to a Who's On First document
+// using the default `AppendLocationOptions`. See `NewAppendLocationFunc` for details.
+func AppendLocation(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendLocationOptions{}
+	return appendLocation(ctx, body, opts)
+}
+
+// NewAppendLocationFunc returns a `PrepareDocumentFunc` that appends `geo_point` and `geo_shape` envelope properties
+// to a Who's On First document. Specifically:
+// * A `geo_point` property (`opts.LocationProperty`) derived from the first prefix in `opts.CentroidPrecedence` with valid
+// latitude and longitude properties. If none are present the centre of the `geom:bbox` property or of the GeoJSON geometry is used.
+// * A `location:source` property indicating which prefix (or "geom:bbox" or "geometry") the `geo_point` property was derived from.
+// * A `geo_shape` envelope property (`opts.EnvelopeProperty`) derived from the `geom:bbox` property or the GeoJSON geometry.
+// Latitude and longitude pairs of (0, 0) are considered to be unknown. This function works with both complete GeoJSON
+// Features and properties-only ("spelunker v1") documents.
+func NewAppendLocationFunc(ctx context.Context, opts *AppendLocationOptions) (PrepareDocumentFunc, error) {
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendLocation(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendLocation(ctx context.Context, body []byte, opts *AppendLocationOptions) ([]byte, error) {
+
+	precedence := opts.CentroidPrecedence
+
+	if len(precedence) == 0 {
+		precedence = DEFAULT_CENTROID_PRECEDENCE
+	}
+
+	location_property := opts.LocationProperty
+
+	if location_property == "" {
+		location_property = DEFAULT_LOCATION_PROPERTY
+	}
+
+	envelope_property := opts.EnvelopeProperty
+
+	if envelope_property == "" {
+		envelope_property = DEFAULT_ENVELOPE_PROPERTY
+	}
+
+	loc := deriveLocation(body, precedence)
+
+	to_assign := make(map[string]interface{})
+
+	if loc.source != "" {
+
+		to_assign[location_property] = map[string]float64{
+			"lat": loc.latitude,
+			"lon": loc.longitude,
+		}
+
+		to_assign["location:source"] = loc.source
+	}
+
+	if loc.has_bbox {
+
+		bbox := loc.bbox
+
+		// Note the order: upper left, lower right
+		// https://www.elastic.co/guide/en/elasticsearch/reference/7.x/geo-shape.html#_envelope
+
+		to_assign[envelope_property] = map[string]interface{}{
+			"type": "envelope",
+			"coordinates": [][]float64{
+				[]float64{bbox[0], bbox[3]},
+				[]float64{bbox[2], bbox[1]},
+			},
+		}
+	}
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+type derived_location struct {
+	latitude  float64
+	longitude float64
+	source    string
+	bbox      [4]float64
+	has_bbox  bool
+	geometry  *geometry
+}
+
+// deriveLocation derives a centroid and bounding box for 'body' using the property prefixes in 'precedence'. If none
+// of the prefixes have valid latitude and longitude properties the centre of the bounding box is used. The bounding
+// box is derived from the `geom:bbox` property or the GeoJSON geometry. The `source` property of the return value
+// will be empty if no centroid could be derived.
+func deriveLocation(body []byte, precedence []string) *derived_location {
+
+	loc := &derived_location{}
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if geom_rsp.Exists() && geom_rsp.Type != gjson.Null {
+
+		g, err := parseGeometry(geom_rsp)
+
+		if err == nil {
+			loc.geometry = g
+		}
+	}
+
+	geom := loc.geometry
+
+	bbox, bbox_ok := bboxFromProperties(root)
+	bbox_source := "geom:bbox"
+
+	if !bbox_ok && geom != nil {
+
+		min_x, min_y, max_x, max_y, ok := geom.bbox()
+
+		if ok && isLatLonInRange(min_y, min_x) && isLatLonInRange(max_y, max_x) {
+			bbox = [4]float64{min_x, min_y, max_x, max_y}
+			bbox_ok = true
+			bbox_source = "geometry"
+		}
+	}
+
+	loc.bbox = bbox
+	loc.has_bbox = bbox_ok
+
+	for _, prefix := range precedence {
+
+		lat_rsp := root.Get(fmt.Sprintf("%s:latitude", prefix))
+		lon_rsp := root.Get(fmt.Sprintf("%s:longitude", prefix))
+
+		if !lat_rsp.Exists() || !lon_rsp.Exists() {
+			continue
+		}
+
+		if !isValidLatLon(lat_rsp.Float(), lon_rsp.Float()) {
+			continue
+		}
+
+		loc.latitude = lat_rsp.Float()
+		loc.longitude = lon_rsp.Float()
+		loc.source = prefix
+		return loc
+	}
+
+	if geom != nil && geom.kind == "Point" && isValidLatLon(geom.points[0][1], geom.points[0][0]) {
+		loc.latitude = geom.points[0][1]
+		loc.longitude = geom.points[0][0]
+		loc.source = "geometry"
+		return loc
+	}
+
+	if bbox_ok {
+
+		max_x := bbox[2]
+
+		// Bounding boxes that cross the antimeridian have a minimum longitude greater than their maximum longitude
+
+		if bbox[0] > max_x {
+			max_x += 360.0
+		}
+
+		lat := bbox[1] + ((bbox[3] - bbox[1]) / 2.0)
+		lon := bbox[0] + ((max_x - bbox[0]) / 2.0)
+
+		if lon > 180.0 {
+			lon -= 360.0
+		}
+
+		loc.latitude = lat
+		loc.longitude = lon
+		loc.source = bbox_source
+	}
+
+	return loc
+}
+
+// bboxFromProperties returns the minimum x, minimum y, maximum x and maximum y values of the `geom:bbox` property
+// in 'props'. The property may be either a comma-separated string or a list of numbers.
+func bboxFromProperties(props gjson.Result) ([4]float64, bool) {
+
+	var bbox [4]float64
+
+	bbox_rsp := props.Get("geom:bbox")
+
+	if !bbox_rsp.Exists() {
+		return bbox, false
+	}
+
+	var values []string
+
+	if bbox_rsp.IsArray() {
+
+		for _, v := range bbox_rsp.Array() {
+			values = append(values, v.String())
+		}
+
+	} else {
+		values = strings.Split(bbox_rsp.String(), ",")
+	}
+
+	if len(values) != 4 {
+		return bbox, false
+	}
+
+	for idx, str_v := range values {
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(str_v), 64)
+
+		if err != nil {
+			return bbox, false
+		}
+
+		bbox[idx] = v
+	}
+
+	if bbox == [4]float64{0.0, 0.0, 0.0, 0.0} {
+		return bbox, false
+	}
+
+	if !isLatLonInRange(bbox[1], bbox[0]) || !isLatLonInRange(bbox[3], bbox[2]) {
+		return bbox, false
+	}
+
+	if bbox[1] > bbox[3] {
+		return bbox, false
+	}
+
+	return bbox, true
+}
+
+// isValidLatLon returns a boolean value indicating whether 'lat' and 'lon' are valid coordinates. Coordinates
+// of (0, 0) are considered to be invalid since that is the value typically used to indicate an unknown location.
+func isValidLatLon(lat float64, lon float64) bool {
+
+	if lat == 0.0 && lon == 0.0 {
+		return false
+	}
+
+	return isLatLonInRange(lat, lon)
+}
+
+// isLatLonInRange returns a boolean value indicating whether 'lat' and 'lon' are within the range of valid latitudes and longitudes.
+func isLatLonInRange(lat float64, lon float64) bool {
+
+	if lat < -90.0 || lat > 90.0 {
+		return false
+	}
+
+	if lon < -180.0 || lon > 180.0 {
+		return false
+	}
+
+	return true
+}
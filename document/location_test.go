@@ -0,0 +1,235 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendLocationPrecedence(t *testing.T) {
+
+	ctx := context.Background()
+
+	props := `"wof:id": 1234, "lbl:latitude": 37.1, "lbl:longitude": -122.1, "reversegeo:latitude": 37.2, "reversegeo:longitude": -122.2, "geom:latitude": 37.3, "geom:longitude": -122.3`
+
+	feature := fmt.Sprintf(`{"type": "Feature", "properties": {%s}, "geometry": {"type": "Point", "coordinates": [-122.4, 37.4]}}`, props)
+	props_only := fmt.Sprintf(`{%s}`, props)
+
+	tests := []struct {
+		precedence []string
+		source     string
+		lat        float64
+		lon        float64
+	}{
+		{nil, "lbl", 37.1, -122.1},
+		{[]string{"lbl", "reversegeo", "geom"}, "lbl", 37.1, -122.1},
+		{[]string{"geom", "lbl"}, "geom", 37.3, -122.3},
+		{[]string{"reversegeo", "geom"}, "reversegeo", 37.2, -122.2},
+		{[]string{"mps", "reversegeo"}, "reversegeo", 37.2, -122.2},
+	}
+
+	for _, test := range tests {
+
+		opts := &AppendLocationOptions{
+			CentroidPrecedence: test.precedence,
+		}
+
+		location_func, err := NewAppendLocationFunc(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create location func, %v", err)
+		}
+
+		for label, body := range map[string]string{"feature": feature, "properties": props_only} {
+
+			new_body, err := location_func(ctx, []byte(body))
+
+			if err != nil {
+				t.Fatalf("Failed to append location for %s (%v), %v", label, test.precedence, err)
+			}
+
+			prefix := ""
+
+			if label == "feature" {
+				prefix = "properties."
+			}
+
+			checkLocation(t, fmt.Sprintf("%s %v", label, test.precedence), new_body, prefix, test.source, test.lat, test.lon)
+		}
+	}
+}
+
+func TestAppendLocationFallback(t *testing.T) {
+
+	ctx := context.Background()
+
+	// Centroids of (0, 0) are considered unknown so the centre of geom:bbox is used
+
+	body := `{"wof:id": 1234, "lbl:latitude": 0.0, "lbl:longitude": 0.0, "geom:bbox": "-122.5,37.7,-122.3,37.9"}`
+
+	new_body, err := AppendLocation(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append location, %v", err)
+	}
+
+	checkLocation(t, "geom:bbox fallback", new_body, "", "geom:bbox", 37.8, -122.4)
+	checkEnvelope(t, "geom:bbox fallback", new_body, "", [4]float64{-122.5, 37.7, -122.3, 37.9})
+
+	// No centroid properties and no geom:bbox so the Point geometry is used
+
+	body = `{"type": "Feature", "properties": {"wof:id": 1234}, "geometry": {"type": "Point", "coordinates": [-122.4, 37.8]}}`
+
+	new_body, err = AppendLocation(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append location, %v", err)
+	}
+
+	checkLocation(t, "point geometry fallback", new_body, "properties.", "geometry", 37.8, -122.4)
+
+	// Nothing to derive a location from
+
+	body = `{"wof:id": 1234}`
+
+	new_body, err = AppendLocation(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append location, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "location").Exists() || gjson.GetBytes(new_body, "envelope").Exists() {
+		t.Fatalf("Unexpected location properties for document without coordinates")
+	}
+}
+
+func TestAppendLocationBboxFromGeometry(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"type": "Feature", "properties": {"wof:id": 1234}, "geometry": {"type": "Polygon", "coordinates": [[[-122.5,37.7],[-122.3,37.7],[-122.3,37.9],[-122.5,37.9],[-122.5,37.7]]]}}`
+
+	opts := &AppendLocationOptions{
+		LocationProperty: "centroid",
+		EnvelopeProperty: "bbox",
+	}
+
+	location_func, err := NewAppendLocationFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create location func, %v", err)
+	}
+
+	new_body, err := location_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append location, %v", err)
+	}
+
+	centroid := gjson.GetBytes(new_body, "properties.centroid")
+
+	if !approximately(centroid.Get("lat").Float(), 37.8) || !approximately(centroid.Get("lon").Float(), -122.4) {
+		t.Fatalf("Unexpected centroid: %s", centroid.Raw)
+	}
+
+	if gjson.GetBytes(new_body, "properties.location:source").String() != "geometry" {
+		t.Fatalf("Unexpected location source: %s", gjson.GetBytes(new_body, "properties.location:source").String())
+	}
+
+	envelope := gjson.GetBytes(new_body, "properties.bbox")
+
+	if envelope.Get("type").String() != "envelope" {
+		t.Fatalf("Unexpected envelope: %s", envelope.Raw)
+	}
+
+	checkEnvelopeCoordinates(t, "geometry bbox", envelope, [4]float64{-122.5, 37.7, -122.3, 37.9})
+}
+
+func TestAppendLocationAntimeridian(t *testing.T) {
+
+	ctx := context.Background()
+
+	// A bounding box crossing the antimeridian (for example Fiji) has a minimum longitude greater than its maximum longitude
+
+	body := `{"type": "Feature", "properties": {"wof:id": 1234, "geom:bbox": [170.0, -20.0, -170.0, -10.0]}, "geometry": null}`
+
+	new_body, err := AppendLocation(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append location, %v", err)
+	}
+
+	checkLocation(t, "antimeridian", new_body, "properties.", "geom:bbox", -15.0, 180.0)
+	checkEnvelope(t, "antimeridian", new_body, "properties.", [4]float64{170.0, -20.0, -170.0, -10.0})
+
+	body = `{"wof:id": 1234, "geom:bbox": "175.0,-20.0,-165.0,-10.0"}`
+
+	new_body, err = AppendLocation(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append location, %v", err)
+	}
+
+	checkLocation(t, "antimeridian (wrapped)", new_body, "", "geom:bbox", -15.0, -175.0)
+}
+
+func checkLocation(t *testing.T, label string, body []byte, prefix string, source string, lat float64, lon float64) {
+
+	loc := gjson.GetBytes(body, prefix+"location")
+
+	if !loc.Exists() {
+		t.Fatalf("Missing location property for %s", label)
+	}
+
+	if !approximately(loc.Get("lat").Float(), lat) || !approximately(loc.Get("lon").Float(), lon) {
+		t.Fatalf("Unexpected location for %s: %s (expected %f, %f)", label, loc.Raw, lat, lon)
+	}
+
+	loc_source := gjson.GetBytes(body, prefix+"location:source").String()
+
+	if loc_source != source {
+		t.Fatalf("Unexpected location source for %s: %s (expected %s)", label, loc_source, source)
+	}
+}
+
+func checkEnvelope(t *testing.T, label string, body []byte, prefix string, bbox [4]float64) {
+
+	envelope := gjson.GetBytes(body, prefix+"envelope")
+
+	if envelope.Get("type").String() != "envelope" {
+		t.Fatalf("Unexpected envelope for %s: %s", label, envelope.Raw)
+	}
+
+	checkEnvelopeCoordinates(t, label, envelope, bbox)
+}
+
+// checkEnvelopeCoordinates checks that the coordinates of 'envelope' are the upper left and lower right corners of 'bbox'.
+func checkEnvelopeCoordinates(t *testing.T, label string, envelope gjson.Result, bbox [4]float64) {
+
+	expected := [][]float64{
+		{bbox[0], bbox[3]},
+		{bbox[2], bbox[1]},
+	}
+
+	coords := envelope.Get("coordinates").Array()
+
+	if len(coords) != 2 {
+		t.Fatalf("Unexpected envelope coordinates for %s: %s", label, envelope.Raw)
+	}
+
+	for i, pt := range coords {
+
+		for j, v := range pt.Array() {
+
+			if !approximately(v.Float(), expected[i][j]) {
+				t.Fatalf("Unexpected envelope coordinates for %s: %s", label, envelope.Raw)
+			}
+		}
+	}
+}
+
+func approximately(a float64, b float64) bool {
+	d := a - b
+	return d < 0.000001 && d > -0.000001
+}
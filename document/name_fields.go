@@ -0,0 +1,283 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"golang.org/x/text/language"
+	"sort"
+	"strings"
+)
+
+const (
+	// NAME_QUALIFIER_PREFERRED is the qualifier for preferred names (for example `name:eng_x_preferred`).
+	NAME_QUALIFIER_PREFERRED string = "preferred"
+	// NAME_QUALIFIER_VARIANT is the qualifier for variant names (for example `name:eng_x_variant`).
+	NAME_QUALIFIER_VARIANT string = "variant"
+	// NAME_QUALIFIER_COLLOQUIAL is the qualifier for colloquial names (for example `name:eng_x_colloquial`).
+	NAME_QUALIFIER_COLLOQUIAL string = "colloquial"
+)
+
+// NAMES_ALL_PROPERTY is the property containing the unique set of all the names of a Who's On First record.
+const NAMES_ALL_PROPERTY string = "names:all"
+
+// type nameKey contains the components of a Who's On First `name:{LANGUAGE}_x_{QUALIFIER}` property.
+type nameKey struct {
+	// Tag is the language tag, for example "eng" or "zho_hant"
+	Tag string
+	// Language is the (lower-cased) language component of the tag, for example "eng" or "zho"
+	Language string
+	// Script is the (title-cased) ISO 15924 script component of the tag, if present, for example "Hant"
+	Script string
+	// Region is the (upper-cased) ISO 3166-1 or UN M.49 region component of the tag, if present, for example "BR"
+	Region string
+	// Qualifier is the (normalized) qualifier, for example "preferred" or "variant"
+	Qualifier string
+}
+
+// parseNameKey parses a `name:{LANGUAGE}_x_{QUALIFIER}` property key in to a `nameKey` instance. The "name:" prefix is
+// optional. The language tag must start with a two or three letter language code which may be followed by a four letter
+// script code and/or a two letter (or three digit) region code, separated by "_" or "-". The legacy "prefered" spelling of
+// the preferred qualifier is normalized to `NAME_QUALIFIER_PREFERRED`.
+func parseNameKey(k string) (*nameKey, bool) {
+
+	k = strings.TrimPrefix(k, "name:")
+
+	parts := strings.Split(k, "_x_")
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, false
+	}
+
+	tag := parts[0]
+	qualifier := strings.ToLower(parts[1])
+
+	if qualifier == "prefered" {
+		qualifier = NAME_QUALIFIER_PREFERRED
+	}
+
+	subtags := strings.FieldsFunc(tag, func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+
+	if len(subtags) == 0 || !isAlpha(subtags[0]) || len(subtags[0]) < 2 || len(subtags[0]) > 3 {
+		return nil, false
+	}
+
+	nk := &nameKey{
+		Tag:       tag,
+		Language:  strings.ToLower(subtags[0]),
+		Qualifier: qualifier,
+	}
+
+	for _, subtag := range subtags[1:] {
+
+		switch {
+		case len(subtag) == 4 && isAlpha(subtag) && nk.Script == "" && nk.Region == "":
+			nk.Script = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2 && isAlpha(subtag) && nk.Region == "":
+			nk.Region = strings.ToUpper(subtag)
+		case len(subtag) == 3 && isDigits(subtag) && nk.Region == "":
+			nk.Region = subtag
+		default:
+			return nil, false
+		}
+	}
+
+	return nk, true
+}
+
+// BCP47 returns the BCP 47 language tag for 'nk', for example "en" or "zh-Hant". Returns an empty string if the language
+// is not a known ISO 639 language.
+func (nk *nameKey) BCP47() string {
+
+	tag, ok := nk.languageTag()
+
+	if !ok {
+		return ""
+	}
+
+	return tag.String()
+}
+
+// ISO639_1 returns the two letter ISO 639-1 code for the language of 'nk', for example "en" for "eng". Returns an empty
+// string if the language does not have a two letter code.
+func (nk *nameKey) ISO639_1() string {
+
+	tag, ok := nk.languageTag()
+
+	if !ok {
+		return ""
+	}
+
+	base, _ := tag.Base()
+	code := base.String()
+
+	if len(code) != 2 {
+		return ""
+	}
+
+	return code
+}
+
+func (nk *nameKey) languageTag() (language.Tag, bool) {
+
+	subtags := []string{
+		nk.Language,
+	}
+
+	if nk.Script != "" {
+		subtags = append(subtags, nk.Script)
+	}
+
+	if nk.Region != "" {
+		subtags = append(subtags, nk.Region)
+	}
+
+	tag, err := language.Parse(strings.Join(subtags, "-"))
+
+	if err != nil || tag == language.Und {
+		return language.Und, false
+	}
+
+	return tag, true
+}
+
+func isAlpha(s string) bool {
+
+	for _, r := range s {
+
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isDigits(s string) bool {
+
+	for _, r := range s {
+
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AppendNameFields regroups the `name:{LANGUAGE}_x_{QUALIFIER}` properties of a Who's On First document in to per-language
+// objects so that each language can be mapped with its own analyzer. Specifically:
+// * A `names` object keyed by language whose values are objects keyed by qualifier (`preferred`, `variant`, `colloquial` or
+// any other qualifier) containing the list of names, for example `names.eng.preferred` or `names.fra.variant`. Language tags
+// with a script or region (for example "zho_hant") are grouped under their language ("zho").
+// * The unique set of all names, including `wof:name`, in the `names:all` property.
+// The original `name:*` properties are not changed.
+func AppendNameFields(ctx context.Context, body []byte) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	names := make(map[string]map[string][]string)
+
+	all_names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add_name := func(name string) {
+
+		if name == "" || seen[name] {
+			return
+		}
+
+		all_names = append(all_names, name)
+		seen[name] = true
+	}
+
+	add_name(root.Get("wof:name").String())
+
+	props := root.Map()
+
+	keys := make([]string, 0)
+
+	for k, _ := range props {
+
+		if strings.HasPrefix(k, "name:") {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		nk, ok := parseNameKey(k)
+
+		if !ok {
+			continue
+		}
+
+		_, ok = names[nk.Language]
+
+		if !ok {
+			names[nk.Language] = make(map[string][]string)
+		}
+
+		by_qualifier := names[nk.Language]
+
+		for _, v := range props[k].Array() {
+
+			name := strings.TrimSpace(v.String())
+
+			if name == "" {
+				continue
+			}
+
+			add_name(name)
+
+			is_dupe := false
+
+			for _, existing := range by_qualifier[nk.Qualifier] {
+
+				if existing == name {
+					is_dupe = true
+					break
+				}
+			}
+
+			if !is_dupe {
+				by_qualifier[nk.Qualifier] = append(by_qualifier[nk.Qualifier], name)
+			}
+		}
+	}
+
+	to_assign := map[string]interface{}{
+		"names":            names,
+		NAMES_ALL_PROPERTY: all_names,
+	}
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
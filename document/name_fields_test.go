@@ -0,0 +1,57 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendNameFields(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join("..", "fixtures", "names", "sao-paulo.geojson")
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	body, err = AppendNameFields(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to append name fields, %v", err)
+	}
+
+	tests := map[string]int{
+		"names.por.preferred":  1,
+		"names.por.variant":    2,
+		"names.por.colloquial": 2,
+		"names.eng.preferred":  1,
+		"names.deu.preferred":  1,
+		"names.zho.preferred":  2,
+		NAMES_ALL_PROPERTY:     9,
+	}
+
+	for k, expected := range tests {
+
+		path := fmt.Sprintf("properties.%s", k)
+		count := len(gjson.GetBytes(body, path).Array())
+
+		if count != expected {
+			t.Fatalf("Expected %d values for %s, got %d", expected, path, count)
+		}
+	}
+
+	if gjson.GetBytes(body, "properties.names.deu.prefered").Exists() {
+		t.Fatalf("Expected legacy 'prefered' qualifier to be normalized")
+	}
+
+	if gjson.GetBytes(body, "properties.names.unknown").Exists() {
+		t.Fatalf("Expected malformed name key to be skipped")
+	}
+}
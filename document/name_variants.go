@@ -0,0 +1,309 @@
+package document
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NAMES_FOLDED_PROPERTY is the property containing the ASCII-folded variants of the names of a Who's On First record.
+const NAMES_FOLDED_PROPERTY string = "names:folded"
+
+// NAMES_TRANSLITERATED_PROPERTY is the property containing the (Latin) transliterated variants of the names of a Who's On First record.
+const NAMES_TRANSLITERATED_PROPERTY string = "names:transliterated"
+
+// SORT_NAME_PROPERTY is the property containing the collation sort key for the `wof:name` property of a Who's On First record.
+// Per-language sort keys are stored in `{SORT_NAME_PROPERTY}_{LANGUAGE}` properties.
+const SORT_NAME_PROPERTY string = "sort:name"
+
+// fold_letters maps letters that don't decompose in to a base letter and combining marks to their ASCII equivalents.
+var fold_letters = map[rune]string{
+	'ß': "ss",
+	'ẞ': "SS",
+	'æ': "ae",
+	'Æ': "AE",
+	'œ': "oe",
+	'Œ': "OE",
+	'ø': "o",
+	'Ø': "O",
+	'ł': "l",
+	'Ł': "L",
+	'đ': "d",
+	'Đ': "D",
+	'ð': "d",
+	'Ð': "D",
+	'þ': "th",
+	'Þ': "Th",
+	'ı': "i",
+	'ħ': "h",
+	'Ħ': "H",
+	'‘': "'",
+	'’': "'",
+	'–': "-",
+	'—': "-",
+}
+
+// transliterate_letters maps (lower-case) Cyrillic and Greek letters to their Latin equivalents.
+var transliterate_letters = map[rune]string{
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'ґ': "g", 'д': "d", 'е': "e", 'ё': "yo", 'є': "ye", 'ж': "zh",
+	'з': "z", 'и': "i", 'і': "i", 'ї': "yi", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh",
+	'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'ђ': "dj", 'ј': "j", 'љ': "lj",
+	'њ': "nj", 'ћ': "c", 'џ': "dz", 'ў': "u",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+	'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+	'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+var collator_pools = new(sync.Map)
+
+// foldName returns the ASCII-folded form of 'name', removing diacritics and replacing letters that don't
+// decompose (for example "ß" or "ø") with their ASCII equivalents. The second value is false if the folded
+// form still contains non-ASCII characters.
+func foldName(name string) (string, bool) {
+
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+	folded, _, err := transform.String(t, name)
+
+	if err != nil {
+		return "", false
+	}
+
+	var b strings.Builder
+
+	is_ascii := true
+
+	for _, r := range folded {
+
+		v, ok := fold_letters[r]
+
+		if ok {
+			b.WriteString(v)
+			continue
+		}
+
+		if r > unicode.MaxASCII {
+			is_ascii = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String(), is_ascii
+}
+
+// transliterateName returns the ASCII-folded Latin transliteration of 'name'. Only Cyrillic and Greek letters are
+// transliterated. The second value is false if 'name' does not contain any Cyrillic or Greek letters or if the
+// transliteration still contains non-ASCII characters.
+func transliterateName(name string) (string, bool) {
+
+	var b strings.Builder
+
+	has_letters := false
+
+	for _, r := range norm.NFC.String(name) {
+
+		lower := unicode.ToLower(r)
+		v, ok := transliterate_letters[lower]
+
+		if !ok {
+
+			// Accented Greek letters (for example "ά") need to be decomposed first
+
+			base := []rune(norm.NFD.String(string(lower)))[0]
+			v, ok = transliterate_letters[base]
+		}
+
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		has_letters = true
+
+		if unicode.IsUpper(r) && v != "" {
+			v = strings.ToUpper(v[:1]) + v[1:]
+		}
+
+		b.WriteString(v)
+	}
+
+	if !has_letters {
+		return "", false
+	}
+
+	return foldName(b.String())
+}
+
+// collationKey returns the hex-encoded collation key for 'name' using the collation rules for 'lang'. Keys for the same
+// language can be compared (and sorted) lexically. If 'lang' is not a valid language tag the root collation rules are
+// used and the second value is false.
+func collationKey(lang string, name string) (string, bool) {
+
+	tag, err := language.Parse(lang)
+	is_valid := true
+
+	if err != nil {
+		tag = language.Und
+		is_valid = false
+	}
+
+	// collate.Collator instances are not safe for concurrent use
+
+	v, _ := collator_pools.LoadOrStore(tag.String(), &sync.Pool{
+		New: func() interface{} {
+			return collate.New(tag)
+		},
+	})
+
+	pool := v.(*sync.Pool)
+
+	c := pool.Get().(*collate.Collator)
+	defer pool.Put(c)
+
+	buf := new(collate.Buffer)
+	key := c.KeyFromString(buf, name)
+
+	return hex.EncodeToString(key), is_valid
+}
+
+// AppendNameVariants appends normalized variants of the names in a Who's On First document. Specifically:
+// * The unique set of ASCII-folded forms of `wof:name` and all `name:*` properties (`names:folded`), for example "Sao Paulo"
+// for "São Paulo" or "Zurich" for "Zürich". Names whose folded form is not entirely ASCII are excluded.
+// * The unique set of Latin transliterations of Cyrillic and Greek names (`names:transliterated`), for example "San-Paulu" for "Сан-Паулу".
+// * A collation sort key for `wof:name` using the root collation rules (`sort:name`) and, for each language with a preferred
+// name, a collation sort key for that name using that language's collation rules (for example `sort:name_deu`). Sort keys are
+// hex-encoded so they can be sorted as keyword fields.
+// Languages whose collation rules can not be determined are counted in the `name_variants:unknown_language` key of the `Report`
+// associated with the context, if present, and use the root collation rules. Existing name properties, including those
+// produced by `AppendNameStats`, are not changed.
+func AppendNameVariants(ctx context.Context, body []byte) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	report := ReportFromContext(ctx)
+
+	folded := make([]string, 0)
+	transliterated := make([]string, 0)
+
+	seen_folded := make(map[string]bool)
+	seen_transliterated := make(map[string]bool)
+
+	add_variants := func(name string) {
+
+		f, ok := foldName(name)
+
+		if ok && f != "" && !seen_folded[f] {
+			folded = append(folded, f)
+			seen_folded[f] = true
+		}
+
+		t, ok := transliterateName(name)
+
+		if ok && t != "" && !seen_transliterated[t] {
+			transliterated = append(transliterated, t)
+			seen_transliterated[t] = true
+		}
+	}
+
+	to_assign := make(map[string]interface{})
+
+	wof_name := root.Get("wof:name").String()
+
+	if wof_name != "" {
+		add_variants(wof_name)
+		to_assign[SORT_NAME_PROPERTY], _ = collationKey("und", wof_name)
+	}
+
+	props := root.Map()
+
+	keys := make([]string, 0)
+
+	for k, _ := range props {
+
+		if strings.HasPrefix(k, "name:") {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		nk, ok := parseNameKey(k)
+
+		if !ok {
+			continue
+		}
+
+		names := props[k].Array()
+
+		for _, v := range names {
+			add_variants(strings.TrimSpace(v.String()))
+		}
+
+		if nk.Qualifier != NAME_QUALIFIER_PREFERRED || len(names) == 0 {
+			continue
+		}
+
+		sort_k := fmt.Sprintf("%s_%s", SORT_NAME_PROPERTY, nk.Language)
+
+		// Prefer names whose tag is just the language (for example "zho" rather than "zho_hant")
+
+		_, exists := to_assign[sort_k]
+
+		if exists && nk.Tag != nk.Language {
+			continue
+		}
+
+		key, ok := collationKey(nk.Language, names[0].String())
+
+		if !ok {
+			report.Increment("name_variants:unknown_language", 1)
+		}
+
+		to_assign[sort_k] = key
+	}
+
+	to_assign[NAMES_FOLDED_PROPERTY] = folded
+	to_assign[NAMES_TRANSLITERATED_PROPERTY] = transliterated
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
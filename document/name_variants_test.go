@@ -0,0 +1,141 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFoldName(t *testing.T) {
+
+	tests := map[string]string{
+		"São Paulo":      "Sao Paulo",
+		"Zürich":         "Zurich",
+		"Straße":         "Strasse",
+		"Łódź":           "Lodz",
+		"Tromsø":         "Tromso",
+		"Ville-Marie":    "Ville-Marie",
+		"Montréal-Est":   "Montreal-Est",
+		"Ærøskøbing":     "AEroskobing",
+		"Þingvellir":     "Thingvellir",
+		"Nuuk (Godthåb)": "Nuuk (Godthab)",
+	}
+
+	for name, expected := range tests {
+
+		folded, ok := foldName(name)
+
+		if !ok {
+			t.Fatalf("Expected '%s' to fold to ASCII", name)
+		}
+
+		if folded != expected {
+			t.Fatalf("Unexpected folded name for '%s': '%s'", name, folded)
+		}
+	}
+
+	_, ok := foldName("サンパウロ")
+
+	if ok {
+		t.Fatalf("Expected Japanese name not to fold to ASCII")
+	}
+}
+
+func TestTransliterateName(t *testing.T) {
+
+	tests := map[string]string{
+		"Сан-Паулу": "San-Paulu",
+		"Москва":    "Moskva",
+		"Київ":      "Kiyiv",
+		"Αθήνα":     "Athina",
+	}
+
+	for name, expected := range tests {
+
+		transliterated, ok := transliterateName(name)
+
+		if !ok {
+			t.Fatalf("Failed to transliterate '%s'", name)
+		}
+
+		if transliterated != expected {
+			t.Fatalf("Unexpected transliteration for '%s': '%s'", name, transliterated)
+		}
+	}
+
+	_, ok := transliterateName("Zürich")
+
+	if ok {
+		t.Fatalf("Expected Latin name not to be transliterated")
+	}
+}
+
+func TestCollationKey(t *testing.T) {
+
+	// "Ö" sorts with "O" in German but after "Z" in Swedish
+
+	tests := map[string]bool{
+		"deu": true,
+		"swe": false,
+	}
+
+	for lang, expected := range tests {
+
+		a, _ := collationKey(lang, "Öland")
+		b, _ := collationKey(lang, "Zebra")
+
+		if (a < b) != expected {
+			t.Fatalf("Unexpected collation order for %s", lang)
+		}
+	}
+}
+
+func TestAppendNameVariants(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join("..", "fixtures", "names", "sao-paulo.geojson")
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	body, err = AppendNameVariants(ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to append name variants, %v", err)
+	}
+
+	tests := map[string]int{
+		NAMES_FOLDED_PROPERTY:         4,
+		NAMES_TRANSLITERATED_PROPERTY: 1,
+	}
+
+	for k, expected := range tests {
+
+		path := fmt.Sprintf("properties.%s", k)
+		count := len(gjson.GetBytes(body, path).Array())
+
+		if count != expected {
+			t.Fatalf("Expected %d values for %s, got %d", expected, path, count)
+		}
+	}
+
+	for _, lang := range []string{"por", "eng", "deu", "rus", "jpn", "zho"} {
+
+		path := fmt.Sprintf("properties.%s_%s", SORT_NAME_PROPERTY, lang)
+
+		if gjson.GetBytes(body, path).String() == "" {
+			t.Fatalf("Missing %s property", path)
+		}
+	}
+
+	if gjson.GetBytes(body, fmt.Sprintf("properties.%s", SORT_NAME_PROPERTY)).String() == "" {
+		t.Fatalf("Missing %s property", SORT_NAME_PROPERTY)
+	}
+}
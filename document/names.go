@@ -5,17 +5,28 @@ import (
 	"fmt"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"sort"
 	"strings"
 	"sync"
 )
 
 // AppendNameStats appends statistics about the `name:*` properties in a Who's On First record.
 // Specifically:
-// * The unique set of language translations
+// * The unique set of language translations, as both raw `name:*` suffixes and raw language tags (`translations`),
+// for example "zho_hant_x_preferred" and "zho_hant"
+// * The unique set of BCP 47 language tags (`translations:bcp47`), for example "en" or "zh-Hant"
+// * The unique set of ISO 639-1 language codes (`translations:iso639_1`), for example "en"
+// * The structured components (tag, language, script, region, qualifier and BCP 47 tag) of each name property (`translations:tags`)
 // * The total number of names
-// * The total number of languages
+// * The total number of (raw) language tags, so "zho" and "zho_hant" are counted separately
 // * The total number of "prefered" names
 // * The total number of "variant" names
+// * The total number of "colloquial" names
+// * The total number of malformed `name:*` properties (`counts:names_malformed`). Properties with at least one "_x_"
+// separator that can not otherwise be parsed are still included in the `translations` property and the name counts
+// but are excluded from the `translations:*` properties.
+// Malformed `name:*` properties are also counted in the `names:malformed_key` key of the `Report` associated with the
+// context, if present.
 func AppendNameStats(ctx context.Context, body []byte) ([]byte, error) {
 
 	root := gjson.ParseBytes(body)
@@ -26,38 +37,92 @@ func AppendNameStats(ctx context.Context, body []byte) ([]byte, error) {
 		root = props_rsp
 	}
 
+	report := ReportFromContext(ctx)
+
 	translations_key := new(sync.Map)
+	bcp47_key := new(sync.Map)
+	iso639_1_key := new(sync.Map)
 	lang_key := new(sync.Map)
 
+	tags := make([]map[string]string, 0)
+
 	count_names_total := 0
 	count_names_languages := 0
 	count_names_prefered := 0
 	count_names_colloquial := 0
 	count_names_variant := 0
+	count_names_malformed := 0
 
-	for k, v := range root.Map() {
+	keys := make([]string, 0)
+	props := root.Map()
 
-		if !strings.HasPrefix(k, "name:") {
-			continue
+	for k, _ := range props {
+
+		if strings.HasPrefix(k, "name:") {
+			keys = append(keys, k)
 		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		v := props[k]
 
 		k = strings.Replace(k, "name:", "", 1)
 		parts := strings.Split(k, "_x_")
 
 		if len(parts) < 2 {
+			count_names_malformed += 1
+			report.Increment("names:malformed_key", 1)
 			continue
 		}
 
+		// The raw language tag (for example "zho_hant") is used for the `translations` and `counts:names_languages`
+		// properties; the normalized language is only used for the `translations:*` properties
+
 		lang := parts[0]
 		qualifier := parts[1]
 
 		translations_key.Store(k, true)
 		translations_key.Store(lang, true)
 
+		nk, ok := parseNameKey(k)
+
+		if ok {
+
+			bcp47 := nk.BCP47()
+			iso639_1 := nk.ISO639_1()
+
+			if bcp47 != "" {
+				bcp47_key.Store(bcp47, true)
+			}
+
+			if iso639_1 != "" {
+				iso639_1_key.Store(iso639_1, true)
+			}
+
+			tags = append(tags, map[string]string{
+				"tag":       nk.Tag,
+				"language":  nk.Language,
+				"script":    nk.Script,
+				"region":    nk.Region,
+				"qualifier": nk.Qualifier,
+				"bcp47":     bcp47,
+				"iso639_1":  iso639_1,
+			})
+
+			qualifier = nk.Qualifier
+
+		} else {
+			count_names_malformed += 1
+			report.Increment("names:malformed_key", 1)
+		}
+
 		count_names := len(v.Array())
 		count_names_total += count_names
 
-		_, ok := lang_key.Load(lang)
+		_, ok = lang_key.Load(lang)
 
 		if !ok {
 			count_names_languages += 1
@@ -65,11 +130,11 @@ func AppendNameStats(ctx context.Context, body []byte) ([]byte, error) {
 		}
 
 		switch qualifier {
-		case "prefered":
+		case NAME_QUALIFIER_PREFERRED, "prefered":
 			count_names_prefered += count_names
-		case "variant":
+		case NAME_QUALIFIER_VARIANT:
 			count_names_variant += count_names
-		case "colloquial":
+		case NAME_QUALIFIER_COLLOQUIAL:
 			count_names_colloquial += count_names
 		default:
 			// pass
@@ -77,20 +142,31 @@ func AppendNameStats(ctx context.Context, body []byte) ([]byte, error) {
 
 	}
 
-	translations := make([]string, 0)
+	keys_from_map := func(m *sync.Map) []string {
+
+		values := make([]string, 0)
 
-	translations_key.Range(func(k interface{}, v interface{}) bool {
-		t := k.(string)
-		translations = append(translations, t)
-		return true
-	})
+		m.Range(func(k interface{}, v interface{}) bool {
+			t := k.(string)
+			values = append(values, t)
+			return true
+		})
+
+		sort.Strings(values)
+		return values
+	}
 
 	count_props := map[string]interface{}{
-		"translations":           translations,
-		"counts:names_total":     count_names_total,
-		"counts:names_prefered":  count_names_prefered,
-		"counts:names_variant":   count_names_variant,
-		"counts:names_languages": count_names_languages,
+		"translations":            keys_from_map(translations_key),
+		"translations:bcp47":      keys_from_map(bcp47_key),
+		"translations:iso639_1":   keys_from_map(iso639_1_key),
+		"translations:tags":       tags,
+		"counts:names_total":      count_names_total,
+		"counts:names_prefered":   count_names_prefered,
+		"counts:names_variant":    count_names_variant,
+		"counts:names_colloquial": count_names_colloquial,
+		"counts:names_languages":  count_names_languages,
+		"counts:names_malformed":  count_names_malformed,
 	}
 
 	var err error
@@ -0,0 +1,184 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNameKey(t *testing.T) {
+
+	tests := map[string][]string{
+		"name:eng_x_preferred":      []string{"eng", "", "", "preferred", "en", "en"},
+		"name:eng_x_prefered":       []string{"eng", "", "", "preferred", "en", "en"},
+		"name:zho_hant_x_preferred": []string{"zho", "Hant", "", "preferred", "zh-Hant", "zh"},
+		"name:por_br_x_variant":     []string{"por", "", "BR", "variant", "pt-BR", "pt"},
+		"name:srp_latn_x_preferred": []string{"srp", "Latn", "", "preferred", "sr-Latn", "sr"},
+		"name:gsw_x_colloquial":     []string{"gsw", "", "", "colloquial", "gsw", ""},
+	}
+
+	for k, expected := range tests {
+
+		nk, ok := parseNameKey(k)
+
+		if !ok {
+			t.Fatalf("Failed to parse %s", k)
+		}
+
+		components := []string{
+			nk.Language,
+			nk.Script,
+			nk.Region,
+			nk.Qualifier,
+			nk.BCP47(),
+			nk.ISO639_1(),
+		}
+
+		for idx, v := range expected {
+
+			if components[idx] != v {
+				t.Fatalf("Unexpected components for %s: %v", k, components)
+			}
+		}
+	}
+
+	malformed := []string{
+		"name:unknown",
+		"name:_x_preferred",
+		"name:eng_x_",
+		"name:english_x_preferred",
+		"name:eng_123abc_x_preferred",
+	}
+
+	for _, k := range malformed {
+
+		_, ok := parseNameKey(k)
+
+		if ok {
+			t.Fatalf("Expected %s to be malformed", k)
+		}
+	}
+}
+
+func TestAppendNameStats(t *testing.T) {
+
+	ctx := context.Background()
+
+	report := NewReport()
+	report_ctx := WithReport(ctx, report)
+
+	path := filepath.Join("..", "fixtures", "names", "sao-paulo.geojson")
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", path, err)
+	}
+
+	body, err = AppendNameStats(report_ctx, body)
+
+	if err != nil {
+		t.Fatalf("Failed to append name stats, %v", err)
+	}
+
+	counts := map[string]int64{
+		"counts:names_total":      12,
+		"counts:names_prefered":   7,
+		"counts:names_variant":    3,
+		"counts:names_colloquial": 2,
+		"counts:names_languages":  7,
+		"counts:names_malformed":  1,
+	}
+
+	for k, expected := range counts {
+
+		path := fmt.Sprintf("properties.%s", k)
+		v := gjson.GetBytes(body, path).Int()
+
+		if v != expected {
+			t.Fatalf("Expected %d for %s, got %d", expected, path, v)
+		}
+	}
+
+	lists := map[string]int{
+		"translations:bcp47":    7,
+		"translations:iso639_1": 6,
+		"translations:tags":     10,
+	}
+
+	for k, expected := range lists {
+
+		path := fmt.Sprintf("properties.%s", k)
+		count := len(gjson.GetBytes(body, path).Array())
+
+		if count != expected {
+			t.Fatalf("Expected %d values for %s, got %d", expected, path, count)
+		}
+	}
+
+	if report.Count("names:malformed_key") != 1 {
+		t.Fatalf("Expected malformed name key to be reported")
+	}
+}
+
+func TestAppendNameStatsTranslations(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"name:zho_x_preferred": ["a"], "name:zho_hant_x_preferred": ["b"], "name:eng_x_variant_x_historical": ["c"], "name:unknown": ["d"]}`
+
+	new_body, err := AppendNameStats(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append name stats, %v", err)
+	}
+
+	// Raw language tags are preserved in the translations property and counted separately
+
+	translations := make(map[string]bool)
+
+	for _, v := range gjson.GetBytes(new_body, "translations").Array() {
+		translations[v.String()] = true
+	}
+
+	for _, k := range []string{"zho", "zho_x_preferred", "zho_hant", "zho_hant_x_preferred", "eng", "eng_x_variant_x_historical"} {
+
+		if !translations[k] {
+			t.Fatalf("Missing %s translation, %s", k, gjson.GetBytes(new_body, "translations").Raw)
+		}
+	}
+
+	if len(translations) != 6 {
+		t.Fatalf("Unexpected translations, %s", gjson.GetBytes(new_body, "translations").Raw)
+	}
+
+	counts := map[string]int64{
+		"counts:names_languages": 3,
+		"counts:names_total":     3,
+		"counts:names_prefered":  2,
+		"counts:names_variant":   1,
+		"counts:names_malformed": 2,
+	}
+
+	for k, expected := range counts {
+
+		v := gjson.GetBytes(new_body, k).Int()
+
+		if v != expected {
+			t.Fatalf("Expected %d for %s, got %d", expected, k, v)
+		}
+	}
+
+	// The normalized language is only used for the translations:* properties
+
+	if gjson.GetBytes(new_body, "translations:iso639_1").Raw != `["zh"]` {
+		t.Fatalf("Unexpected translations:iso639_1 property, %s", gjson.GetBytes(new_body, "translations:iso639_1").Raw)
+	}
+
+	if len(gjson.GetBytes(new_body, "translations:tags").Array()) != 2 {
+		t.Fatalf("Unexpected translations:tags property, %s", gjson.GetBytes(new_body, "translations:tags").Raw)
+	}
+}
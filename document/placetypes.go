@@ -2,19 +2,142 @@ package document
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"github.com/whosonfirst/go-whosonfirst-placetypes"
+	"io"
 	_ "log"
+	"sort"
+	"strconv"
+	"sync"
 )
 
-// AppendPlacetypeDetails appends addition properties related to the `wof:placetype` and `wof:placetype_alt` properties in a Who's On First record.
-// Specifically:
-// * The unique placetype ID for a placetype
-// * The set of string names (including "alternate" placetypes) associated with a placetype
+// DEFAULT_PLACETYPE_WEIGHTS maps placetypes to their relative importance, from 0 to 100. Placetypes that are not listed
+// (including custom placetypes) have a weight of 0.
+var DEFAULT_PLACETYPE_WEIGHTS = map[string]int{
+	"planet":        100,
+	"continent":     95,
+	"empire":        90,
+	"country":       90,
+	"dependency":    85,
+	"disputed":      85,
+	"ocean":         80,
+	"marinearea":    80,
+	"macroregion":   80,
+	"region":        75,
+	"macrocounty":   70,
+	"county":        65,
+	"metroarea":     65,
+	"localadmin":    60,
+	"locality":      60,
+	"borough":       50,
+	"macrohood":     45,
+	"neighbourhood": 40,
+	"microhood":     30,
+	"campus":        30,
+	"postalregion":  20,
+	"postalcode":    20,
+	"building":      15,
+	"venue":         10,
+	"concourse":     5,
+	"arcade":        5,
+	"wing":          5,
+	"enclosure":     5,
+	"installation":  5,
+	"intersection":  5,
+	"address":       5,
+}
+
+var default_spec *placetypes.WOFPlacetypeSpecification
+var default_spec_err error
+var default_spec_once sync.Once
+
+// defaultPlacetypeSpecification returns the (cached) default `placetypes.WOFPlacetypeSpecification` instance.
+func defaultPlacetypeSpecification() (*placetypes.WOFPlacetypeSpecification, error) {
+
+	default_spec_once.Do(func() {
+		default_spec, default_spec_err = placetypes.DefaultWOFPlacetypeSpecification()
+	})
+
+	return default_spec, default_spec_err
+}
+
+// NewPlacetypeSpecificationWithReader returns a new `placetypes.WOFPlacetypeSpecification` instance containing the
+// placetypes defined in the default specification and those read from 'r' (using `placetypes.NewWOFPlacetypeSpecificationWithReader`).
+// This allows custom specifications to only define additional placetypes (for example "gate", "terminal" or "wing") whose
+// parents are defined in the default specification. Placetypes in 'r' replace default placetypes with the same ID.
+func NewPlacetypeSpecificationWithReader(ctx context.Context, r io.Reader) (*placetypes.WOFPlacetypeSpecification, error) {
+
+	custom_spec, err := placetypes.NewWOFPlacetypeSpecificationWithReader(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read placetypes specification, %w", err)
+	}
+
+	spec, err := defaultPlacetypeSpecification()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load default placetypes specification, %w", err)
+	}
+
+	// Note that placetypes.AppendPlacetypeSpecification can't be used because the placetypes returned
+	// by the Catalog method don't have an ID (it is stored in the key).
+
+	catalog := make(map[string]placetypes.WOFPlacetype)
+
+	for str_id, pt := range spec.Catalog() {
+		catalog[str_id] = pt
+	}
+
+	for str_id, pt := range custom_spec.Catalog() {
+		catalog[str_id] = pt
+	}
+
+	enc_catalog, err := json.Marshal(catalog)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal placetypes specification, %w", err)
+	}
+
+	return placetypes.NewWOFPlacetypeSpecification(enc_catalog)
+}
+
+// type AppendPlacetypeDetailsOptions defines configuration options for appending placetype details to a Who's On First document.
+type AppendPlacetypeDetailsOptions struct {
+	// Specification is an optional `placetypes.WOFPlacetypeSpecification` instance used to resolve placetypes. If nil the
+	// default specification is used. See also `NewPlacetypeSpecificationWithReader`.
+	Specification *placetypes.WOFPlacetypeSpecification
+}
+
+// AppendPlacetypeDetails appends addition properties related to the `wof:placetype` and `wof:placetype_alt` properties in a Who's On First record
+// using the default placetypes specification. See `NewAppendPlacetypeDetailsFunc` for details.
 func AppendPlacetypeDetails(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendPlacetypeDetailsOptions{}
+	return appendPlacetypeDetails(ctx, body, opts)
+}
+
+// NewAppendPlacetypeDetailsFunc returns a `PrepareDocumentFunc` that appends addition properties related to the `wof:placetype`
+// and `wof:placetype_alt` properties in a Who's On First record. Specifically:
+// * The unique placetype ID for a placetype (`wof:placetype_id`)
+// * The set of string names (including "alternate" placetypes) associated with a placetype (`wof:placetype_names`)
+// * The role of a placetype (`wof:placetype_role`)
+// * The names of all the ancestor and descendant placetypes of a placetype (`wof:placetype_ancestors`, `wof:placetype_descendants`)
+// * The names of the ancestor and descendant placetypes of a placetype grouped by role (for example `wof:placetype_ancestors_common`)
+// Placetypes are resolved using `opts.Specification`. Placetypes that can not be resolved are still assigned `wof:placetype_names`
+// and are counted in the `placetype_details:unknown_placetype` key of the `Report` associated with the context, if present.
+func NewAppendPlacetypeDetailsFunc(ctx context.Context, opts *AppendPlacetypeDetailsOptions) (PrepareDocumentFunc, error) {
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendPlacetypeDetails(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendPlacetypeDetails(ctx context.Context, body []byte, opts *AppendPlacetypeDetailsOptions) ([]byte, error) {
 
 	root := gjson.ParseBytes(body)
 
@@ -32,31 +155,110 @@ func AppendPlacetypeDetails(ctx context.Context, body []byte) ([]byte, error) {
 
 	str_pt := pt_rsp.String()
 
-	if !placetypes.IsValidPlacetype(str_pt) {
-		return body, nil
-	}
+	spec := opts.Specification
 
-	pt, err := placetypes.GetPlacetypeByName(str_pt)
+	if spec == nil {
 
-	if err != nil {
-		return nil, err
+		s, err := defaultPlacetypeSpecification()
+
+		if err != nil {
+			return nil, err
+		}
+
+		spec = s
 	}
 
 	placetype_names := []string{
-		pt.Name,
+		str_pt,
 	}
 
+	// wof:placetype_alt may be either a string or a list of strings
+
 	alt_rsp := root.Get("wof:placetype_alt")
 
 	if alt_rsp.Exists() {
-		placetype_names = append(placetype_names, alt_rsp.String())
+
+		alt_names := []gjson.Result{
+			alt_rsp,
+		}
+
+		if alt_rsp.IsArray() {
+			alt_names = alt_rsp.Array()
+		}
+
+		for _, n := range alt_names {
+
+			name := n.String()
+
+			if name == "" {
+				continue
+			}
+
+			is_dupe := false
+
+			for _, existing := range placetype_names {
+
+				if existing == name {
+					is_dupe = true
+					break
+				}
+			}
+
+			if !is_dupe {
+				placetype_names = append(placetype_names, name)
+			}
+		}
 	}
 
 	details := map[string]interface{}{
-		"wof:placetype_id":    pt.Id,
 		"wof:placetype_names": placetype_names,
 	}
 
+	pt, err := spec.GetPlacetypeByName(str_pt)
+
+	if err != nil {
+		ReportFromContext(ctx).Increment("placetype_details:unknown_placetype", 1)
+	} else {
+
+		details["wof:placetype_id"] = pt.Id
+		details["wof:placetype_role"] = pt.Role
+
+		relations := map[string][]*placetypes.WOFPlacetype{
+			"ancestors":   placetypeAncestors(spec, pt),
+			"descendants": placetypeDescendants(spec, pt),
+		}
+
+		for label, related := range relations {
+
+			names := make([]string, 0)
+			by_role := make(map[string][]string)
+
+			for _, r := range related {
+
+				names = append(names, r.Name)
+
+				role_names, ok := by_role[r.Role]
+
+				if !ok {
+					role_names = make([]string, 0)
+				}
+
+				by_role[r.Role] = append(role_names, r.Name)
+			}
+
+			details[fmt.Sprintf("wof:placetype_%s", label)] = names
+
+			for role, role_names := range by_role {
+
+				if role == "" {
+					continue
+				}
+
+				details[fmt.Sprintf("wof:placetype_%s_%s", label, role)] = role_names
+			}
+		}
+	}
+
 	for k, v := range details {
 
 		path := k
@@ -74,3 +276,105 @@ func AppendPlacetypeDetails(ctx context.Context, body []byte) ([]byte, error) {
 
 	return body, nil
 }
+
+// placetypeAncestors returns the ancestors of 'pt' defined in 'spec', of any role, ordered from nearest to farthest.
+// The package-level `placetypes.Ancestors` method only uses the default specification so this is a separate traversal.
+func placetypeAncestors(spec *placetypes.WOFPlacetypeSpecification, pt *placetypes.WOFPlacetype) []*placetypes.WOFPlacetype {
+
+	ancestors := make([]*placetypes.WOFPlacetype, 0)
+	seen := map[int64]bool{
+		pt.Id: true,
+	}
+
+	queue := []*placetypes.WOFPlacetype{
+		pt,
+	}
+
+	for len(queue) > 0 {
+
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, pid := range current.Parent {
+
+			if seen[pid] {
+				continue
+			}
+
+			seen[pid] = true
+
+			parent, err := spec.GetPlacetypeById(pid)
+
+			if err != nil {
+				continue
+			}
+
+			ancestors = append(ancestors, parent)
+			queue = append(queue, parent)
+		}
+	}
+
+	return ancestors
+}
+
+// placetypeDescendants returns the descendants of 'pt' defined in 'spec', of any role, ordered from nearest to farthest.
+// The package-level `placetypes.Descendants` method only uses the default specification so this is a separate traversal.
+func placetypeDescendants(spec *placetypes.WOFPlacetypeSpecification, pt *placetypes.WOFPlacetype) []*placetypes.WOFPlacetype {
+
+	children := make(map[int64][]*placetypes.WOFPlacetype)
+
+	catalog := spec.Catalog()
+
+	str_ids := make([]string, 0, len(catalog))
+
+	for str_id, _ := range catalog {
+		str_ids = append(str_ids, str_id)
+	}
+
+	sort.Strings(str_ids)
+
+	for _, str_id := range str_ids {
+
+		id, err := strconv.ParseInt(str_id, 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		child := catalog[str_id]
+		child.Id = id
+
+		for _, pid := range child.Parent {
+			children[pid] = append(children[pid], &child)
+		}
+	}
+
+	descendants := make([]*placetypes.WOFPlacetype, 0)
+	seen := map[int64]bool{
+		pt.Id: true,
+	}
+
+	queue := []int64{
+		pt.Id,
+	}
+
+	for len(queue) > 0 {
+
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, child := range children[current] {
+
+			if seen[child.Id] {
+				continue
+			}
+
+			seen[child.Id] = true
+
+			descendants = append(descendants, child)
+			queue = append(queue, child.Id)
+		}
+	}
+
+	return descendants
+}
@@ -0,0 +1,90 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"strings"
+	"testing"
+)
+
+func TestAppendPlacetypeDetails(t *testing.T) {
+
+	ctx := context.Background()
+
+	custom := `{"900000001": {"role": "custom", "name": "terminal", "parent": [102312331], "names": {}}, "900000002": {"role": "custom", "name": "gate", "parent": [900000001], "names": {}}}`
+
+	spec, err := NewPlacetypeSpecificationWithReader(ctx, strings.NewReader(custom))
+
+	if err != nil {
+		t.Fatalf("Failed to create placetypes specification, %v", err)
+	}
+
+	opts := &AppendPlacetypeDetailsOptions{
+		Specification: spec,
+	}
+
+	pt_func, err := NewAppendPlacetypeDetailsFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create placetype details func, %v", err)
+	}
+
+	body := `{"properties": {"wof:placetype": "terminal", "wof:placetype_alt": ["building", "concourse"]}}`
+
+	new_body, err := pt_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append placetype details, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "properties.wof:placetype_id").Int() != 900000001 {
+		t.Fatalf("Unexpected placetype ID, %s", string(new_body))
+	}
+
+	names := gjson.GetBytes(new_body, "properties.wof:placetype_names").Array()
+
+	if len(names) != 3 {
+		t.Fatalf("Unexpected placetype names, %s", string(new_body))
+	}
+
+	contains := func(path string, name string) bool {
+
+		for _, v := range gjson.GetBytes(new_body, path).Array() {
+
+			if v.String() == name {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	expected := map[string][]string{
+		"properties.wof:placetype_ancestors":          []string{"campus", "locality", "country", "planet"},
+		"properties.wof:placetype_ancestors_common":   []string{"locality", "country"},
+		"properties.wof:placetype_descendants":        []string{"gate"},
+		"properties.wof:placetype_descendants_custom": []string{"gate"},
+	}
+
+	for path, pt_names := range expected {
+
+		for _, name := range pt_names {
+
+			if !contains(path, name) {
+				t.Fatalf("Expected %s to contain %s, %s", path, name, string(new_body))
+			}
+		}
+	}
+
+	// Placetypes not in the default specification are not dropped
+
+	new_body, err = AppendPlacetypeDetails(ctx, []byte(`{"properties": {"wof:placetype": "gate", "wof:placetype_alt": "door"}}`))
+
+	if err != nil {
+		t.Fatalf("Failed to append placetype details, %v", err)
+	}
+
+	if len(gjson.GetBytes(new_body, "properties.wof:placetype_names").Array()) != 2 {
+		t.Fatalf("Unexpected placetype names for unknown placetype, %s", string(new_body))
+	}
+}
@@ -0,0 +1,241 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"math"
+	"strings"
+)
+
+// SEARCH_RANK_PROPERTY is the property containing the normalized search rank of a Who's On First record.
+const SEARCH_RANK_PROPERTY string = "search:rank"
+
+// MIN_SEARCH_RANK is the smallest search rank assigned to a record. Elasticsearch `rank_feature` fields only accept
+// strictly positive values.
+const MIN_SEARCH_RANK float64 = 0.0001
+
+// The values used to normalize signals to a value between 0 and 1. Signals larger than these values are capped.
+const (
+	search_rank_max_population   float64 = 1000000000
+	search_rank_max_languages    float64 = 256
+	search_rank_max_concordances float64 = 32
+)
+
+// type SearchRankWeights defines the relative weights of the signals used to derive a search rank.
+type SearchRankWeights struct {
+	// Population is the weight of the larger of the `wof:population` and `gn:population` properties (scaled logarithmically).
+	Population float64
+	// Placetype is the weight of the placetype, as defined by `DEFAULT_PLACETYPE_WEIGHTS`.
+	Placetype float64
+	// Translations is the weight of the number of languages with names (scaled logarithmically).
+	Translations float64
+	// Concordances is the weight of the number of concordances (scaled logarithmically).
+	Concordances float64
+	// Current is the weight of records whose lifecycle status is `LIFECYCLE_CURRENT`. Records whose status is
+	// `LIFECYCLE_UNKNOWN` are assigned half this weight.
+	Current float64
+	// Deprecated is the factor, between 0 and 1, that the ranks of deprecated records are multiplied by.
+	Deprecated float64
+}
+
+// DEFAULT_SEARCH_RANK_WEIGHTS are the default weights used to derive a search rank.
+var DEFAULT_SEARCH_RANK_WEIGHTS = SearchRankWeights{
+	Population:   0.40,
+	Placetype:    0.30,
+	Translations: 0.15,
+	Concordances: 0.10,
+	Current:      0.05,
+	Deprecated:   0.10,
+}
+
+// type AppendSearchRankOptions defines configuration options for appending a search rank to a Who's On First document.
+type AppendSearchRankOptions struct {
+	// Weights are the relative weights of the signals used to derive a search rank. If nil `DEFAULT_SEARCH_RANK_WEIGHTS` is used.
+	Weights *SearchRankWeights
+	// PlacetypeWeights maps placetypes to their relative importance, from 0 to 100. Default is `DEFAULT_PLACETYPE_WEIGHTS`.
+	PlacetypeWeights map[string]int
+}
+
+// AppendSearchRank appends a normalized search rank to a Who's On First document using the default weights. See
+// `NewAppendSearchRankFunc` for details.
+func AppendSearchRank(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendSearchRankOptions{}
+	return appendSearchRank(ctx, body, opts)
+}
+
+// NewAppendSearchRankFunc returns a `PrepareDocumentFunc` that appends a normalized search rank (`search:rank`), between
+// `MIN_SEARCH_RANK` and 1, to a Who's On First document. The rank is the weighted average, using `opts.Weights`, of the
+// following signals, each normalized to a value between 0 and 1:
+// * The larger of the `wof:population` and `gn:population` properties.
+// * The placetype.
+// * The number of languages with names (`counts:names_languages` if present).
+// * The number of concordances (`counts:concordances_total`, produced by `AppendConcordancesStats`, if present).
+// * Whether the record is current.
+// The rank of deprecated records is then multiplied by `opts.Weights.Deprecated`. The `search:rank` property is suitable
+// for use in `function_score` queries or, when mapped as a `rank_feature` field, `rank_feature` queries.
+func NewAppendSearchRankFunc(ctx context.Context, opts *AppendSearchRankOptions) (PrepareDocumentFunc, error) {
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendSearchRank(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendSearchRank(ctx context.Context, body []byte, opts *AppendSearchRankOptions) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	weights := opts.Weights
+
+	if weights == nil {
+		weights = &DEFAULT_SEARCH_RANK_WEIGHTS
+	}
+
+	placetype_weights := opts.PlacetypeWeights
+
+	if placetype_weights == nil {
+		placetype_weights = DEFAULT_PLACETYPE_WEIGHTS
+	}
+
+	// Population
+
+	population := int64(0)
+
+	for _, k := range []string{"wof:population", "gn:population"} {
+
+		p := root.Get(k).Int()
+
+		if p > population {
+			population = p
+		}
+	}
+
+	// Translations
+
+	count_languages := 0
+
+	languages_rsp := root.Get("counts:names_languages")
+
+	if languages_rsp.Exists() {
+		count_languages = int(languages_rsp.Int())
+	} else {
+
+		languages := make(map[string]bool)
+
+		for k, _ := range root.Map() {
+
+			if !strings.HasPrefix(k, "name:") {
+				continue
+			}
+
+			nk, ok := parseNameKey(k)
+
+			if ok {
+				languages[nk.Language] = true
+			}
+		}
+
+		count_languages = len(languages)
+	}
+
+	// Concordances
+
+	count_concordances := 0
+
+	concordances_rsp := root.Get("counts:concordances_total")
+
+	if concordances_rsp.Exists() {
+		count_concordances = int(concordances_rsp.Int())
+	} else {
+		count_concordances = len(root.Get("wof:concordances").Map())
+	}
+
+	// Lifecycle
+
+	lc := deriveLifecycle(root)
+
+	current := 0.0
+
+	switch lc.Status {
+	case LIFECYCLE_CURRENT:
+		current = 1.0
+	case LIFECYCLE_UNKNOWN:
+		current = 0.5
+	}
+
+	signals := []float64{
+		logScale(float64(population), search_rank_max_population),
+		float64(placetype_weights[root.Get("wof:placetype").String()]) / 100.0,
+		logScale(float64(count_languages), search_rank_max_languages),
+		logScale(float64(count_concordances), search_rank_max_concordances),
+		current,
+	}
+
+	signal_weights := []float64{
+		weights.Population,
+		weights.Placetype,
+		weights.Translations,
+		weights.Concordances,
+		weights.Current,
+	}
+
+	total_weight := 0.0
+	rank := 0.0
+
+	for idx, w := range signal_weights {
+
+		if w <= 0 {
+			continue
+		}
+
+		rank += math.Min(signals[idx], 1.0) * w
+		total_weight += w
+	}
+
+	if total_weight > 0 {
+		rank = rank / total_weight
+	}
+
+	if lc.IsDeprecated {
+		rank = rank * weights.Deprecated
+	}
+
+	rank = math.Round(rank*1000000) / 1000000
+
+	if rank < MIN_SEARCH_RANK {
+		rank = MIN_SEARCH_RANK
+	}
+
+	path := SEARCH_RANK_PROPERTY
+
+	if props_rsp.Exists() {
+		path = fmt.Sprintf("properties.%s", path)
+	}
+
+	body, err := sjson.SetBytes(body, path, rank)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+	}
+
+	return body, nil
+}
+
+// logScale returns the logarithm of 'v' relative to the logarithm of 'max', a value between 0 and 1 (for values of 'v' up to 'max').
+func logScale(v float64, max float64) float64 {
+
+	if v <= 0 {
+		return 0
+	}
+
+	return math.Log10(v+1) / math.Log10(max+1)
+}
@@ -0,0 +1,68 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendSearchRank(t *testing.T) {
+
+	ctx := context.Background()
+
+	city := `{"properties": {"wof:name": "Springfield", "wof:placetype": "locality", "wof:population": 167882, "mz:is_current": 1, "name:eng_x_preferred": ["Springfield"], "name:fra_x_preferred": ["Springfield"], "name:rus_x_preferred": ["Спрингфилд"], "wof:concordances": {"gn:id": 4409896, "wd:id": "Q28515", "qs_pg:id": 1089232}}}`
+	hamlet := `{"properties": {"wof:name": "Springfield", "wof:placetype": "locality", "gn:population": 40, "mz:is_current": 1, "name:eng_x_preferred": ["Springfield"]}}`
+	deprecated := `{"properties": {"wof:name": "Springfield", "wof:placetype": "locality", "wof:population": 167882, "edtf:deprecated": "2019-01-01", "name:eng_x_preferred": ["Springfield"]}}`
+
+	rank := func(body string, opts *AppendSearchRankOptions) float64 {
+
+		rank_func, err := NewAppendSearchRankFunc(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create search rank func, %v", err)
+		}
+
+		new_body, err := rank_func(ctx, []byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to append search rank, %v", err)
+		}
+
+		return gjson.GetBytes(new_body, "properties.search:rank").Float()
+	}
+
+	opts := &AppendSearchRankOptions{}
+
+	city_rank := rank(city, opts)
+	hamlet_rank := rank(hamlet, opts)
+	deprecated_rank := rank(deprecated, opts)
+
+	if city_rank <= 0 || city_rank > 1 {
+		t.Fatalf("Search rank out of range: %f", city_rank)
+	}
+
+	if city_rank <= hamlet_rank {
+		t.Fatalf("Expected city rank (%f) to be greater than hamlet rank (%f)", city_rank, hamlet_rank)
+	}
+
+	if deprecated_rank >= hamlet_rank {
+		t.Fatalf("Expected deprecated rank (%f) to be less than hamlet rank (%f)", deprecated_rank, hamlet_rank)
+	}
+
+	// Only consider placetypes
+
+	opts = &AppendSearchRankOptions{
+		Weights: &SearchRankWeights{
+			Placetype:  1.0,
+			Deprecated: 1.0,
+		},
+	}
+
+	if rank(city, opts) != rank(hamlet, opts) {
+		t.Fatalf("Expected identical ranks when only placetypes are weighted")
+	}
+
+	if rank(`{"properties": {"wof:placetype": "venue"}}`, opts) != 0.1 {
+		t.Fatalf("Unexpected rank for venue")
+	}
+}
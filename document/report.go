@@ -0,0 +1,103 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+type report_key struct{}
+
+// type Report is a thread-safe collection of named counters used by `PrepareDocumentFunc` functions to
+// record details about the documents they have processed. For example, the number of geometries that were
+// repaired or the number of malformed properties encountered. Reports are associated with a `context.Context`
+// instance using the `WithReport` method and retrieved using the `ReportFromContext` method. All the methods
+// for a `Report` are safe to call on a nil instance in which case they are no-ops.
+type Report struct {
+	mu     *sync.RWMutex
+	counts map[string]int64
+}
+
+// NewReport returns a new (empty) `Report` instance.
+func NewReport() *Report {
+
+	r := &Report{
+		mu:     new(sync.RWMutex),
+		counts: make(map[string]int64),
+	}
+
+	return r
+}
+
+// WithReport returns a copy of 'ctx' with 'r' associated with it.
+func WithReport(ctx context.Context, r *Report) context.Context {
+	return context.WithValue(ctx, report_key{}, r)
+}
+
+// ReportFromContext returns the `Report` instance associated with 'ctx' or nil if there isn't one.
+func ReportFromContext(ctx context.Context) *Report {
+
+	v := ctx.Value(report_key{})
+
+	if v == nil {
+		return nil
+	}
+
+	r, ok := v.(*Report)
+
+	if !ok {
+		return nil
+	}
+
+	return r
+}
+
+// Increment adds 'delta' to the counter 'key'.
+func (r *Report) Increment(key string, delta int64) {
+
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counts[key] += delta
+}
+
+// Count returns the current value of the counter 'key'.
+func (r *Report) Count(key string) int64 {
+
+	if r == nil {
+		return 0
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.counts[key]
+}
+
+// Counts returns a copy of all the counters in 'r'.
+func (r *Report) Counts() map[string]int64 {
+
+	counts := make(map[string]int64)
+
+	if r == nil {
+		return counts
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for k, v := range r.counts {
+		counts[k] = v
+	}
+
+	return counts
+}
+
+// MarshalJSON returns the JSON-encoded representation of the counters in 'r'.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Counts())
+}
@@ -0,0 +1,434 @@
+package document
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"math"
+)
+
+// SIMPLIFY_DOUGLAS_PEUCKER is the name of the Douglas-Peucker simplification algorithm.
+const SIMPLIFY_DOUGLAS_PEUCKER string = "douglas-peucker"
+
+// SIMPLIFY_VISVALINGAM is the name of the Visvalingam-Whyatt simplification algorithm.
+const SIMPLIFY_VISVALINGAM string = "visvalingam"
+
+// type SimplifyGeometryOptions defines configuration options for simplifying GeoJSON geometries and reducing their coordinate precision.
+type SimplifyGeometryOptions struct {
+	// Algorithm is the name of the simplification algorithm to use. Valid options are `SIMPLIFY_DOUGLAS_PEUCKER`
+	// and `SIMPLIFY_VISVALINGAM`. If empty geometries are not simplified.
+	Algorithm string
+	// Tolerance is the simplification tolerance. For the Douglas-Peucker algorithm this is the maximum distance,
+	// in decimal degrees, between a point and the simplified line. For the Visvalingam-Whyatt algorithm this is
+	// the minimum area, in square decimal degrees, of the triangle formed by a point and its neighbours.
+	Tolerance float64
+	// MaxVertices is the number of vertices above which a geometry will be simplified. If 0 this test is not applied.
+	MaxVertices int
+	// MaxBytes is the size, in bytes, of a JSON-encoded geometry above which it will be simplified. If 0 this test is not applied.
+	MaxBytes int
+	// Precision is the number of decimal places to round coordinates to. If 0 coordinates are not rounded.
+	Precision int
+	// OriginalGeometryPath is an optional path, relative to the root of a document, where the original (unsimplified)
+	// geometry will be stored. If empty the original geometry is discarded. Elasticsearch mappings should exclude
+	// this path from the `_source` property so that the original geometry is indexed but not stored.
+	OriginalGeometryPath string
+}
+
+// NewSimplifyGeometryFunc returns a `PrepareDocumentFunc` that reduces the coordinate precision of, and simplifies, the
+// GeoJSON `geometry` property of a Who's On First document. Coordinate precision is reduced for all documents if
+// `opts.Precision` is greater than zero. Geometries are simplified if `opts.Algorithm` is not empty and the number of
+// vertices or the size of the geometry exceed `opts.MaxVertices` or `opts.MaxBytes` respectively. If both thresholds
+// are zero every geometry is simplified. Rings or lines that would be collapsed by simplification are left unchanged.
+//
+// Simplified documents are assigned `geom:simplified` (the name of the algorithm), `geom:simplified_vertices_original`
+// and `geom:simplified_vertices` properties. If a `Report` is associated with the context passed to the function the
+// number of documents simplified and the number of vertices and bytes removed are counted there too.
+//
+// Note that simplification may introduce self-intersections so this function should be applied before any validation
+// functions (for example `ValidateGeometry`).
+func NewSimplifyGeometryFunc(ctx context.Context, opts *SimplifyGeometryOptions) (PrepareDocumentFunc, error) {
+
+	switch opts.Algorithm {
+	case "", SIMPLIFY_DOUGLAS_PEUCKER, SIMPLIFY_VISVALINGAM:
+		// pass
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported simplification algorithm '%s'", opts.Algorithm)
+	}
+
+	if opts.Tolerance < 0 {
+		return nil, fmt.Errorf("Invalid simplification tolerance")
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return simplifyGeometry(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func simplifyGeometry(ctx context.Context, body []byte, opts *SimplifyGeometryOptions) ([]byte, error) {
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if !geom_rsp.Exists() || geom_rsp.Type == gjson.Null {
+		return body, nil
+	}
+
+	report := ReportFromContext(ctx)
+
+	g, err := parseGeometry(geom_rsp)
+
+	if err != nil {
+		report.Increment("simplify_geometry:error", 1)
+		return body, nil
+	}
+
+	count_bytes := len(geom_rsp.Raw)
+	count_vertices := len(g.vertices())
+
+	do_simplify := opts.Algorithm != ""
+
+	if do_simplify && (opts.MaxVertices > 0 || opts.MaxBytes > 0) {
+
+		exceeds_vertices := opts.MaxVertices > 0 && count_vertices > opts.MaxVertices
+		exceeds_bytes := opts.MaxBytes > 0 && count_bytes > opts.MaxBytes
+
+		do_simplify = exceeds_vertices || exceeds_bytes
+	}
+
+	do_round := opts.Precision > 0
+
+	if !do_simplify && !do_round {
+		return body, nil
+	}
+
+	new_g := g
+
+	if do_round {
+
+		scale := math.Pow(10, float64(opts.Precision))
+
+		new_g = new_g.transform(func(points []point, is_ring bool) []point {
+			return roundPoints(points, scale)
+		})
+	}
+
+	if do_simplify {
+
+		new_g = new_g.transform(func(points []point, is_ring bool) []point {
+
+			switch opts.Algorithm {
+			case SIMPLIFY_VISVALINGAM:
+				return simplifyVisvalingam(points, opts.Tolerance, is_ring)
+			default:
+				return simplifyDouglasPeucker(points, opts.Tolerance, is_ring)
+			}
+		})
+	}
+
+	new_value := new_g.value()
+
+	enc_geom, err := json.Marshal(new_value)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal simplified geometry, %w", err)
+	}
+
+	if opts.OriginalGeometryPath != "" && do_simplify {
+
+		body, err = sjson.SetRawBytes(body, opts.OriginalGeometryPath, []byte(geom_rsp.Raw))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", opts.OriginalGeometryPath, err)
+		}
+	}
+
+	body, err = sjson.SetRawBytes(body, "geometry", enc_geom)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign simplified geometry, %w", err)
+	}
+
+	new_count_vertices := len(new_g.vertices())
+
+	if do_round {
+		report.Increment("simplify_geometry:rounded", 1)
+	}
+
+	report.Increment("simplify_geometry:vertices_removed", int64(count_vertices-new_count_vertices))
+	report.Increment("simplify_geometry:bytes_removed", int64(count_bytes-len(enc_geom)))
+
+	if !do_simplify {
+		return body, nil
+	}
+
+	report.Increment("simplify_geometry:simplified", 1)
+
+	to_assign := map[string]interface{}{
+		"geom:simplified":                   opts.Algorithm,
+		"geom:simplified_vertices_original": count_vertices,
+		"geom:simplified_vertices":          new_count_vertices,
+	}
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+// roundPoints rounds the x and y ordinates of each point in 'points' to the precision defined by 'scale' and
+// removes any consecutive duplicate points that result. Any additional ordinates are retained unchanged.
+func roundPoints(points []point, scale float64) []point {
+
+	rounded := make([]point, 0, len(points))
+
+	for _, pt := range points {
+
+		new_pt := pt.withXY(
+			math.Round(pt[0]*scale)/scale,
+			math.Round(pt[1]*scale)/scale,
+		)
+
+		if len(rounded) > 0 && rounded[len(rounded)-1].equals(new_pt) {
+			continue
+		}
+
+		rounded = append(rounded, new_pt)
+	}
+
+	return rounded
+}
+
+// simplifyDouglasPeucker simplifies 'points' using the Douglas-Peucker algorithm. Closed rings are split at
+// the point farthest from their first point so that both halves are simplified independently.
+func simplifyDouglasPeucker(points []point, tolerance float64, is_ring bool) []point {
+
+	count := len(points)
+
+	if count < 3 {
+		return points
+	}
+
+	keep := make([]bool, count)
+	keep[0] = true
+	keep[count-1] = true
+
+	type span struct {
+		start int
+		end   int
+	}
+
+	stack := make([]span, 0)
+
+	if is_ring {
+
+		farthest := 0
+		max_dist := -1.0
+
+		for i := 1; i < count-1; i++ {
+
+			d := math.Hypot(points[i][0]-points[0][0], points[i][1]-points[0][1])
+
+			if d > max_dist {
+				max_dist = d
+				farthest = i
+			}
+		}
+
+		keep[farthest] = true
+
+		stack = append(stack, span{0, farthest}, span{farthest, count - 1})
+
+	} else {
+		stack = append(stack, span{0, count - 1})
+	}
+
+	for len(stack) > 0 {
+
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if s.end-s.start < 2 {
+			continue
+		}
+
+		idx := -1
+		max_dist := -1.0
+
+		for i := s.start + 1; i < s.end; i++ {
+
+			d := perpendicularDistance(points[i], points[s.start], points[s.end])
+
+			if d > max_dist {
+				max_dist = d
+				idx = i
+			}
+		}
+
+		if max_dist > tolerance {
+			keep[idx] = true
+			stack = append(stack, span{s.start, idx}, span{idx, s.end})
+		}
+	}
+
+	simplified := make([]point, 0)
+
+	for i, pt := range points {
+
+		if keep[i] {
+			simplified = append(simplified, pt)
+		}
+	}
+
+	return simplified
+}
+
+func perpendicularDistance(pt point, a point, b point) float64 {
+
+	dx := b[0] - a[0]
+	dy := b[1] - a[1]
+
+	if dx == 0.0 && dy == 0.0 {
+		return math.Hypot(pt[0]-a[0], pt[1]-a[1])
+	}
+
+	return math.Abs(dy*pt[0]-dx*pt[1]+b[0]*a[1]-b[1]*a[0]) / math.Hypot(dx, dy)
+}
+
+type vwVertex struct {
+	idx     int
+	area    float64
+	prev    int
+	next    int
+	removed bool
+	offset  int
+}
+
+type vwQueue []*vwVertex
+
+func (q vwQueue) Len() int { return len(q) }
+
+func (q vwQueue) Less(i, j int) bool { return q[i].area < q[j].area }
+
+func (q vwQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].offset = i
+	q[j].offset = j
+}
+
+func (q *vwQueue) Push(x interface{}) {
+	v := x.(*vwVertex)
+	v.offset = len(*q)
+	*q = append(*q, v)
+}
+
+func (q *vwQueue) Pop() interface{} {
+	old := *q
+	count := len(old)
+	v := old[count-1]
+	*q = old[0 : count-1]
+	return v
+}
+
+// simplifyVisvalingam simplifies 'points' using the Visvalingam-Whyatt algorithm, repeatedly removing the point
+// whose triangle with its neighbours has the smallest area until every remaining triangle is larger than 'tolerance'.
+// The first and last points (which are the same point for closed rings) are always retained.
+func simplifyVisvalingam(points []point, tolerance float64, is_ring bool) []point {
+
+	count := len(points)
+
+	min_count := 2
+
+	if is_ring {
+		min_count = 4
+	}
+
+	if count <= min_count {
+		return points
+	}
+
+	triangle := func(a point, b point, c point) float64 {
+		return math.Abs((a[0]*(b[1]-c[1]) + b[0]*(c[1]-a[1]) + c[0]*(a[1]-b[1])) / 2.0)
+	}
+
+	vertices := make([]*vwVertex, count)
+	q := make(vwQueue, 0, count)
+
+	for i := 0; i < count; i++ {
+
+		v := &vwVertex{
+			idx:  i,
+			prev: i - 1,
+			next: i + 1,
+			area: math.Inf(1),
+		}
+
+		if i > 0 && i < count-1 {
+			v.area = triangle(points[i-1], points[i], points[i+1])
+			heap.Push(&q, v)
+		}
+
+		vertices[i] = v
+	}
+
+	remaining := count
+
+	for q.Len() > 0 && remaining > min_count {
+
+		v := heap.Pop(&q).(*vwVertex)
+
+		if v.area > tolerance {
+			break
+		}
+
+		v.removed = true
+		remaining -= 1
+
+		prev := vertices[v.prev]
+		next := vertices[v.next]
+
+		prev.next = v.next
+		next.prev = v.prev
+
+		for _, n := range []*vwVertex{prev, next} {
+
+			if n.idx == 0 || n.idx == count-1 {
+				continue
+			}
+
+			area := triangle(points[n.prev], points[n.idx], points[n.next])
+
+			// Ensure that a point can not be removed before the point that was previously removed
+			n.area = math.Max(area, v.area)
+			heap.Fix(&q, n.offset)
+		}
+	}
+
+	simplified := make([]point, 0, remaining)
+
+	for i, v := range vertices {
+
+		if !v.removed {
+			simplified = append(simplified, points[i])
+		}
+	}
+
+	return simplified
+}
@@ -0,0 +1,110 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestSimplifyGeometry(t *testing.T) {
+
+	ctx := context.Background()
+
+	report := NewReport()
+	ctx = WithReport(ctx, report)
+
+	body := `{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[0.5,0.000001],[1,0],[1,0.5],[1.000001,1],[0,1],[0,0]]]}}`
+
+	for _, algorithm := range []string{SIMPLIFY_DOUGLAS_PEUCKER, SIMPLIFY_VISVALINGAM} {
+
+		opts := &SimplifyGeometryOptions{
+			Algorithm:            algorithm,
+			Tolerance:            0.001,
+			Precision:            4,
+			OriginalGeometryPath: "original_geometry",
+		}
+
+		simplify_func, err := NewSimplifyGeometryFunc(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create simplify func for %s, %v", algorithm, err)
+		}
+
+		new_body, err := simplify_func(ctx, []byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to simplify geometry with %s, %v", algorithm, err)
+		}
+
+		count := len(gjson.GetBytes(new_body, "geometry.coordinates.0").Array())
+
+		if count != 5 {
+			t.Fatalf("Expected 5 points after simplifying with %s, got %d (%s)", algorithm, count, string(new_body))
+		}
+
+		if gjson.GetBytes(new_body, "properties.geom:simplified").String() != algorithm {
+			t.Fatalf("Missing geom:simplified property, %s", string(new_body))
+		}
+
+		if !gjson.GetBytes(new_body, "original_geometry").Exists() {
+			t.Fatalf("Missing original geometry, %s", string(new_body))
+		}
+	}
+
+	if report.Count("simplify_geometry:simplified") != 2 {
+		t.Fatalf("Unexpected simplified count, %d", report.Count("simplify_geometry:simplified"))
+	}
+
+	opts := &SimplifyGeometryOptions{
+		Algorithm:   SIMPLIFY_DOUGLAS_PEUCKER,
+		Tolerance:   0.001,
+		MaxVertices: 100,
+	}
+
+	simplify_func, err := NewSimplifyGeometryFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create simplify func, %v", err)
+	}
+
+	new_body, err := simplify_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to simplify geometry, %v", err)
+	}
+
+	if string(new_body) != body {
+		t.Fatalf("Geometry below threshold was modified, %s", string(new_body))
+	}
+}
+
+func TestSimplifyGeometryPreservesZ(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"type": "Feature", "properties": {}, "geometry": {"type": "LineString", "coordinates": [[0,0,5],[0.5,0.000001,6],[1.123456,0,7]]}}`
+
+	opts := &SimplifyGeometryOptions{
+		Algorithm: SIMPLIFY_DOUGLAS_PEUCKER,
+		Tolerance: 0.001,
+		Precision: 4,
+	}
+
+	simplify_func, err := NewSimplifyGeometryFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create simplify func, %v", err)
+	}
+
+	new_body, err := simplify_func(ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to simplify geometry, %v", err)
+	}
+
+	coords := gjson.GetBytes(new_body, "geometry.coordinates").Raw
+
+	if coords != "[[0,0,5],[1.1235,0,7]]" {
+		t.Fatalf("Unexpected coordinates, %s", coords)
+	}
+}
@@ -4,24 +4,90 @@ import (
 	"context"
 )
 
+// type SpelunkerV1Options defines configuration options for preparing Who's On First documents for indexing with the "v1" schema.
+type SpelunkerV1Options struct {
+	// EDTF are the options used to apply EDTF-related updates (see `NewPrepareEDTFFunc`). If nil the default options are used.
+	EDTF *AppendEDTFRangesOptions
+	// Placetypes are the options used to append placetype details (see `NewAppendPlacetypeDetailsFunc`), for example a custom
+	// placetypes specification. If nil the default options are used.
+	Placetypes *AppendPlacetypeDetailsOptions
+}
+
 // PrepareSpelunkerV1Document prepares a Who's On First document for indexing with the
 // "v1" Elasticsearch (v2.x) schema. For details please consult:
 // https://github.com/whosonfirst/es-whosonfirst-schema/tree/master/schema/2.4
 func PrepareSpelunkerV1Document(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &SpelunkerV1Options{}
+	return prepareSpelunkerV1Document(ctx, body, opts)
+}
+
+// NewPrepareSpelunkerV1DocumentFunc returns a `PrepareDocumentFunc` that prepares a Who's On First document for indexing
+// with the "v1" Elasticsearch (v2.x) schema, using 'opts'. See `PrepareSpelunkerV1Document` for details.
+func NewPrepareSpelunkerV1DocumentFunc(ctx context.Context, opts *SpelunkerV1Options) (PrepareDocumentFunc, error) {
+
+	err := validateSpelunkerV1Options(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return prepareSpelunkerV1Document(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func prepareSpelunkerV1Document(ctx context.Context, body []byte, opts *SpelunkerV1Options) ([]byte, error) {
+
+	// Geometry-derived properties need to be appended before the properties are extracted
 
-	prepped, err := ExtractProperties(ctx, body)
+	body, err := appendSpelunkerV1Properties(ctx, body, opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return AppendSpelunkerV1Properties(ctx, prepped)
+	return ExtractProperties(ctx, body)
 }
 
 // AppendSpelunkerV1Properties appends properties specific to the v1" Elasticsearch (v2.x) schema
 // to a Who's On First document for. For details please consult:
 // https://github.com/whosonfirst/es-whosonfirst-schema/tree/master/schema/2.4
 func AppendSpelunkerV1Properties(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &SpelunkerV1Options{}
+	return appendSpelunkerV1Properties(ctx, body, opts)
+}
+
+// NewAppendSpelunkerV1PropertiesFunc returns a `PrepareDocumentFunc` that appends properties specific to the "v1"
+// Elasticsearch (v2.x) schema to a Who's On First document, using 'opts'. See `AppendSpelunkerV1Properties` for details.
+func NewAppendSpelunkerV1PropertiesFunc(ctx context.Context, opts *SpelunkerV1Options) (PrepareDocumentFunc, error) {
+
+	err := validateSpelunkerV1Options(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendSpelunkerV1Properties(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+// validateSpelunkerV1Options returns an error if any of the options in 'opts' are invalid.
+func validateSpelunkerV1Options(ctx context.Context, opts *SpelunkerV1Options) error {
+
+	if opts.EDTF == nil {
+		return nil
+	}
+
+	_, err := NewPrepareEDTFFunc(ctx, opts.EDTF)
+	return err
+}
+
+func appendSpelunkerV1Properties(ctx context.Context, body []byte, opts *SpelunkerV1Options) ([]byte, error) {
 
 	var err error
 
@@ -37,19 +103,41 @@ func AppendSpelunkerV1Properties(ctx context.Context, body []byte) ([]byte, erro
 		return nil, err
 	}
 
-	body, err = AppendPlacetypeDetails(ctx, body)
+	body, err = AppendGeometryStats(ctx, body)
 
 	if err != nil {
 		return nil, err
 	}
 
-	body, err = AppendEDTFRanges(ctx, body)
+	placetypes_opts := opts.Placetypes
+
+	if placetypes_opts == nil {
+		placetypes_opts = &AppendPlacetypeDetailsOptions{}
+	}
+
+	body, err = appendPlacetypeDetails(ctx, body, placetypes_opts)
 
 	if err != nil {
 		return nil, err
 	}
 
-	// to do: categories and machine tags...
+	edtf_opts := opts.EDTF
+
+	if edtf_opts == nil {
+		edtf_opts = &AppendEDTFRangesOptions{}
+	}
+
+	body, err = prepareEDTF(ctx, body, edtf_opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = AppendCategories(ctx, body)
+
+	if err != nil {
+		return nil, err
+	}
 
 	return body, nil
 }
@@ -0,0 +1,112 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"strings"
+	"testing"
+)
+
+func TestNewAppendSpelunkerV1PropertiesFunc(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts := &SpelunkerV1Options{
+		EDTF: &AppendEDTFRangesOptions{
+			OpenCessation: EDTF_OPEN_FUTURE,
+			DateRanges:    true,
+		},
+	}
+
+	spelunker_func, err := NewAppendSpelunkerV1PropertiesFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create Spelunker v1 properties func, %v", err)
+	}
+
+	body := `{"type": "Feature", "properties": {"wof:id": 1234, "wof:placetype": "locality", "edtf:inception": "not a date", "edtf:cessation": ".."}, "geometry": {"type": "Point", "coordinates": [-122.4, 37.8]}}`
+
+	report := NewReport()
+	report_ctx := WithReport(ctx, report)
+
+	new_body, err := spelunker_func(report_ctx, []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to append Spelunker v1 properties, %v", err)
+	}
+
+	// EDTF options should be applied by the Spelunker v1 function itself
+
+	if !gjson.GetBytes(new_body, "properties.date:cessation_outer_range").Exists() {
+		t.Fatalf("Expected date_range properties derived from EDTF options (%s)", string(new_body))
+	}
+
+	// EDTF updates should only be applied once per document
+
+	if report.Count("edtf:parse_error") != 1 {
+		t.Fatalf("Expected parse error to be reported once, got %d", report.Count("edtf:parse_error"))
+	}
+
+	// Invalid EDTF options
+
+	opts = &SpelunkerV1Options{
+		EDTF: &AppendEDTFRangesOptions{
+			OpenCessation: "sometime",
+		},
+	}
+
+	_, err = NewPrepareSpelunkerV1DocumentFunc(ctx, opts)
+
+	if err == nil {
+		t.Fatalf("Expected invalid EDTF options to fail")
+	}
+}
+
+func TestSpelunkerV1CustomPlacetypes(t *testing.T) {
+
+	ctx := context.Background()
+
+	custom := `{"900000001": {"role": "custom", "name": "terminal", "parent": [102312331], "names": {}}, "900000002": {"role": "custom", "name": "gate", "parent": [900000001], "names": {}}}`
+
+	spec, err := NewPlacetypeSpecificationWithReader(ctx, strings.NewReader(custom))
+
+	if err != nil {
+		t.Fatalf("Failed to create placetypes specification, %v", err)
+	}
+
+	opts := &SpelunkerV1Options{
+		Placetypes: &AppendPlacetypeDetailsOptions{
+			Specification: spec,
+		},
+	}
+
+	spelunker_func, err := NewPrepareSpelunkerV1DocumentFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create Spelunker v1 document func, %v", err)
+	}
+
+	body := `{"type": "Feature", "properties": {"wof:id": 1234, "wof:placetype": "gate"}, "geometry": {"type": "Point", "coordinates": [-122.4, 37.8]}}`
+
+	report := NewReport()
+
+	new_body, err := spelunker_func(WithReport(ctx, report), []byte(body))
+
+	if err != nil {
+		t.Fatalf("Failed to prepare Spelunker v1 document, %v", err)
+	}
+
+	// Custom placetypes should be resolved using the custom specification, in a single pass
+
+	if report.Count("placetype_details:unknown_placetype") != 0 {
+		t.Fatalf("Custom placetype was reported as unknown")
+	}
+
+	if gjson.GetBytes(new_body, "wof:placetype_role").String() != "custom" {
+		t.Fatalf("Unexpected placetype role, %s", string(new_body))
+	}
+
+	if gjson.GetBytes(new_body, "wof:placetype_ancestors.0").String() != "terminal" {
+		t.Fatalf("Unexpected placetype ancestors, %s", gjson.GetBytes(new_body, "wof:placetype_ancestors").Raw)
+	}
+}
@@ -0,0 +1,264 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"math"
+	"sort"
+	"strings"
+)
+
+// SUGGEST_PROPERTY is the property containing the completion suggester input, weight and contexts for a Who's On First record.
+const SUGGEST_PROPERTY string = "suggest"
+
+// SUGGEST_INPUTS_PROPERTY is the property containing the list of suggestion inputs for a Who's On First record, suitable for
+// mapping as a `search_as_you_type` field.
+const SUGGEST_INPUTS_PROPERTY string = "suggest:inputs"
+
+// DEFAULT_SUGGEST_CONTEXT_PLACETYPES is the default list of ancestor placetypes, ordered from most to least specific,
+// used to derive the hierarchy context for suggestion inputs.
+var DEFAULT_SUGGEST_CONTEXT_PLACETYPES = DEFAULT_LABEL_PLACETYPES
+
+// type AppendSuggestionsOptions defines configuration options for appending autocomplete suggestions to a Who's On First document.
+type AppendSuggestionsOptions struct {
+	// Languages is an optional list of (ISO 639-3) languages whose preferred and variant names are used as suggestion inputs.
+	// If empty all languages are used.
+	Languages []string
+	// ContextPlacetypes is the ordered list of ancestor placetypes used to derive the hierarchy context for suggestion inputs.
+	// Default is `DEFAULT_SUGGEST_CONTEXT_PLACETYPES`.
+	ContextPlacetypes []string
+	// PlacetypeWeights maps placetypes to their relative importance, from 0 to 100. Default is `DEFAULT_PLACETYPE_WEIGHTS`.
+	PlacetypeWeights map[string]int
+}
+
+// AppendSuggestions appends autocomplete suggestions to a Who's On First document using the default options. See
+// `NewAppendSuggestionsFunc` for details.
+func AppendSuggestions(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &AppendSuggestionsOptions{}
+	return appendSuggestions(ctx, body, opts)
+}
+
+// NewAppendSuggestionsFunc returns a `PrepareDocumentFunc` that appends autocomplete suggestions to a Who's On First document.
+// Specifically:
+// * A `suggest` object, for use with a `completion` field, containing the suggestion inputs, a weight and `placetype` and
+// `country` contexts.
+// * A `suggest:inputs` property containing the suggestion inputs, for use with a `search_as_you_type` field.
+// Suggestion inputs are `wof:name` and the preferred and variant names in `opts.Languages`, each on its own and followed by
+// the name of the nearest ancestor in `opts.ContextPlacetypes` (for example "Oakland, California"). Ancestor names are read
+// from the `hierarchy:{PLACETYPE}_name` properties produced by `NewAppendHierarchyNamesFunc` so that function needs to be
+// applied first. The weight is derived from the placetype (using `opts.PlacetypeWeights`), the larger of the `wof:population`
+// and `gn:population` properties and the number of names (`counts:names_total` if present).
+func NewAppendSuggestionsFunc(ctx context.Context, opts *AppendSuggestionsOptions) (PrepareDocumentFunc, error) {
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return appendSuggestions(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func appendSuggestions(ctx context.Context, body []byte, opts *AppendSuggestionsOptions) ([]byte, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	context_placetypes := opts.ContextPlacetypes
+
+	if len(context_placetypes) == 0 {
+		context_placetypes = DEFAULT_SUGGEST_CONTEXT_PLACETYPES
+	}
+
+	placetype_weights := opts.PlacetypeWeights
+
+	if placetype_weights == nil {
+		placetype_weights = DEFAULT_PLACETYPE_WEIGHTS
+	}
+
+	languages := make(map[string]bool)
+
+	for _, lang := range opts.Languages {
+		languages[strings.ToLower(lang)] = true
+	}
+
+	names := make([]string, 0)
+	seen_names := make(map[string]bool)
+
+	add_name := func(name string) {
+
+		name = strings.TrimSpace(name)
+
+		if name == "" || seen_names[name] {
+			return
+		}
+
+		names = append(names, name)
+		seen_names[name] = true
+	}
+
+	add_name(root.Get("wof:name").String())
+
+	props := root.Map()
+
+	keys := make([]string, 0)
+	count_names := 0
+
+	for k, _ := range props {
+
+		if strings.HasPrefix(k, "name:") {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		nk, ok := parseNameKey(k)
+
+		if !ok {
+			continue
+		}
+
+		values := props[k].Array()
+		count_names += len(values)
+
+		if len(languages) > 0 && !languages[nk.Language] {
+			continue
+		}
+
+		if nk.Qualifier != NAME_QUALIFIER_PREFERRED && nk.Qualifier != NAME_QUALIFIER_VARIANT {
+			continue
+		}
+
+		for _, v := range values {
+			add_name(v.String())
+		}
+	}
+
+	if len(names) == 0 {
+		return body, nil
+	}
+
+	ancestor_name := ""
+
+	for _, pt := range context_placetypes {
+
+		n := root.Get(fmt.Sprintf("hierarchy:%s_name", pt)).String()
+
+		if n != "" {
+			ancestor_name = n
+			break
+		}
+	}
+
+	inputs := make([]string, 0)
+
+	for _, n := range names {
+		inputs = append(inputs, n)
+	}
+
+	if ancestor_name != "" {
+
+		for _, n := range names {
+
+			if n == ancestor_name {
+				continue
+			}
+
+			inputs = append(inputs, fmt.Sprintf("%s, %s", n, ancestor_name))
+		}
+	}
+
+	// Weights
+
+	placetype := root.Get("wof:placetype").String()
+
+	population := int64(0)
+
+	for _, k := range []string{"wof:population", "gn:population"} {
+
+		p := root.Get(k).Int()
+
+		if p > population {
+			population = p
+		}
+	}
+
+	names_rsp := root.Get("counts:names_total")
+
+	if names_rsp.Exists() {
+		count_names = int(names_rsp.Int())
+	}
+
+	weight := suggestionWeight(placetype_weights[placetype], population, count_names)
+
+	contexts := make(map[string][]string)
+
+	if placetype != "" {
+		contexts["placetype"] = []string{placetype}
+	}
+
+	country := strings.ToUpper(root.Get("wof:country").String())
+
+	if country != "" {
+		contexts["country"] = []string{country}
+	}
+
+	suggest := map[string]interface{}{
+		"input":  inputs,
+		"weight": weight,
+	}
+
+	if len(contexts) > 0 {
+		suggest["contexts"] = contexts
+	}
+
+	to_assign := map[string]interface{}{
+		SUGGEST_PROPERTY:        suggest,
+		SUGGEST_INPUTS_PROPERTY: inputs,
+	}
+
+	var err error
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+// suggestionWeight returns a (positive) completion suggester weight derived from a placetype weight (0-100), a population
+// and a number of names. Placetypes contribute up to 1,000 points and population and the number of names are scaled
+// logarithmically so that, for example, a city of one million people outweighs a village of the same placetype.
+func suggestionWeight(placetype_weight int, population int64, count_names int) int {
+
+	weight := float64(placetype_weight * 10)
+
+	if population > 0 {
+		weight += math.Log10(float64(population)+1) * 50
+	}
+
+	if count_names > 0 {
+		weight += math.Log2(float64(count_names)+1) * 10
+	}
+
+	return int(math.Round(weight))
+}
@@ -0,0 +1,91 @@
+package document
+
+import (
+	"context"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestAppendSuggestions(t *testing.T) {
+
+	ctx := context.Background()
+
+	oakland := `{"properties": {"wof:id": 85921881, "wof:name": "Oakland", "wof:placetype": "locality", "wof:country": "us", "wof:population": 433031, "name:eng_x_preferred": ["Oakland"], "name:eng_x_variant": ["Oaktown"], "name:eng_x_colloquial": ["The Town"], "name:spa_x_preferred": ["Oakland"], "hierarchy:region_name": "California", "hierarchy:country_name": "United States"}}`
+
+	body, err := AppendSuggestions(ctx, []byte(oakland))
+
+	if err != nil {
+		t.Fatalf("Failed to append suggestions, %v", err)
+	}
+
+	expected := []string{
+		"Oakland",
+		"Oaktown",
+		"Oakland, California",
+		"Oaktown, California",
+	}
+
+	inputs := gjson.GetBytes(body, "properties.suggest.input").Array()
+
+	if len(inputs) != len(expected) {
+		t.Fatalf("Unexpected suggestion inputs, %s", gjson.GetBytes(body, "properties.suggest.input").Raw)
+	}
+
+	for idx, v := range expected {
+
+		if inputs[idx].String() != v {
+			t.Fatalf("Unexpected suggestion input at offset %d: '%s'", idx, inputs[idx].String())
+		}
+	}
+
+	if len(gjson.GetBytes(body, "properties.suggest:inputs").Array()) != len(expected) {
+		t.Fatalf("Unexpected search-as-you-type inputs")
+	}
+
+	if gjson.GetBytes(body, "properties.suggest.contexts.placetype.0").String() != "locality" {
+		t.Fatalf("Missing or invalid placetype context")
+	}
+
+	if gjson.GetBytes(body, "properties.suggest.contexts.country.0").String() != "US" {
+		t.Fatalf("Missing or invalid country context")
+	}
+
+	// A hamlet with the same name and placetype should have a lower weight
+
+	hamlet := `{"properties": {"wof:id": 1, "wof:name": "Oakland", "wof:placetype": "locality", "wof:country": "US", "gn:population": 120, "hierarchy:region_name": "Nebraska"}}`
+
+	hamlet_body, err := AppendSuggestions(ctx, []byte(hamlet))
+
+	if err != nil {
+		t.Fatalf("Failed to append suggestions, %v", err)
+	}
+
+	city_weight := gjson.GetBytes(body, "properties.suggest.weight").Int()
+	hamlet_weight := gjson.GetBytes(hamlet_body, "properties.suggest.weight").Int()
+
+	if city_weight <= hamlet_weight {
+		t.Fatalf("Expected city weight (%d) to be greater than hamlet weight (%d)", city_weight, hamlet_weight)
+	}
+
+	// Only the names in the requested languages are used
+
+	opts := &AppendSuggestionsOptions{
+		Languages: []string{"spa"},
+	}
+
+	suggest_func, err := NewAppendSuggestionsFunc(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create suggestions func, %v", err)
+	}
+
+	body, err = suggest_func(ctx, []byte(oakland))
+
+	if err != nil {
+		t.Fatalf("Failed to append suggestions, %v", err)
+	}
+
+	if len(gjson.GetBytes(body, "properties.suggest.input").Array()) != 2 {
+		t.Fatalf("Unexpected suggestion inputs for language, %s", gjson.GetBytes(body, "properties.suggest.input").Raw)
+	}
+}
@@ -0,0 +1,293 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DEFAULT_SYNONYM_MIN_LENGTH is the default minimum length, in characters, of names used as synonyms.
+const DEFAULT_SYNONYM_MIN_LENGTH int = 2
+
+// type SynonymRule defines a set of alternate names for one or more names in a given language.
+type SynonymRule struct {
+	// Language is the (ISO 639-3) language of the names
+	Language string
+	// Names are the preferred names
+	Names []string
+	// Synonyms are the variant and colloquial names
+	Synonyms []string
+}
+
+// String returns 'r' as a Solr-formatted synonym rule. If 'equivalent' is true the rule is a comma-separated list
+// of equivalent names (for example "San Francisco, SF, Frisco"), otherwise it is an explicit mapping from synonyms to
+// names (for example "SF, Frisco => San Francisco").
+func (r *SynonymRule) String(equivalent bool) string {
+
+	escape := func(names []string) string {
+
+		escaped := make([]string, len(names))
+
+		for idx, n := range names {
+			n = strings.ReplaceAll(n, `\`, `\\`)
+			n = strings.ReplaceAll(n, ",", `\,`)
+			escaped[idx] = n
+		}
+
+		return strings.Join(escaped, ", ")
+	}
+
+	if equivalent {
+
+		all := make([]string, 0, len(r.Names)+len(r.Synonyms))
+		all = append(all, r.Names...)
+		all = append(all, r.Synonyms...)
+
+		return escape(all)
+	}
+
+	return fmt.Sprintf("%s => %s", escape(r.Synonyms), escape(r.Names))
+}
+
+// type DeriveSynonymsOptions defines configuration options for deriving synonym rules from a Who's On First document.
+type DeriveSynonymsOptions struct {
+	// MinLength is the minimum length, in characters, of names used as synonyms. Default is `DEFAULT_SYNONYM_MIN_LENGTH`.
+	MinLength int
+	// Languages is an optional list of (ISO 639-3) languages to derive synonym rules for. If empty all languages are used.
+	Languages []string
+}
+
+// DeriveSynonyms returns zero or more `SynonymRule` instances, one per language, derived from the `name:*` properties of
+// a Who's On First document. Each rule maps the unique set of variant and colloquial names in a language to the preferred
+// names in that language (or `wof:name` if there are no preferred names). Synonyms that are also preferred names (ignoring
+// case) or shorter than `opts.MinLength` are excluded. Rules are sorted by language.
+func DeriveSynonyms(ctx context.Context, body []byte, opts *DeriveSynonymsOptions) ([]*SynonymRule, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	min_length := opts.MinLength
+
+	if min_length <= 0 {
+		min_length = DEFAULT_SYNONYM_MIN_LENGTH
+	}
+
+	languages := make(map[string]bool)
+
+	for _, lang := range opts.Languages {
+		languages[strings.ToLower(lang)] = true
+	}
+
+	preferred := make(map[string][]string)
+	alternates := make(map[string][]string)
+
+	for k, v := range root.Map() {
+
+		if !strings.HasPrefix(k, "name:") {
+			continue
+		}
+
+		nk, ok := parseNameKey(k)
+
+		if !ok {
+			continue
+		}
+
+		if len(languages) > 0 && !languages[nk.Language] {
+			continue
+		}
+
+		names := make([]string, 0)
+
+		for _, n := range v.Array() {
+
+			name := strings.TrimSpace(n.String())
+
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+
+		switch nk.Qualifier {
+		case NAME_QUALIFIER_PREFERRED:
+			preferred[nk.Language] = append(preferred[nk.Language], names...)
+		case NAME_QUALIFIER_VARIANT, NAME_QUALIFIER_COLLOQUIAL:
+			alternates[nk.Language] = append(alternates[nk.Language], names...)
+		default:
+			// pass
+		}
+	}
+
+	wof_name := strings.TrimSpace(root.Get("wof:name").String())
+
+	rules := make([]*SynonymRule, 0)
+
+	for lang, alt_names := range alternates {
+
+		names := uniqueNames(preferred[lang])
+
+		if len(names) == 0 {
+
+			if wof_name == "" {
+				continue
+			}
+
+			names = []string{
+				wof_name,
+			}
+		}
+
+		exclude := make(map[string]bool)
+
+		for _, n := range names {
+			exclude[strings.ToLower(n)] = true
+		}
+
+		synonyms := make([]string, 0)
+
+		for _, n := range uniqueNames(alt_names) {
+
+			if exclude[strings.ToLower(n)] {
+				continue
+			}
+
+			if utf8.RuneCountInString(n) < min_length {
+				continue
+			}
+
+			synonyms = append(synonyms, n)
+		}
+
+		if len(synonyms) == 0 {
+			continue
+		}
+
+		r := &SynonymRule{
+			Language: lang,
+			Names:    names,
+			Synonyms: synonyms,
+		}
+
+		rules = append(rules, r)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Language < rules[j].Language
+	})
+
+	return rules, nil
+}
+
+// uniqueNames returns the sorted, unique (ignoring case) set of names in 'names'.
+func uniqueNames(names []string) []string {
+
+	unique := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, n := range names {
+
+		k := strings.ToLower(n)
+
+		if seen[k] {
+			continue
+		}
+
+		unique = append(unique, n)
+		seen[k] = true
+	}
+
+	sort.Strings(unique)
+	return unique
+}
+
+// type SynonymSet is a thread-safe collection of unique, Solr-formatted, synonym rules grouped by language.
+type SynonymSet struct {
+	equivalent bool
+	rules      map[string]map[string]bool
+	mu         *sync.RWMutex
+}
+
+// NewSynonymSet returns a new `SynonymSet` instance. If 'equivalent' is true rules are stored as lists of equivalent names.
+// See `SynonymRule.String` for details.
+func NewSynonymSet(equivalent bool) *SynonymSet {
+
+	s := &SynonymSet{
+		equivalent: equivalent,
+		rules:      make(map[string]map[string]bool),
+		mu:         new(sync.RWMutex),
+	}
+
+	return s
+}
+
+// Add adds 'rules' to 's'. Duplicate rules are ignored.
+func (s *SynonymSet) Add(rules ...*SynonymRule) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range rules {
+
+		_, ok := s.rules[r.Language]
+
+		if !ok {
+			s.rules[r.Language] = make(map[string]bool)
+		}
+
+		s.rules[r.Language][r.String(s.equivalent)] = true
+	}
+}
+
+// Languages returns the sorted list of languages with synonym rules.
+func (s *SynonymSet) Languages() []string {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	languages := make([]string, 0, len(s.rules))
+
+	for lang, _ := range s.rules {
+		languages = append(languages, lang)
+	}
+
+	sort.Strings(languages)
+	return languages
+}
+
+// Rules returns the sorted list of unique synonym rules for 'lang'. If 'lang' is empty the rules for all languages are returned.
+func (s *SynonymSet) Rules(lang string) []string {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unique := make(map[string]bool)
+
+	for rule_lang, rules := range s.rules {
+
+		if lang != "" && rule_lang != lang {
+			continue
+		}
+
+		for r, _ := range rules {
+			unique[r] = true
+		}
+	}
+
+	rules := make([]string, 0, len(unique))
+
+	for r, _ := range unique {
+		rules = append(rules, r)
+	}
+
+	sort.Strings(rules)
+	return rules
+}
@@ -0,0 +1,88 @@
+package document
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeriveSynonyms(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := `{"properties": {"wof:name": "San Francisco", "name:eng_x_preferred": ["San Francisco"], "name:eng_x_variant": ["SF", "San Francisco", "S", "Frisco"], "name:eng_x_colloquial": ["Frisco", "The City, by the Bay"], "name:spa_x_variant": ["San Francisco de Asís"], "name:fra_x_preferred": ["San Francisco"]}}`
+
+	opts := &DeriveSynonymsOptions{}
+
+	rules, err := DeriveSynonyms(ctx, []byte(body), opts)
+
+	if err != nil {
+		t.Fatalf("Failed to derive synonyms, %v", err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 synonym rules, got %d", len(rules))
+	}
+
+	tests := map[string]string{
+		"eng": `Frisco, SF, The City\, by the Bay => San Francisco`,
+		"spa": `San Francisco de Asís => San Francisco`,
+	}
+
+	for _, r := range rules {
+
+		expected, ok := tests[r.Language]
+
+		if !ok {
+			t.Fatalf("Unexpected language %s", r.Language)
+		}
+
+		if r.String(false) != expected {
+			t.Fatalf("Unexpected rule for %s: '%s'", r.Language, r.String(false))
+		}
+	}
+
+	if rules[0].String(true) != `San Francisco, Frisco, SF, The City\, by the Bay` {
+		t.Fatalf("Unexpected equivalent rule: '%s'", rules[0].String(true))
+	}
+
+	opts = &DeriveSynonymsOptions{
+		MinLength: 3,
+		Languages: []string{"eng"},
+	}
+
+	rules, err = DeriveSynonyms(ctx, []byte(body), opts)
+
+	if err != nil {
+		t.Fatalf("Failed to derive synonyms, %v", err)
+	}
+
+	if len(rules) != 1 || len(rules[0].Synonyms) != 2 {
+		t.Fatalf("Unexpected rules with minimum length and languages, %v", rules)
+	}
+}
+
+func TestSynonymSet(t *testing.T) {
+
+	s := NewSynonymSet(false)
+
+	r1 := &SynonymRule{Language: "eng", Names: []string{"San Francisco"}, Synonyms: []string{"SF"}}
+	r2 := &SynonymRule{Language: "eng", Names: []string{"Los Angeles"}, Synonyms: []string{"LA"}}
+	r3 := &SynonymRule{Language: "fra", Names: []string{"Los Angeles"}, Synonyms: []string{"LA"}}
+
+	s.Add(r1, r2, r1)
+	s.Add(r3)
+
+	if len(s.Languages()) != 2 {
+		t.Fatalf("Unexpected languages, %v", s.Languages())
+	}
+
+	if len(s.Rules("eng")) != 2 {
+		t.Fatalf("Unexpected rules for eng, %v", s.Rules("eng"))
+	}
+
+	// Identical rules in different languages are only included once
+
+	if len(s.Rules("")) != 2 {
+		t.Fatalf("Unexpected rules for all languages, %v", s.Rules(""))
+	}
+}
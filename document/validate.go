@@ -0,0 +1,825 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"math"
+	"sort"
+)
+
+// GEOMETRY_VALID is the value assigned to the `geom:validation` property for geometries that did not need to be repaired.
+const GEOMETRY_VALID string = "valid"
+
+// GEOMETRY_REPAIRED is the value assigned to the `geom:validation` property for geometries that were repaired.
+const GEOMETRY_REPAIRED string = "repaired"
+
+// GEOMETRY_INVALID is the value assigned to the `geom:validation` property for geometries that could not be repaired.
+const GEOMETRY_INVALID string = "invalid"
+
+// DEFAULT_INVALID_GEOMETRY_PATH is the default path that geometries which can not be repaired are moved to.
+const DEFAULT_INVALID_GEOMETRY_PATH string = "invalid_geometry"
+
+const (
+	repair_duplicate_points string = "duplicate-points"
+	repair_unclosed_ring    string = "unclosed-ring"
+	repair_degenerate_ring  string = "degenerate-ring"
+	repair_degenerate_line  string = "degenerate-line"
+	repair_winding          string = "winding"
+	repair_antimeridian     string = "antimeridian"
+)
+
+const (
+	invalid_parse             string = "parse"
+	invalid_out_of_range      string = "coordinates-out-of-range"
+	invalid_empty             string = "empty-geometry"
+	invalid_self_intersection string = "self-intersection"
+)
+
+// type ValidateGeometryOptions defines configuration options for validating GeoJSON geometries for indexing as `geo_shape` properties.
+type ValidateGeometryOptions struct {
+	// InvalidGeometryPath is the path, relative to the root of a document, where geometries that can not be repaired
+	// are moved to. Elasticsearch mappings should disable indexing for this path. Default is "invalid_geometry".
+	InvalidGeometryPath string
+	// SkipSelfIntersections is a boolean flag to skip checking polygon rings for self-intersections.
+	SkipSelfIntersections bool
+}
+
+type invalidGeometryError struct {
+	reason  string
+	details string
+}
+
+func (e *invalidGeometryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.reason, e.details)
+}
+
+type geometryValidator struct {
+	opts    *ValidateGeometryOptions
+	repairs map[string]bool
+}
+
+// ValidateGeometry validates and, where possible, repairs the GeoJSON `geometry` property of a Who's On First document
+// for indexing as an Elasticsearch `geo_shape` using the default `ValidateGeometryOptions`. See `NewValidateGeometryFunc` for details.
+func ValidateGeometry(ctx context.Context, body []byte) ([]byte, error) {
+	opts := &ValidateGeometryOptions{}
+	return validateGeometry(ctx, body, opts)
+}
+
+// NewValidateGeometryFunc returns a `PrepareDocumentFunc` that validates and, where possible, repairs the GeoJSON `geometry`
+// property of a Who's On First document for indexing as an Elasticsearch `geo_shape`. Specifically:
+// * Duplicate consecutive points are removed.
+// * Unclosed polygon rings are closed.
+// * Degenerate polygon rings (fewer than four points or zero area) are removed. If the exterior ring of a polygon is degenerate the entire polygon is removed.
+// * Polygon rings are rewound so that exterior rings are counter-clockwise and interior rings are clockwise, per RFC 7946.
+// * Polygons crossing the antimeridian are split in to multiple polygons on either side of it.
+// Geometries that can not be repaired (for example, polygons with self-intersecting rings or coordinates outside
+// the valid range of latitudes) are moved to the path defined by `opts.InvalidGeometryPath` and the `geometry`
+// property is removed.
+//
+// The outcome of validation is recorded in a `geom:validation` property whose value is one of `GEOMETRY_VALID`,
+// `GEOMETRY_REPAIRED` or `GEOMETRY_INVALID`. The list of repairs applied is recorded in a `geom:validation_repairs`
+// property and the reason a geometry is invalid is recorded in a `geom:validation_reason` property. If a `Report` is
+// associated with the context passed to the function its outcome, repairs and reasons are counted there too.
+//
+// Documents without a `geometry` property (for example "spelunker v1" documents) are returned unchanged.
+func NewValidateGeometryFunc(ctx context.Context, opts *ValidateGeometryOptions) (PrepareDocumentFunc, error) {
+
+	fn := func(ctx context.Context, body []byte) ([]byte, error) {
+		return validateGeometry(ctx, body, opts)
+	}
+
+	return fn, nil
+}
+
+func validateGeometry(ctx context.Context, body []byte, opts *ValidateGeometryOptions) ([]byte, error) {
+
+	geom_rsp := gjson.GetBytes(body, "geometry")
+
+	if !geom_rsp.Exists() || geom_rsp.Type == gjson.Null {
+		return body, nil
+	}
+
+	invalid_path := opts.InvalidGeometryPath
+
+	if invalid_path == "" {
+		invalid_path = DEFAULT_INVALID_GEOMETRY_PATH
+	}
+
+	report := ReportFromContext(ctx)
+
+	v := &geometryValidator{
+		opts:    opts,
+		repairs: make(map[string]bool),
+	}
+
+	var new_geom *geometry
+
+	g, err := parseGeometry(geom_rsp)
+
+	if err != nil {
+		err = &invalidGeometryError{invalid_parse, err.Error()}
+	} else {
+		new_geom, err = v.validate(g)
+	}
+
+	to_assign := make(map[string]interface{})
+
+	if err != nil {
+
+		reason := invalid_parse
+
+		if e, ok := err.(*invalidGeometryError); ok {
+			reason = e.reason
+		}
+
+		body, err = sjson.SetRawBytes(body, invalid_path, []byte(geom_rsp.Raw))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", invalid_path, err)
+		}
+
+		body, err = sjson.DeleteBytes(body, "geometry")
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to remove geometry, %w", err)
+		}
+
+		to_assign["geom:validation"] = GEOMETRY_INVALID
+		to_assign["geom:validation_reason"] = reason
+
+		report.Increment(fmt.Sprintf("validate_geometry:%s", GEOMETRY_INVALID), 1)
+		report.Increment(fmt.Sprintf("validate_geometry:%s:%s", GEOMETRY_INVALID, reason), 1)
+
+	} else if len(v.repairs) > 0 {
+
+		body, err = sjson.SetBytes(body, "geometry", new_geom.value())
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign repaired geometry, %w", err)
+		}
+
+		repairs := make([]string, 0)
+
+		for r, _ := range v.repairs {
+			repairs = append(repairs, r)
+			report.Increment(fmt.Sprintf("validate_geometry:%s:%s", GEOMETRY_REPAIRED, r), 1)
+		}
+
+		sort.Strings(repairs)
+
+		to_assign["geom:validation"] = GEOMETRY_REPAIRED
+		to_assign["geom:validation_repairs"] = repairs
+
+		report.Increment(fmt.Sprintf("validate_geometry:%s", GEOMETRY_REPAIRED), 1)
+
+	} else {
+
+		to_assign["geom:validation"] = GEOMETRY_VALID
+		report.Increment(fmt.Sprintf("validate_geometry:%s", GEOMETRY_VALID), 1)
+	}
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	for k, v := range to_assign {
+
+		path := k
+
+		if props_rsp.Exists() {
+			path = fmt.Sprintf("properties.%s", k)
+		}
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
+
+func (v *geometryValidator) validate(g *geometry) (*geometry, error) {
+
+	switch g.kind {
+	case "GeometryCollection":
+
+		new_g := &geometry{
+			kind: g.kind,
+		}
+
+		for _, child := range g.geometries {
+
+			new_child, err := v.validate(child)
+
+			if err != nil {
+				return nil, err
+			}
+
+			new_g.geometries = append(new_g.geometries, new_child)
+		}
+
+		if len(new_g.geometries) == 0 {
+			return nil, &invalidGeometryError{invalid_empty, "geometry collection has no geometries"}
+		}
+
+		return new_g, nil
+
+	case "Point", "MultiPoint":
+
+		err := v.validateCoordinates(g.points, true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(g.points) == 0 {
+			return nil, &invalidGeometryError{invalid_empty, fmt.Sprintf("%s has no coordinates", g.kind)}
+		}
+
+		return g, nil
+
+	case "LineString", "MultiLineString":
+
+		lines := g.lines
+
+		if g.kind == "LineString" {
+			lines = [][]point{g.points}
+		}
+
+		new_lines := make([][]point, 0)
+
+		for _, line := range lines {
+
+			err := v.validateCoordinates(line, true)
+
+			if err != nil {
+				return nil, err
+			}
+
+			line = v.removeDuplicates(line)
+
+			if len(line) < 2 {
+				v.repairs[repair_degenerate_line] = true
+				continue
+			}
+
+			new_lines = append(new_lines, line)
+		}
+
+		if len(new_lines) == 0 {
+			return nil, &invalidGeometryError{invalid_empty, fmt.Sprintf("%s has no valid lines", g.kind)}
+		}
+
+		new_g := &geometry{
+			kind: g.kind,
+		}
+
+		if g.kind == "LineString" {
+			new_g.points = new_lines[0]
+		} else {
+			new_g.lines = new_lines
+		}
+
+		return new_g, nil
+
+	case "Polygon", "MultiPolygon":
+
+		new_polygons := make([]polygon, 0)
+
+		for _, poly := range g.polygons {
+
+			cleaned, err := v.cleanPolygon(poly)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// Polygons without any (valid) rings, for example `"coordinates": []`, are degenerate
+
+			if len(cleaned) == 0 {
+				continue
+			}
+
+			for _, split := range v.splitAntimeridian(cleaned) {
+				new_polygons = append(new_polygons, v.rewindPolygon(split))
+			}
+		}
+
+		if len(new_polygons) == 0 {
+			return nil, &invalidGeometryError{invalid_empty, fmt.Sprintf("%s has no valid polygons", g.kind)}
+		}
+
+		if !v.opts.SkipSelfIntersections {
+
+			for poly_idx, poly := range new_polygons {
+
+				for ring_idx, r := range poly {
+
+					if r.selfIntersects() {
+						details := fmt.Sprintf("ring %d of polygon %d intersects itself", ring_idx, poly_idx)
+						return nil, &invalidGeometryError{invalid_self_intersection, details}
+					}
+				}
+			}
+		}
+
+		new_g := &geometry{
+			kind:     g.kind,
+			polygons: new_polygons,
+		}
+
+		return new_g, nil
+
+	default:
+		return nil, &invalidGeometryError{invalid_parse, fmt.Sprintf("unsupported geometry type '%s'", g.kind)}
+	}
+}
+
+func (v *geometryValidator) validateCoordinates(points []point, check_longitude bool) error {
+
+	for _, pt := range points {
+
+		x := pt[0]
+		y := pt[1]
+
+		if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+			return &invalidGeometryError{invalid_out_of_range, "coordinate is not a finite number"}
+		}
+
+		if y < -90.0 || y > 90.0 {
+			return &invalidGeometryError{invalid_out_of_range, fmt.Sprintf("latitude %f is out of range", y)}
+		}
+
+		if check_longitude && (x < -180.0 || x > 180.0) {
+			return &invalidGeometryError{invalid_out_of_range, fmt.Sprintf("longitude %f is out of range", x)}
+		}
+	}
+
+	return nil
+}
+
+func (v *geometryValidator) removeDuplicates(points []point) []point {
+
+	if len(points) == 0 {
+		return points
+	}
+
+	deduped := []point{
+		points[0],
+	}
+
+	for _, pt := range points[1:] {
+
+		if pt.equals(deduped[len(deduped)-1]) {
+			v.repairs[repair_duplicate_points] = true
+			continue
+		}
+
+		deduped = append(deduped, pt)
+	}
+
+	return deduped
+}
+
+// cleanPolygon removes duplicate points and degenerate rings from 'poly' and ensures that all of its rings are
+// closed. Longitudes outside the range of -180 to 180 are permitted since they are handled by `splitAntimeridian`.
+// Returns nil if the exterior ring of 'poly' is degenerate.
+func (v *geometryValidator) cleanPolygon(poly polygon) (polygon, error) {
+
+	cleaned := make(polygon, 0)
+
+	for idx, r := range poly {
+
+		err := v.validateCoordinates(r, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r = ring(v.removeDuplicates(r))
+
+		if len(r) > 0 && !r.isClosed() {
+			r = append(r, r[0])
+			v.repairs[repair_unclosed_ring] = true
+		}
+
+		if len(r) < 4 || r.signedArea() == 0.0 {
+
+			v.repairs[repair_degenerate_ring] = true
+
+			if idx == 0 {
+				return nil, nil
+			}
+
+			continue
+		}
+
+		cleaned = append(cleaned, r)
+	}
+
+	return cleaned, nil
+}
+
+// rewindPolygon ensures that the exterior ring of 'poly' is counter-clockwise and its interior rings are clockwise.
+func (v *geometryValidator) rewindPolygon(poly polygon) polygon {
+
+	for idx, r := range poly {
+
+		area := r.signedArea()
+
+		if (idx == 0 && area < 0) || (idx > 0 && area > 0) {
+			poly[idx] = r.reverse()
+			v.repairs[repair_winding] = true
+		}
+	}
+
+	return poly
+}
+
+// splitAntimeridian splits 'poly' in to one or more polygons if it crosses the antimeridian. A polygon is considered
+// to cross the antimeridian if consecutive points are more than 180 degrees of longitude apart or if any of its
+// longitudes fall outside the range of -180 to 180. Rings that wrap around a pole are left unchanged.
+func (v *geometryValidator) splitAntimeridian(poly polygon) []polygon {
+
+	if len(poly) == 0 {
+		return []polygon{}
+	}
+
+	exterior, ok := unwrapRing(poly[0])
+
+	if !ok {
+		return []polygon{poly}
+	}
+
+	min_x, max_x := ringLongitudes(exterior)
+	shift := 0.0
+
+	if min_x < -180.0 {
+		shift = 360.0
+	}
+
+	exterior = shiftRing(exterior, shift)
+	min_x, max_x = min_x+shift, max_x+shift
+
+	holes := make([]ring, 0)
+
+	for _, r := range poly[1:] {
+
+		hole, ok := unwrapRing(r)
+
+		if !ok {
+			return []polygon{poly}
+		}
+
+		hole_shift := 0.0
+
+		if hole[0][0]-min_x < 0 {
+			hole_shift = 360.0
+		} else if hole[0][0]-min_x > 360.0 {
+			hole_shift = -360.0
+		}
+
+		holes = append(holes, shiftRing(hole, hole_shift))
+	}
+
+	if max_x <= 180.0 {
+
+		unwrapped := append(polygon{exterior}, holes...)
+
+		if !polygonsEqual(poly, unwrapped) {
+			v.repairs[repair_antimeridian] = true
+		}
+
+		return []polygon{unwrapped}
+	}
+
+	v.repairs[repair_antimeridian] = true
+
+	split := make([]polygon, 0)
+
+	for _, keep_west := range []bool{true, false} {
+
+		clipped_exterior := clipRing(exterior, 180.0, keep_west)
+
+		if len(clipped_exterior) < 4 || clipped_exterior.signedArea() == 0.0 {
+			continue
+		}
+
+		new_poly := polygon{clipped_exterior}
+
+		for _, h := range holes {
+
+			clipped_hole := clipRing(h, 180.0, keep_west)
+
+			if len(clipped_hole) < 4 || clipped_hole.signedArea() == 0.0 {
+				continue
+			}
+
+			new_poly = append(new_poly, clipped_hole)
+		}
+
+		if !keep_west {
+
+			for idx, r := range new_poly {
+				new_poly[idx] = shiftRing(r, -360.0)
+			}
+		}
+
+		split = append(split, new_poly)
+	}
+
+	if len(split) == 0 {
+		return []polygon{poly}
+	}
+
+	return split
+}
+
+// unwrapRing returns a copy of 'r' whose longitudes are continuous, meaning that no two consecutive points are more
+// than 180 degrees of longitude apart. The second return value is false if 'r' can not be unwrapped because it
+// wraps around a pole.
+func unwrapRing(r ring) (ring, bool) {
+
+	unwrapped := make(ring, len(r))
+
+	offset := 0.0
+
+	for idx, pt := range r {
+
+		if idx > 0 {
+
+			dx := pt[0] - r[idx-1][0]
+
+			if dx > 180.0 {
+				offset -= 360.0
+			} else if dx < -180.0 {
+				offset += 360.0
+			}
+		}
+
+		unwrapped[idx] = pt.withXY(pt[0]+offset, pt[1])
+	}
+
+	if offset != 0.0 {
+		return r, false
+	}
+
+	return unwrapped, true
+}
+
+func ringLongitudes(r ring) (float64, float64) {
+
+	min_x := math.Inf(1)
+	max_x := math.Inf(-1)
+
+	for _, pt := range r {
+		min_x = math.Min(min_x, pt[0])
+		max_x = math.Max(max_x, pt[0])
+	}
+
+	return min_x, max_x
+}
+
+func shiftRing(r ring, dx float64) ring {
+
+	if dx == 0.0 {
+		return r
+	}
+
+	shifted := make(ring, len(r))
+
+	for idx, pt := range r {
+		shifted[idx] = pt.withXY(pt[0]+dx, pt[1])
+	}
+
+	return shifted
+}
+
+// clipRing clips 'r' against the meridian 'x' using the Sutherland-Hodgman algorithm, returning the part of the
+// ring to the west of 'x' if 'keep_west' is true or the part of the ring to the east of it otherwise.
+func clipRing(r ring, x float64, keep_west bool) ring {
+
+	inside := func(pt point) bool {
+
+		if keep_west {
+			return pt[0] <= x
+		}
+
+		return pt[0] >= x
+	}
+
+	// Additional ordinates (for example Z values) are interpolated along with y
+
+	intersection := func(a point, b point) point {
+
+		t := (x - a[0]) / (b[0] - a[0])
+
+		pt := a.withXY(x, a[1]+t*(b[1]-a[1]))
+
+		for idx := 2; idx < len(pt) && idx < len(b); idx++ {
+			pt[idx] = a[idx] + t*(b[idx]-a[idx])
+		}
+
+		return pt
+	}
+
+	count := len(r) - 1
+	clipped := make(ring, 0)
+
+	for i := 0; i < count; i++ {
+
+		current := r[i]
+		previous := r[(i+count-1)%count]
+
+		if inside(current) {
+
+			if !inside(previous) {
+				clipped = append(clipped, intersection(previous, current))
+			}
+
+			clipped = append(clipped, current)
+
+		} else if inside(previous) {
+			clipped = append(clipped, intersection(previous, current))
+		}
+	}
+
+	if len(clipped) == 0 {
+		return clipped
+	}
+
+	deduped := ring{clipped[0]}
+
+	for _, pt := range clipped[1:] {
+
+		if !pt.equals(deduped[len(deduped)-1]) {
+			deduped = append(deduped, pt)
+		}
+	}
+
+	if !deduped.isClosed() {
+		deduped = append(deduped, deduped[0])
+	}
+
+	return deduped
+}
+
+func polygonsEqual(a polygon, b polygon) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i, r := range a {
+
+		if len(r) != len(b[i]) {
+			return false
+		}
+
+		for j, pt := range r {
+
+			if !pt.equals(b[i][j]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// selfIntersects returns a boolean value indicating whether any two non-adjacent segments of 'r' intersect.
+// Segments are bucketed in to a grid of cells in order to avoid comparing every segment with every other segment.
+func (r ring) selfIntersects() bool {
+
+	count := len(r) - 1
+
+	if count < 4 {
+		return false
+	}
+
+	min_x, max_x := ringLongitudes(r)
+	min_y := math.Inf(1)
+	max_y := math.Inf(-1)
+
+	for _, pt := range r {
+		min_y = math.Min(min_y, pt[1])
+		max_y = math.Max(max_y, pt[1])
+	}
+
+	cells := int(math.Ceil(math.Sqrt(float64(count))))
+
+	cell_w := (max_x - min_x) / float64(cells)
+	cell_h := (max_y - min_y) / float64(cells)
+
+	if cell_w == 0.0 {
+		cell_w = 1.0
+	}
+
+	if cell_h == 0.0 {
+		cell_h = 1.0
+	}
+
+	cell := func(v float64, min float64, size float64) int {
+
+		c := int((v - min) / size)
+
+		if c >= cells {
+			c = cells - 1
+		}
+
+		return c
+	}
+
+	buckets := make(map[int][]int)
+
+	for i := 0; i < count; i++ {
+
+		a := r[i]
+		b := r[i+1]
+
+		x1 := cell(math.Min(a[0], b[0]), min_x, cell_w)
+		x2 := cell(math.Max(a[0], b[0]), min_x, cell_w)
+		y1 := cell(math.Min(a[1], b[1]), min_y, cell_h)
+		y2 := cell(math.Max(a[1], b[1]), min_y, cell_h)
+
+		for x := x1; x <= x2; x++ {
+			for y := y1; y <= y2; y++ {
+				k := (y * cells) + x
+				buckets[k] = append(buckets[k], i)
+			}
+		}
+	}
+
+	for _, segments := range buckets {
+
+		for idx, i := range segments {
+
+			for _, j := range segments[idx+1:] {
+
+				if j == i+1 || i == j+1 {
+					continue
+				}
+
+				if (i == 0 && j == count-1) || (j == 0 && i == count-1) {
+					continue
+				}
+
+				if segmentsIntersect(r[i], r[i+1], r[j], r[j+1]) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func orientation(a point, b point, c point) int {
+
+	v := (b[1]-a[1])*(c[0]-b[0]) - (b[0]-a[0])*(c[1]-b[1])
+
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func onSegment(a point, b point, c point) bool {
+	return b[0] <= math.Max(a[0], c[0]) && b[0] >= math.Min(a[0], c[0]) && b[1] <= math.Max(a[1], c[1]) && b[1] >= math.Min(a[1], c[1])
+}
+
+func segmentsIntersect(p1 point, q1 point, p2 point, q2 point) bool {
+
+	o1 := orientation(p1, q1, p2)
+	o2 := orientation(p1, q1, q2)
+	o3 := orientation(p2, q2, p1)
+	o4 := orientation(p2, q2, q1)
+
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+
+	if o1 == 0 && onSegment(p1, p2, q1) {
+		return true
+	}
+
+	if o2 == 0 && onSegment(p1, q2, q1) {
+		return true
+	}
+
+	if o3 == 0 && onSegment(p2, p1, q2) {
+		return true
+	}
+
+	if o4 == 0 && onSegment(p2, q1, q2) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"testing"
+)
+
+func TestValidateGeometry(t *testing.T) {
+
+	ctx := context.Background()
+
+	report := NewReport()
+	ctx = WithReport(ctx, report)
+
+	tests := map[string]string{
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,1],[0,0]]]}}`:                         GEOMETRY_VALID,
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[0,1],[0,1],[1,1],[1,0]]]}}`:                         GEOMETRY_REPAIRED,
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[179,0],[-179,0],[-179,1],[179,1],[179,0]]]}}`:             GEOMETRY_REPAIRED,
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,1],[1,0],[0,1],[0,0]]]}}`:                         GEOMETRY_INVALID,
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [-122.384, 37.616]}}`:                                          GEOMETRY_VALID,
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "Point", "coordinates": [-122.384, 97.616]}}`:                                          GEOMETRY_INVALID,
+		`{"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [[[[0,0],[1,0],[0,0]]], [[[2,2],[3,2],[3,3],[2,2]]]]}}`: GEOMETRY_REPAIRED,
+	}
+
+	for body, expected := range tests {
+
+		new_body, err := ValidateGeometry(ctx, []byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to validate geometry for %s, %v", body, err)
+		}
+
+		status := gjson.GetBytes(new_body, "properties.geom:validation").String()
+
+		if status != expected {
+			t.Fatalf("Unexpected validation status '%s' (expected '%s') for %s", status, expected, string(new_body))
+		}
+
+		switch status {
+		case GEOMETRY_INVALID:
+
+			if gjson.GetBytes(new_body, "geometry").Exists() {
+				t.Fatalf("Invalid geometry was not removed, %s", string(new_body))
+			}
+
+			if !gjson.GetBytes(new_body, DEFAULT_INVALID_GEOMETRY_PATH).Exists() {
+				t.Fatalf("Invalid geometry was not moved, %s", string(new_body))
+			}
+
+		case GEOMETRY_REPAIRED:
+
+			if len(gjson.GetBytes(new_body, "properties.geom:validation_repairs").Array()) == 0 {
+				t.Fatalf("Repaired geometry is missing repairs, %s", string(new_body))
+			}
+		}
+	}
+
+	antimeridian := `{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[179,0],[-179,0],[-179,1],[179,1],[179,0]]]}}`
+
+	new_body, err := ValidateGeometry(ctx, []byte(antimeridian))
+
+	if err != nil {
+		t.Fatalf("Failed to validate antimeridian geometry, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "geometry.type").String() != "MultiPolygon" {
+		t.Fatalf("Expected antimeridian geometry to be split, %s", string(new_body))
+	}
+
+	if report.Count("validate_geometry:invalid") != 2 {
+		t.Fatalf("Unexpected invalid geometry count, %d", report.Count("validate_geometry:invalid"))
+	}
+
+	props := `{"wof:id": 1}`
+
+	new_body, err = ValidateGeometry(ctx, []byte(props))
+
+	if err != nil {
+		t.Fatalf("Failed to validate properties-only document, %v", err)
+	}
+
+	if string(new_body) != props {
+		t.Fatalf("Properties-only document was modified, %s", string(new_body))
+	}
+}
+
+func TestValidateGeometryPositions(t *testing.T) {
+
+	ctx := context.Background()
+
+	// Positions with Z values are preserved, including when a ring is repaired (rewound)
+
+	clockwise := `{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0,10],[0,1,11],[1,1,12],[1,0,13],[0,0,10]]]}}`
+
+	new_body, err := ValidateGeometry(ctx, []byte(clockwise))
+
+	if err != nil {
+		t.Fatalf("Failed to validate geometry with Z values, %v", err)
+	}
+
+	if gjson.GetBytes(new_body, "properties.geom:validation").String() != GEOMETRY_REPAIRED {
+		t.Fatalf("Expected clockwise geometry to be repaired, %s", string(new_body))
+	}
+
+	for _, pt := range gjson.GetBytes(new_body, "geometry.coordinates.0").Array() {
+
+		if len(pt.Array()) != 3 {
+			t.Fatalf("Expected Z values to be preserved, %s", string(new_body))
+		}
+	}
+
+	// Positions with fewer than two ordinates are invalid
+
+	for _, geom := range []string{
+		`{"type": "Point", "coordinates": [-122.384]}`,
+		`{"type": "Point", "coordinates": []}`,
+		`{"type": "Polygon", "coordinates": [[[0,0],[1,0],[1],[0,1],[0,0]]]}`,
+	} {
+
+		body := fmt.Sprintf(`{"type": "Feature", "properties": {}, "geometry": %s}`, geom)
+
+		new_body, err := ValidateGeometry(ctx, []byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to validate geometry for %s, %v", body, err)
+		}
+
+		if gjson.GetBytes(new_body, "properties.geom:validation").String() != GEOMETRY_INVALID {
+			t.Fatalf("Expected short position to be invalid, %s", string(new_body))
+		}
+
+		if gjson.GetBytes(new_body, "properties.geom:validation_reason").String() != invalid_parse {
+			t.Fatalf("Unexpected validation reason, %s", string(new_body))
+		}
+	}
+}
+
+func TestValidateGeometryEmptyPolygons(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, geom := range []string{
+		`{"type": "Polygon", "coordinates": []}`,
+		`{"type": "MultiPolygon", "coordinates": [[]]}`,
+	} {
+
+		body := fmt.Sprintf(`{"type": "Feature", "properties": {}, "geometry": %s}`, geom)
+
+		new_body, err := ValidateGeometry(ctx, []byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to validate geometry for %s, %v", body, err)
+		}
+
+		if gjson.GetBytes(new_body, "properties.geom:validation").String() != GEOMETRY_INVALID {
+			t.Fatalf("Expected empty polygon to be invalid, %s", string(new_body))
+		}
+
+		if gjson.GetBytes(new_body, "properties.geom:validation_reason").String() != invalid_empty {
+			t.Fatalf("Unexpected validation reason, %s", string(new_body))
+		}
+	}
+}
+
+func TestSplitAntimeridianEmptyPolygon(t *testing.T) {
+
+	v := &geometryValidator{
+		opts:    &ValidateGeometryOptions{},
+		repairs: make(map[string]bool),
+	}
+
+	if len(v.splitAntimeridian(polygon{})) != 0 {
+		t.Fatalf("Expected empty polygon to yield no polygons")
+	}
+}
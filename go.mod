@@ -18,6 +18,8 @@ require (
 	github.com/whosonfirst/go-whosonfirst-iterate-git/v2 v2.1.0
 	github.com/whosonfirst/go-whosonfirst-iterate/v2 v2.0.1
 	github.com/whosonfirst/go-whosonfirst-placetypes v0.3.0
+	github.com/whosonfirst/go-whosonfirst-sources v0.1.0
 	github.com/whosonfirst/go-whosonfirst-uri v1.2.0
+	golang.org/x/text v0.3.7
 	gopkg.in/olivere/elastic.v3 v3.0.75
 )
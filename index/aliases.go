@@ -0,0 +1,205 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/whosonfirst/go-whosonfirst-placetypes"
+	"sort"
+)
+
+const FLAG_ALIAS_PREFIX string = "alias-prefix"
+const FLAG_PLACETYPE_PROPERTY string = "placetype-property"
+const FLAG_REMOVE_ALIASES string = "remove"
+
+// type PlacetypeAliasesOptions contains runtime configurations for creating per-placetype filtered aliases
+type PlacetypeAliasesOptions struct {
+	// Client is a `es.Client` instance
+	Client *es.Client
+	// Index is the name of the Elasticsearch index that aliases will point to
+	Index string
+	// Prefix is the string prepended to each placetype name to create an alias. If empty the value of `Index` is used.
+	Prefix string
+	// PlacetypeProperty is the (document) property used to filter records by placetype. For example `wof:placetype`
+	// for properties-only (Spelunker v1) documents or `properties.wof:placetype` for complete GeoJSON Features.
+	PlacetypeProperty string
+	// Remove is a boolean value indicating whether aliases should be removed rather than created
+	Remove bool
+}
+
+// NewPlacetypeAliasesFlagSet creates a new `flag.FlagSet` instance with command-line flags required by the `es-whosonfirst-placetype-aliases` tool.
+func NewPlacetypeAliasesFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("aliases")
+
+	fs.String(FLAG_ES_ENDPOINT, "http://localhost:9200", "A fully-qualified Elasticsearch endpoint.")
+	fs.String(FLAG_ES_INDEX, "millsfield", "A valid Elasticsearch index.")
+	fs.String(FLAG_ALIAS_PREFIX, "", "The prefix to use for each placetype alias. If empty the value of -elasticsearch-index is used.")
+	fs.String(FLAG_PLACETYPE_PROPERTY, "wof:placetype", "The document property to filter placetypes on. Use 'properties.wof:placetype' for indices of complete GeoJSON Features.")
+	fs.Bool(FLAG_REMOVE_ALIASES, false, "Remove placetype aliases rather than creating them.")
+
+	return fs, nil
+}
+
+// PlacetypeAliasesOptionsFromFlagSet returns a `PlacetypeAliasesOptions` instance derived from the values in 'fs'.
+func PlacetypeAliasesOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*PlacetypeAliasesOptions, error) {
+
+	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := lookup.StringVar(fs, FLAG_ALIAS_PREFIX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pt_property, err := lookup.StringVar(fs, FLAG_PLACETYPE_PROPERTY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remove, err := lookup.BoolVar(fs, FLAG_REMOVE_ALIASES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &PlacetypeAliasesOptions{
+		Client:            es_client,
+		Index:             es_index,
+		Prefix:            prefix,
+		PlacetypeProperty: pt_property,
+		Remove:            remove,
+	}
+
+	return opts, nil
+}
+
+// UpdatePlacetypeAliasesWithFlagSet creates (or removes) per-placetype filtered aliases with configuration details defined in 'fs'.
+func UpdatePlacetypeAliasesWithFlagSet(ctx context.Context, fs *flag.FlagSet) ([]string, error) {
+
+	opts, err := PlacetypeAliasesOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return UpdatePlacetypeAliases(ctx, opts)
+}
+
+// UpdatePlacetypeAliases creates (or removes) a filtered alias for every placetype defined by the
+// `whosonfirst/go-whosonfirst-placetypes` package. For example an alias named "whosonfirst_locality" that
+// filters the "whosonfirst" index on `wof:placetype=locality`. This is meant to allow clients written against
+// the Spelunker v1 (Elasticsearch 2.x) schema, which queried `/{INDEX}/{PLACETYPE}/_search` using mapping types,
+// to be ported with a small URL change (`/{INDEX}_{PLACETYPE}/_search`). Returns the list of alias names.
+func UpdatePlacetypeAliases(ctx context.Context, opts *PlacetypeAliasesOptions) ([]string, error) {
+
+	if opts.Client == nil {
+		return nil, errors.New("Missing Elasticsearch client")
+	}
+
+	if opts.Index == "" {
+		return nil, errors.New("Missing Elasticsearch index")
+	}
+
+	pt_property := opts.PlacetypeProperty
+
+	if pt_property == "" {
+		pt_property = "wof:placetype"
+	}
+
+	prefix := opts.Prefix
+
+	if prefix == "" {
+		prefix = opts.Index
+	}
+
+	spec, err := placetypes.DefaultWOFPlacetypeSpecification()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load placetypes specification, %w", err)
+	}
+
+	pt_names := make([]string, 0)
+
+	for _, pt := range spec.Catalog() {
+		pt_names = append(pt_names, pt.Name)
+	}
+
+	sort.Strings(pt_names)
+
+	aliases := make([]string, len(pt_names))
+	actions := make([]interface{}, len(pt_names))
+
+	for idx, pt := range pt_names {
+
+		alias := fmt.Sprintf("%s_%s", prefix, pt)
+		aliases[idx] = alias
+
+		if opts.Remove {
+
+			actions[idx] = map[string]interface{}{
+				"remove": map[string]interface{}{
+					"index": opts.Index,
+					"alias": alias,
+				},
+			}
+
+			continue
+		}
+
+		actions[idx] = map[string]interface{}{
+			"add": map[string]interface{}{
+				"index": opts.Index,
+				"alias": alias,
+				"filter": map[string]interface{}{
+					"term": map[string]interface{}{
+						pt_property: pt,
+					},
+				},
+			},
+		}
+	}
+
+	req := map[string]interface{}{
+		"actions": actions,
+	}
+
+	enc_req, err := json.Marshal(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal aliases request, %w", err)
+	}
+
+	es_client := opts.Client
+
+	rsp, err := es_client.Indices.UpdateAliases(bytes.NewReader(enc_req), es_client.Indices.UpdateAliases.WithContext(ctx))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update aliases, %w", err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return nil, fmt.Errorf("Failed to update aliases, %s", rsp.String())
+	}
+
+	return aliases, nil
+}
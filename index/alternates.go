@@ -0,0 +1,122 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"strconv"
+)
+
+// MAX_ALTERNATE_GEOMETRIES is the maximum number of alternate geometries returned by `GetRecordWithAlternateGeometries`.
+const MAX_ALTERNATE_GEOMETRIES int = 100
+
+// type RecordWithAlternateGeometries is a Who's On First document and all of its alternate geometry documents.
+type RecordWithAlternateGeometries struct {
+	// Record is the `_source` of the principal Who's On First document
+	Record json.RawMessage `json:"record"`
+	// Alternates is the list of `_source` properties for each of the alternate geometry documents belonging to `Record`
+	Alternates []json.RawMessage `json:"alternates"`
+}
+
+// GetRecordWithAlternateGeometries returns the Who's On First document with ID 'id' stored in 'index' along with all
+// of the alternate geometry documents whose `alt:parent_id` property is 'id' stored in 'alt_index'. Alternate geometry
+// documents are assigned the `alt:parent_id` property by the `document.AppendAlternateGeometryProperties` method. If
+// 'alt_index' is empty the value of 'index' is used.
+func GetRecordWithAlternateGeometries(ctx context.Context, es_client *es.Client, index string, alt_index string, id int64) (*RecordWithAlternateGeometries, error) {
+
+	if index == "" {
+		return nil, errors.New("Missing Elasticsearch index")
+	}
+
+	if alt_index == "" {
+		alt_index = index
+	}
+
+	str_id := strconv.FormatInt(id, 10)
+
+	record, ok, err := getDocumentSource(ctx, es_client, index, str_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("Record %d not found", id)
+	}
+
+	// Account for both complete GeoJSON Features and properties-only ("spelunker v1") documents
+
+	query := map[string]interface{}{
+		"size": MAX_ALTERNATE_GEOMETRIES,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{
+						"term": map[string]interface{}{
+							"alt:parent_id": id,
+						},
+					},
+					map[string]interface{}{
+						"term": map[string]interface{}{
+							"properties.alt:parent_id": id,
+						},
+					},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+	}
+
+	enc_query, err := json.Marshal(query)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal alternate geometries query, %w", err)
+	}
+
+	search_rsp, err := es_client.Search(
+		es_client.Search.WithContext(ctx),
+		es_client.Search.WithIndex(alt_index),
+		es_client.Search.WithBody(bytes.NewReader(enc_query)),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to search for alternate geometries, %w", err)
+	}
+
+	defer search_rsp.Body.Close()
+
+	if search_rsp.IsError() {
+		return nil, fmt.Errorf("Failed to search for alternate geometries, %s", search_rsp.String())
+	}
+
+	var results struct {
+		Hits struct {
+			Hits []struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	dec := json.NewDecoder(search_rsp.Body)
+	err = dec.Decode(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode alternate geometries, %w", err)
+	}
+
+	alternates := make([]json.RawMessage, 0)
+
+	for _, h := range results.Hits.Hits {
+		alternates = append(alternates, h.Source)
+	}
+
+	rsp := &RecordWithAlternateGeometries{
+		Record:     json.RawMessage(record),
+		Alternates: alternates,
+	}
+
+	return rsp, nil
+}
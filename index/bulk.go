@@ -7,7 +7,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/cenkalti/backoff/v4"
 	es "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esutil"
 	"github.com/sfomuseum/go-flags/flagset"
@@ -16,21 +15,60 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
 	"github.com/whosonfirst/go-whosonfirst-iterate/v2/iterator"
+	"github.com/whosonfirst/go-whosonfirst-uri"
 	"io"
 	"log"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const FLAG_ES_ENDPOINT string = "elasticsearch-endpoint"
 const FLAG_ES_INDEX string = "elasticsearch-index"
+const FLAG_ES_PIPELINE string = "elasticsearch-pipeline"
+const FLAG_ES_ALT_INDEX string = "elasticsearch-alt-index"
+const FLAG_ES_GEOMETRY_INDEX string = "elasticsearch-geometry-index"
+const FLAG_ES_CONCORDANCES_INDEX string = "elasticsearch-concordances-index"
+const FLAG_ES_CONCORDANCES_PRUNE string = "elasticsearch-concordances-prune"
 const FLAG_ITERATOR_URI string = "iterator-uri"
 const FLAG_INDEX_ALT string = "index-alt-files"
 const FLAG_INDEX_PROPS string = "index-only-properties"
 const FLAG_INDEX_SPELUNKER_V1 string = "index-spelunker-v1"
 const FLAG_APPEND_SPELUNKER_V1 string = "append-spelunker-v1-properties"
 const FLAG_WORKERS string = "workers"
+const FLAG_VALIDATE_GEOMETRIES string = "validate-geometries"
+const FLAG_SIMPLIFY_ALGORITHM string = "simplify-algorithm"
+const FLAG_SIMPLIFY_TOLERANCE string = "simplify-tolerance"
+const FLAG_SIMPLIFY_MAX_VERTICES string = "simplify-max-vertices"
+const FLAG_SIMPLIFY_MAX_BYTES string = "simplify-max-bytes"
+const FLAG_SIMPLIFY_ORIGINAL_PATH string = "simplify-original-geometry-path"
+const FLAG_COORDINATE_PRECISION string = "coordinate-precision"
+const FLAG_APPEND_LOCATION string = "append-location"
+const FLAG_APPEND_GEOMETRY_STATS string = "append-geometry-stats"
+const FLAG_APPEND_SPATIAL_CELLS string = "append-spatial-cells"
+const FLAG_CELLS_GEOHASH_PRECISIONS string = "spatial-cells-geohash-precisions"
+const FLAG_CELLS_TILE_ZOOMS string = "spatial-cells-tile-zooms"
+const FLAG_CELLS_COVER_POLYGONS string = "spatial-cells-cover-polygons"
+const FLAG_CELLS_COVER_PRECISION string = "spatial-cells-cover-precision"
+const FLAG_CELLS_MAX_COVER_CELLS string = "spatial-cells-max-cover-cells"
+const FLAG_LOCATION_PRECEDENCE string = "location-centroid-precedence"
+const FLAG_EDTF_OPEN_CESSATION string = "edtf-open-cessation"
+const FLAG_EDTF_WIDEN_UNKNOWN string = "edtf-widen-unknown"
+const FLAG_EDTF_DATE_RANGES string = "edtf-date-ranges"
+const FLAG_APPEND_LIFECYCLE string = "append-lifecycle"
+const FLAG_APPEND_HIERARCHY_IDS string = "append-hierarchy-ids"
+const FLAG_HIERARCHY_NAMES_DATA string = "hierarchy-names-data-root"
+const FLAG_HIERARCHY_NAMES_LOOKUP string = "hierarchy-names-lookup"
+const FLAG_PLACETYPES_SPECIFICATION string = "placetypes-specification"
+const FLAG_APPEND_NAME_FIELDS string = "append-name-fields"
+const FLAG_APPEND_NAME_VARIANTS string = "append-name-variants"
+const FLAG_APPEND_SUGGESTIONS string = "append-suggestions"
+const FLAG_SUGGEST_LANGUAGES string = "suggest-languages"
+const FLAG_APPEND_SEARCH_RANK string = "append-search-rank"
+const FLAG_SEARCH_RANK_WEIGHTS string = "search-rank-weights"
 
 // type RunBulkIndexerOptions contains runtime configurations for bulk indexing
 type RunBulkIndexerOptions struct {
@@ -44,6 +82,33 @@ type RunBulkIndexerOptions struct {
 	IteratorPaths []string
 	// IndexAltFiles is a boolean value indicating whether or not to index "alternate geometry" files
 	IndexAltFiles bool
+	// AltIndex is the optional name of a separate Elasticsearch index to index "alternate geometry" files in. If empty they are
+	// indexed in the same index as all other records.
+	AltIndex string
+	// GeometryIndex is the optional name of a separate Elasticsearch index to index geometries in. If present a document
+	// containing only the geometry and minimal properties of each record (see `document.PrepareGeometryDocument`) is
+	// indexed in this index using the same document ID as the record itself. PrepareFuncs are expected to remove geometries
+	// from the documents indexed in the default index.
+	GeometryIndex string
+	// GeometryPrepareFuncs are zero or more `document.PrepareDocumentFunc` used to transform geometry documents before indexing
+	GeometryPrepareFuncs []document.PrepareDocumentFunc
+	// ConcordancesIndex is the optional name of a separate Elasticsearch index to index concordances in. If present one
+	// document (see `ConcordanceRecord`) is indexed in this index for each (source, external ID) pair in the `wof:concordances`
+	// property of each record. Alternate geometry files are not indexed.
+	ConcordancesIndex string
+	// PruneConcordances is a boolean value indicating whether to remove the existing documents in `ConcordancesIndex` for
+	// pairs that are no longer present in the records that have been indexed. This is done in a single pass (see
+	// `DeleteStaleConcordances`) once all the documents have been indexed. Requires `Client` to be set.
+	PruneConcordances bool
+	// SecondaryBulkIndexer is an optional `esutil.BulkIndexer` instance used to index documents in `GeometryIndex` and
+	// `ConcordancesIndex`. If empty `BulkIndexer` is used. This allows documents in those indices to be indexed without
+	// the ingest pipeline, if any, used by `BulkIndexer`.
+	SecondaryBulkIndexer esutil.BulkIndexer
+	// Client is an optional `es.Client` instance used for operations that can not be performed by the bulk indexer, for
+	// example removing stale concordance documents.
+	Client *es.Client
+	// Report is an optional `document.Report` instance that will be made available to PrepareFuncs and logged when indexing is complete
+	Report *document.Report
 }
 
 // NewBulkIndexerFlagSet creates a new `flag.FlagSet` instance with command-line flags required by the `es-whosonfirst-index` tool.
@@ -56,11 +121,46 @@ func NewBulkIndexerFlagSet(ctx context.Context) (*flag.FlagSet, error) {
 
 	fs.String(FLAG_ES_ENDPOINT, "http://localhost:9200", "A fully-qualified Elasticsearch endpoint.")
 	fs.String(FLAG_ES_INDEX, "millsfield", "A valid Elasticsearch index.")
+	fs.String(FLAG_ES_PIPELINE, "", "The name of an (existing) Elasticsearch ingest pipeline to process documents with.")
+	fs.String(FLAG_ES_ALT_INDEX, "", "An optional Elasticsearch index to index alternate geometries in. If empty alternate geometries are indexed in the -elasticsearch-index index.")
+	fs.String(FLAG_ES_GEOMETRY_INDEX, "", "An optional Elasticsearch index to index geometries in. If set properties-only documents are indexed in the -elasticsearch-index index and geometries, with minimal properties, are indexed in this index using the same document ID.")
+	fs.String(FLAG_ES_CONCORDANCES_INDEX, "", "An optional Elasticsearch index to index concordances in. If set one document is indexed for each (source, external ID) to wof:id pair in each record's wof:concordances property.")
+	fs.Bool(FLAG_ES_CONCORDANCES_PRUNE, false, "Once indexing is complete remove the documents in the -elasticsearch-concordances-index index for pairs that are no longer present in the records that were indexed.")
 	fs.String(FLAG_ITERATOR_URI, "repo://", iterator_desc)
 	fs.Bool(FLAG_INDEX_ALT, false, "Index alternate geometries.")
 	fs.Bool(FLAG_INDEX_PROPS, false, "Only index GeoJSON Feature properties (not geometries).")
 	fs.Bool(FLAG_INDEX_SPELUNKER_V1, false, "Index GeoJSON Feature properties inclusive of auto-generated Whos On First Spelunker properties.")
 	fs.Bool(FLAG_APPEND_SPELUNKER_V1, false, "Append and index auto-generated Whos On First Spelunker properties.")
+	fs.Bool(FLAG_VALIDATE_GEOMETRIES, false, "Validate and, where possible, repair geometries for indexing as geo_shape properties. Geometries that can not be repaired are moved to an \"invalid_geometry\" property.")
+	fs.String(FLAG_SIMPLIFY_ALGORITHM, "", "The algorithm used to simplify geometries. Valid options are: douglas-peucker, visvalingam. If empty geometries are not simplified.")
+	fs.Float64(FLAG_SIMPLIFY_TOLERANCE, 0.0001, "The simplification tolerance, in decimal degrees for douglas-peucker or square decimal degrees for visvalingam.")
+	fs.Int(FLAG_SIMPLIFY_MAX_VERTICES, 0, "Only simplify geometries with more than this number of vertices. If 0 this test is not applied.")
+	fs.Int(FLAG_SIMPLIFY_MAX_BYTES, 0, "Only simplify geometries whose JSON encoding is larger than this number of bytes. If 0 this test is not applied.")
+	fs.String(FLAG_SIMPLIFY_ORIGINAL_PATH, "", "An optional path to store the original geometry of simplified records in. This path should be mapped as a geo_shape and excluded from _source. If empty the original geometry is discarded.")
+	fs.Int(FLAG_COORDINATE_PRECISION, 0, "The number of decimal places to round coordinates to. If 0 coordinates are not rounded.")
+	fs.Bool(FLAG_APPEND_GEOMETRY_STATS, false, "Append statistics (area, perimeter, number of rings and vertices, etc.) derived from geometries. These are always appended when -index-spelunker-v1 or -append-spelunker-v1-properties are enabled.")
+	fs.Bool(FLAG_APPEND_LOCATION, false, "Append derived \"location\" (geo_point) and \"envelope\" (geo_shape) properties.")
+	fs.String(FLAG_LOCATION_PRECEDENCE, strings.Join(document.DEFAULT_CENTROID_PRECEDENCE, ","), "A comma-separated list of property prefixes, in order of precedence, used to derive the \"location\" property.")
+	fs.Bool(FLAG_APPEND_SPATIAL_CELLS, false, "Append hierarchical spatial cell identifiers (geohashes and, optionally, map tile quadkeys) derived from each record's centroid.")
+	fs.String(FLAG_CELLS_GEOHASH_PRECISIONS, "1,2,3,4,5,6,7", "A comma-separated list of geohash precisions to derive spatial cell identifiers for.")
+	fs.String(FLAG_CELLS_TILE_ZOOMS, "", "An optional comma-separated list of map tile zoom levels to derive quadkey spatial cell identifiers for.")
+	fs.Bool(FLAG_CELLS_COVER_POLYGONS, false, "Append the list of geohashes covering each record's polygons.")
+	fs.Int(FLAG_CELLS_COVER_PRECISION, document.DEFAULT_COVER_PRECISION, "The geohash precision used to derive polygon coverage cells.")
+	fs.Int(FLAG_CELLS_MAX_COVER_CELLS, document.DEFAULT_MAX_COVER_CELLS, "The maximum number of polygon coverage cells. If a polygon needs more cells the precision is reduced.")
+	fs.String(FLAG_EDTF_OPEN_CESSATION, "", "How to map open (\"..\") edtf:cessation dates to date ranges. Valid options are: now, future. If empty no date range is assigned.")
+	fs.Bool(FLAG_EDTF_WIDEN_UNKNOWN, false, "Map unknown (and open edtf:inception) EDTF dates to the widest plausible date range.")
+	fs.Bool(FLAG_EDTF_DATE_RANGES, false, "Append Elasticsearch date_range properties for inception, cessation and existence date ranges.")
+	fs.Bool(FLAG_APPEND_LIFECYCLE, false, "Append normalized lifecycle properties (is_current, is_deprecated, is_ceased, is_superseded, is_superseding and lifecycle:status).")
+	fs.Bool(FLAG_APPEND_HIERARCHY_IDS, false, "Append per-placetype ancestor ID properties (for example hierarchy:region_id) derived from all wof:hierarchy entries, assigning wof:belongsto if it is missing and flagging records where it is inconsistent.")
+	fs.String(FLAG_HIERARCHY_NAMES_DATA, "", "The path to a local Who's On First data directory used to resolve the names of ancestors in wof:hierarchy properties. If set ancestor names are appended to each record.")
+	fs.String(FLAG_HIERARCHY_NAMES_LOOKUP, "", "The path to a line-delimited JSON (or GeoJSON) lookup file used to resolve the names of ancestors in wof:hierarchy properties. If set ancestor names are appended to each record.")
+	fs.Bool(FLAG_APPEND_NAME_FIELDS, false, "Append per-language \"names\" objects (for example names.eng.preferred) and a \"names:all\" property derived from name:* properties. These should be mapped using the index template produced by the es-whosonfirst-names-template tool.")
+	fs.Bool(FLAG_APPEND_NAME_VARIANTS, false, "Append ASCII-folded (\"names:folded\") and transliterated (\"names:transliterated\") name variants and per-language collation sort keys (for example \"sort:name_deu\").")
+	fs.Bool(FLAG_APPEND_SUGGESTIONS, false, "Append autocomplete suggestions (\"suggest\" for completion fields and \"suggest:inputs\" for search_as_you_type fields) derived from preferred and variant names, with hierarchy context if ancestor names are appended, weighted by placetype, population and number of names.")
+	fs.String(FLAG_SUGGEST_LANGUAGES, "", "An optional comma-separated list of (ISO 639-3) languages whose names are used as autocomplete suggestions. If empty all languages are used.")
+	fs.Bool(FLAG_APPEND_SEARCH_RANK, false, "Append a normalized \"search:rank\" property derived from population, placetype, number of name translations, number of concordances and current/deprecated status.")
+	fs.String(FLAG_SEARCH_RANK_WEIGHTS, "", "An optional comma-separated list of {SIGNAL}={WEIGHT} pairs used to override the default weights for the \"search:rank\" property. Valid signals are: population, placetype, translations, concordances, current, deprecated.")
+	fs.String(FLAG_PLACETYPES_SPECIFICATION, "", "The path to a custom Who's On First placetypes specification (JSON) file. Placetypes in this file are added to, or replace, those in the default specification. If set placetype details (IDs, roles, ancestors and descendants) are appended to each record.")
 	fs.Int(FLAG_WORKERS, 0, "The number of concurrent workers to index data using. Default is the value of runtime.NumCPU().")
 
 	// debug := fs.Bool("debug", false, "...")
@@ -90,46 +190,679 @@ func PrepareFuncsFromFlagSet(ctx context.Context, fs *flag.FlagSet) ([]document.
 		return nil, err
 	}
 
+	validate_geoms, err := lookup.BoolVar(fs, FLAG_VALIDATE_GEOMETRIES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	append_geom_stats, err := lookup.BoolVar(fs, FLAG_APPEND_GEOMETRY_STATS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geometry_index, err := lookup.StringVar(fs, FLAG_ES_GEOMETRY_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	append_lifecycle, err := lookup.BoolVar(fs, FLAG_APPEND_LIFECYCLE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	append_hierarchy_ids, err := lookup.BoolVar(fs, FLAG_APPEND_HIERARCHY_IDS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	append_name_fields, err := lookup.BoolVar(fs, FLAG_APPEND_NAME_FIELDS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	append_name_variants, err := lookup.BoolVar(fs, FLAG_APPEND_NAME_VARIANTS)
+
+	if err != nil {
+		return nil, err
+	}
+
 	if index_spelunker_v1 {
 
-		if index_only_props {
-			msg := fmt.Sprintf("-%s can not be used when -%s is enabled", FLAG_INDEX_PROPS, FLAG_INDEX_SPELUNKER_V1)
-			return nil, errors.New(msg)
+		if index_only_props {
+			msg := fmt.Sprintf("-%s can not be used when -%s is enabled", FLAG_INDEX_PROPS, FLAG_INDEX_SPELUNKER_V1)
+			return nil, errors.New(msg)
+		}
+
+		if append_spelunker_v1 {
+			msg := fmt.Sprintf("-%s can not be used when -%s is enabled", FLAG_APPEND_SPELUNKER_V1, FLAG_INDEX_SPELUNKER_V1)
+			return nil, errors.New(msg)
+		}
+	}
+
+	prepare_funcs := make([]document.PrepareDocumentFunc, 0)
+
+	// Functions that operate on geometries need to be applied before any
+	// functions that extract (and return) only the properties of a record.
+
+	simplify_func, err := simplifyGeometryFuncFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if simplify_func != nil {
+		prepare_funcs = append(prepare_funcs, simplify_func)
+	}
+
+	if validate_geoms {
+		prepare_funcs = append(prepare_funcs, document.ValidateGeometry)
+	}
+
+	location_func, err := appendLocationFuncFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if location_func != nil {
+		prepare_funcs = append(prepare_funcs, location_func)
+	}
+
+	if append_geom_stats && !index_spelunker_v1 && !append_spelunker_v1 {
+		prepare_funcs = append(prepare_funcs, document.AppendGeometryStats)
+	}
+
+	cells_func, err := appendSpatialCellsFuncFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cells_func != nil {
+		prepare_funcs = append(prepare_funcs, cells_func)
+	}
+
+	// The Spelunker v1 functions apply EDTF updates and append placetype details themselves so make sure they are only applied once
+
+	edtf_opts, err := edtfOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	placetypes_opts, err := placetypeDetailsOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spelunker_opts := &document.SpelunkerV1Options{
+		EDTF:       edtf_opts,
+		Placetypes: placetypes_opts,
+	}
+
+	if index_spelunker_v1 {
+
+		spelunker_func, err := document.NewPrepareSpelunkerV1DocumentFunc(ctx, spelunker_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, spelunker_func)
+	}
+
+	if index_only_props {
+		prepare_funcs = append(prepare_funcs, document.ExtractProperties)
+	}
+
+	if append_spelunker_v1 {
+
+		spelunker_func, err := document.NewAppendSpelunkerV1PropertiesFunc(ctx, spelunker_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, spelunker_func)
+	}
+
+	if placetypes_opts != nil && !index_spelunker_v1 && !append_spelunker_v1 {
+
+		placetypes_func, err := document.NewAppendPlacetypeDetailsFunc(ctx, placetypes_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, placetypes_func)
+	}
+
+	if !index_spelunker_v1 && !append_spelunker_v1 {
+
+		edtf_func, err := document.NewPrepareEDTFFunc(ctx, edtf_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, edtf_func)
+	}
+
+	if append_lifecycle {
+		prepare_funcs = append(prepare_funcs, document.AppendLifecycleProperties)
+	}
+
+	if append_hierarchy_ids {
+		prepare_funcs = append(prepare_funcs, document.AppendHierarchyIds)
+	}
+
+	hierarchy_names_func, err := appendHierarchyNamesFuncFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hierarchy_names_func != nil {
+		prepare_funcs = append(prepare_funcs, hierarchy_names_func)
+	}
+
+	if append_name_fields {
+		prepare_funcs = append(prepare_funcs, document.AppendNameFields)
+	}
+
+	if append_name_variants {
+		prepare_funcs = append(prepare_funcs, document.AppendNameVariants)
+	}
+
+	// Suggestions need to be appended after ancestor names
+
+	suggestions_func, err := appendSuggestionsFuncFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if suggestions_func != nil {
+		prepare_funcs = append(prepare_funcs, suggestions_func)
+	}
+
+	search_rank_func, err := appendSearchRankFuncFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if search_rank_func != nil {
+		prepare_funcs = append(prepare_funcs, search_rank_func)
+	}
+
+	// Geometries are indexed separately so make sure that only properties are indexed here
+
+	if geometry_index != "" && !index_spelunker_v1 && !index_only_props {
+		prepare_funcs = append(prepare_funcs, document.ExtractProperties)
+	}
+
+	return prepare_funcs, nil
+}
+
+// GeometryPrepareFuncsFromFlagSet returns a list of zero or more known `document.PrepareDocumentFunc` functions
+// to apply to documents indexed in a separate geometry index based on the values in 'fs'. Geometries in the
+// geometry index are never simplified.
+func GeometryPrepareFuncsFromFlagSet(ctx context.Context, fs *flag.FlagSet) ([]document.PrepareDocumentFunc, error) {
+
+	validate_geoms, err := lookup.BoolVar(fs, FLAG_VALIDATE_GEOMETRIES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prepare_funcs := make([]document.PrepareDocumentFunc, 0)
+
+	if validate_geoms {
+		prepare_funcs = append(prepare_funcs, document.ValidateGeometry)
+	}
+
+	return prepare_funcs, nil
+}
+
+// simplifyGeometryFuncFromFlagSet returns a `document.PrepareDocumentFunc` for simplifying geometries derived from
+// the values in 'fs' or nil if neither simplification or coordinate precision reduction are enabled.
+func simplifyGeometryFuncFromFlagSet(ctx context.Context, fs *flag.FlagSet) (document.PrepareDocumentFunc, error) {
+
+	algorithm, err := lookup.StringVar(fs, FLAG_SIMPLIFY_ALGORITHM)
+
+	if err != nil {
+		return nil, err
+	}
+
+	precision, err := lookup.IntVar(fs, FLAG_COORDINATE_PRECISION)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithm == "" && precision <= 0 {
+		return nil, nil
+	}
+
+	tolerance, err := lookup.Float64Var(fs, FLAG_SIMPLIFY_TOLERANCE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	max_vertices, err := lookup.IntVar(fs, FLAG_SIMPLIFY_MAX_VERTICES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	max_bytes, err := lookup.IntVar(fs, FLAG_SIMPLIFY_MAX_BYTES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	original_path, err := lookup.StringVar(fs, FLAG_SIMPLIFY_ORIGINAL_PATH)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &document.SimplifyGeometryOptions{
+		Algorithm:            algorithm,
+		Tolerance:            tolerance,
+		MaxVertices:          max_vertices,
+		MaxBytes:             max_bytes,
+		Precision:            precision,
+		OriginalGeometryPath: original_path,
+	}
+
+	return document.NewSimplifyGeometryFunc(ctx, opts)
+}
+
+// appendLocationFuncFromFlagSet returns a `document.PrepareDocumentFunc` for appending location properties derived from
+// the values in 'fs' or nil if location properties are not enabled.
+func appendLocationFuncFromFlagSet(ctx context.Context, fs *flag.FlagSet) (document.PrepareDocumentFunc, error) {
+
+	append_location, err := lookup.BoolVar(fs, FLAG_APPEND_LOCATION)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !append_location {
+		return nil, nil
+	}
+
+	str_precedence, err := lookup.StringVar(fs, FLAG_LOCATION_PRECEDENCE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &document.AppendLocationOptions{
+		CentroidPrecedence: stringsFromString(str_precedence),
+	}
+
+	return document.NewAppendLocationFunc(ctx, opts)
+}
+
+// appendSpatialCellsFuncFromFlagSet returns a `document.PrepareDocumentFunc` for appending spatial cell identifiers derived
+// from the values in 'fs' or nil if spatial cells are not enabled.
+func appendSpatialCellsFuncFromFlagSet(ctx context.Context, fs *flag.FlagSet) (document.PrepareDocumentFunc, error) {
+
+	append_cells, err := lookup.BoolVar(fs, FLAG_APPEND_SPATIAL_CELLS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !append_cells {
+		return nil, nil
+	}
+
+	str_precisions, err := lookup.StringVar(fs, FLAG_CELLS_GEOHASH_PRECISIONS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	precisions, err := intsFromString(str_precisions)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid -%s flag, %w", FLAG_CELLS_GEOHASH_PRECISIONS, err)
+	}
+
+	str_zooms, err := lookup.StringVar(fs, FLAG_CELLS_TILE_ZOOMS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	zooms, err := intsFromString(str_zooms)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid -%s flag, %w", FLAG_CELLS_TILE_ZOOMS, err)
+	}
+
+	str_precedence, err := lookup.StringVar(fs, FLAG_LOCATION_PRECEDENCE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cover_polygons, err := lookup.BoolVar(fs, FLAG_CELLS_COVER_POLYGONS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cover_precision, err := lookup.IntVar(fs, FLAG_CELLS_COVER_PRECISION)
+
+	if err != nil {
+		return nil, err
+	}
+
+	max_cover_cells, err := lookup.IntVar(fs, FLAG_CELLS_MAX_COVER_CELLS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &document.AppendSpatialCellsOptions{
+		GeohashPrecisions:  precisions,
+		TileZooms:          zooms,
+		CentroidPrecedence: stringsFromString(str_precedence),
+		CoverPolygons:      cover_polygons,
+		CoverPrecision:     cover_precision,
+		MaxCoverCells:      max_cover_cells,
+	}
+
+	return document.NewAppendSpatialCellsFunc(ctx, opts)
+}
+
+// edtfOptionsFromFlagSet returns the `document.AppendEDTFRangesOptions` used to apply EDTF-related updates derived from
+// the values in 'fs'. These are passed to the Spelunker v1 functions, which apply EDTF updates themselves, or used to
+// create a separate `document.PrepareDocumentFunc`.
+func edtfOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*document.AppendEDTFRangesOptions, error) {
+
+	open_cessation, err := lookup.StringVar(fs, FLAG_EDTF_OPEN_CESSATION)
+
+	if err != nil {
+		return nil, err
+	}
+
+	widen_unknown, err := lookup.BoolVar(fs, FLAG_EDTF_WIDEN_UNKNOWN)
+
+	if err != nil {
+		return nil, err
+	}
+
+	date_ranges, err := lookup.BoolVar(fs, FLAG_EDTF_DATE_RANGES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &document.AppendEDTFRangesOptions{
+		OpenCessation: open_cessation,
+		WidenUnknown:  widen_unknown,
+		DateRanges:    date_ranges,
+	}
+
+	return opts, nil
+}
+
+// appendHierarchyNamesFuncFromFlagSet returns a `document.PrepareDocumentFunc` for appending the names of ancestors derived
+// from the values in 'fs' or nil if neither a data directory or lookup file are defined.
+func appendHierarchyNamesFuncFromFlagSet(ctx context.Context, fs *flag.FlagSet) (document.PrepareDocumentFunc, error) {
+
+	data_root, err := lookup.StringVar(fs, FLAG_HIERARCHY_NAMES_DATA)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lookup_path, err := lookup.StringVar(fs, FLAG_HIERARCHY_NAMES_LOOKUP)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var r document.HierarchyReader
+
+	switch {
+	case data_root != "" && lookup_path != "":
+		msg := fmt.Sprintf("-%s can not be used when -%s is set", FLAG_HIERARCHY_NAMES_LOOKUP, FLAG_HIERARCHY_NAMES_DATA)
+		return nil, errors.New(msg)
+	case data_root != "":
+
+		local_r, err := document.NewLocalHierarchyReader(ctx, data_root)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create hierarchy reader, %w", err)
+		}
+
+		r, err = document.NewCachedHierarchyReader(ctx, local_r)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create cached hierarchy reader, %w", err)
+		}
+
+	case lookup_path != "":
+
+		r, err = document.NewLookupHierarchyReader(ctx, lookup_path)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create hierarchy reader, %w", err)
+		}
+
+	default:
+		return nil, nil
+	}
+
+	opts := &document.AppendHierarchyNamesOptions{
+		Reader: r,
+	}
+
+	return document.NewAppendHierarchyNamesFunc(ctx, opts)
+}
+
+// placetypeDetailsOptionsFromFlagSet returns a `document.AppendPlacetypeDetailsOptions` instance for appending placetype details,
+// resolved using a custom placetypes specification, derived from the values in 'fs'. If no custom specification is defined the
+// method returns nil.
+func placetypeDetailsOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*document.AppendPlacetypeDetailsOptions, error) {
+
+	spec_path, err := lookup.StringVar(fs, FLAG_PLACETYPES_SPECIFICATION)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if spec_path == "" {
+		return nil, nil
+	}
+
+	fh, err := os.Open(spec_path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", spec_path, err)
+	}
+
+	defer fh.Close()
+
+	spec, err := document.NewPlacetypeSpecificationWithReader(ctx, fh)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create placetypes specification, %w", err)
+	}
+
+	opts := &document.AppendPlacetypeDetailsOptions{
+		Specification: spec,
+	}
+
+	return opts, nil
+}
+
+// appendSuggestionsFuncFromFlagSet returns a `document.PrepareDocumentFunc` for appending autocomplete suggestions derived
+// from the values in 'fs'. If suggestions are not enabled the method returns nil.
+func appendSuggestionsFuncFromFlagSet(ctx context.Context, fs *flag.FlagSet) (document.PrepareDocumentFunc, error) {
+
+	append_suggestions, err := lookup.BoolVar(fs, FLAG_APPEND_SUGGESTIONS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !append_suggestions {
+		return nil, nil
+	}
+
+	str_languages, err := lookup.StringVar(fs, FLAG_SUGGEST_LANGUAGES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &document.AppendSuggestionsOptions{
+		Languages: stringsFromString(str_languages),
+	}
+
+	return document.NewAppendSuggestionsFunc(ctx, opts)
+}
+
+// appendSearchRankFuncFromFlagSet returns a `document.PrepareDocumentFunc` for appending a normalized search rank derived
+// from the values in 'fs'. If search ranks are not enabled the method returns nil.
+func appendSearchRankFuncFromFlagSet(ctx context.Context, fs *flag.FlagSet) (document.PrepareDocumentFunc, error) {
+
+	append_rank, err := lookup.BoolVar(fs, FLAG_APPEND_SEARCH_RANK)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !append_rank {
+		return nil, nil
+	}
+
+	str_weights, err := lookup.StringVar(fs, FLAG_SEARCH_RANK_WEIGHTS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	weights, err := searchRankWeightsFromString(str_weights)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid -%s flag, %w", FLAG_SEARCH_RANK_WEIGHTS, err)
+	}
+
+	opts := &document.AppendSearchRankOptions{
+		Weights: weights,
+	}
+
+	return document.NewAppendSearchRankFunc(ctx, opts)
+}
+
+// searchRankWeightsFromString returns a `document.SearchRankWeights` instance derived from `document.DEFAULT_SEARCH_RANK_WEIGHTS`
+// with the weights in the comma-separated list of {SIGNAL}={WEIGHT} pairs in 'str' applied.
+func searchRankWeightsFromString(str string) (*document.SearchRankWeights, error) {
+
+	weights := document.DEFAULT_SEARCH_RANK_WEIGHTS
+
+	for _, pair := range stringsFromString(str) {
+
+		parts := strings.SplitN(pair, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid weight '%s'", pair)
 		}
 
-		if append_spelunker_v1 {
-			msg := fmt.Sprintf("-%s can not be used when -%s is enabled", FLAG_APPEND_SPELUNKER_V1, FLAG_INDEX_SPELUNKER_V1)
-			return nil, errors.New(msg)
+		w, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid weight '%s', %w", pair, err)
 		}
-	}
 
-	prepare_funcs := make([]document.PrepareDocumentFunc, 0)
+		if w < 0 {
+			return nil, fmt.Errorf("Invalid weight '%s', weights must not be negative", pair)
+		}
 
-	if index_spelunker_v1 {
-		prepare_funcs = append(prepare_funcs, document.PrepareSpelunkerV1Document)
+		switch strings.TrimSpace(parts[0]) {
+		case "population":
+			weights.Population = w
+		case "placetype":
+			weights.Placetype = w
+		case "translations":
+			weights.Translations = w
+		case "concordances":
+			weights.Concordances = w
+		case "current":
+			weights.Current = w
+		case "deprecated":
+			weights.Deprecated = w
+		default:
+			return nil, fmt.Errorf("Invalid signal '%s'", parts[0])
+		}
 	}
 
-	if index_only_props {
-		prepare_funcs = append(prepare_funcs, document.ExtractProperties)
+	return &weights, nil
+}
+
+// stringsFromString returns the list of non-empty, whitespace-trimmed values in the comma-separated string 'str'.
+func stringsFromString(str string) []string {
+
+	values := make([]string, 0)
+
+	for _, v := range strings.Split(str, ",") {
+
+		v = strings.TrimSpace(v)
+
+		if v != "" {
+			values = append(values, v)
+		}
 	}
 
-	if append_spelunker_v1 {
-		prepare_funcs = append(prepare_funcs, document.AppendSpelunkerV1Properties)
+	return values
+}
+
+// intsFromString returns the list of integers in the comma-separated string 'str'.
+func intsFromString(str string) ([]int, error) {
+
+	values := make([]int, 0)
+
+	for _, str_v := range stringsFromString(str) {
+
+		v, err := strconv.Atoi(str_v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid integer '%s', %w", str_v, err)
+		}
+
+		values = append(values, v)
 	}
 
-	return prepare_funcs, nil
+	return values, nil
 }
 
 // BulkIndexerFromFlagSet returns a esutil.BulkIndexer instance derived from the values in 'fs'.
 func BulkIndexerFromFlagSet(ctx context.Context, fs *flag.FlagSet) (esutil.BulkIndexer, error) {
 
-	es_endpoint, err := lookup.StringVar(fs, FLAG_ES_ENDPOINT)
+	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
 
 	if err != nil {
 		return nil, err
 	}
 
-	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
+	es_pipeline, err := lookup.StringVar(fs, FLAG_ES_PIPELINE)
 
 	if err != nil {
 		return nil, err
@@ -141,48 +874,75 @@ func BulkIndexerFromFlagSet(ctx context.Context, fs *flag.FlagSet) (esutil.BulkI
 		return nil, err
 	}
 
-	retry := backoff.NewExponentialBackOff()
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if es_pipeline != "" {
 
-	es_cfg := es.Config{
-		Addresses: []string{es_endpoint},
+		err = EnsurePipeline(ctx, es_client, es_pipeline)
 
-		RetryOnStatus: []int{502, 503, 504, 429},
-		RetryBackoff: func(i int) time.Duration {
-			if i == 1 {
-				retry.Reset()
-			}
-			return retry.NextBackOff()
-		},
-		MaxRetries: 5,
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	/*
+	_, err = es_client.Indices.Create(es_index)
 
-		if debug {
+	if err != nil {
+		return nil, err
+	}
 
-			es_logger := &estransport.ColorLogger{
-				Output:             os.Stdout,
-				EnableRequestBody:  true,
-				EnableResponseBody: true,
-			}
+	es_alt_index, err := lookup.StringVar(fs, FLAG_ES_ALT_INDEX)
 
-			es_cfg.Logger = es_logger
-		}
+	if err != nil {
+		return nil, err
+	}
+
+	if es_alt_index != "" {
 
-	*/
+		_, err = es_client.Indices.Create(es_alt_index)
+
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	es_client, err := es.NewClient(es_cfg)
+	es_geometry_index, err := lookup.StringVar(fs, FLAG_ES_GEOMETRY_INDEX)
 
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = es_client.Indices.Create(es_index)
+	if es_geometry_index != "" {
+
+		_, err = es_client.Indices.Create(es_geometry_index)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	es_concordances_index, err := lookup.StringVar(fs, FLAG_ES_CONCORDANCES_INDEX)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if es_concordances_index != "" {
+
+		_, err = es_client.Indices.Create(
+			es_concordances_index,
+			es_client.Indices.Create.WithBody(strings.NewReader(CONCORDANCES_MAPPINGS)),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// https://github.com/elastic/go-elasticsearch/blob/master/_examples/bulk/indexer.go
 
 	bi_cfg := esutil.BulkIndexerConfig{
@@ -190,6 +950,7 @@ func BulkIndexerFromFlagSet(ctx context.Context, fs *flag.FlagSet) (esutil.BulkI
 		Client:        es_client,
 		NumWorkers:    workers,
 		FlushInterval: 30 * time.Second,
+		Pipeline:      es_pipeline,
 	}
 
 	bi, err := esutil.NewBulkIndexer(bi_cfg)
@@ -201,6 +962,49 @@ func BulkIndexerFromFlagSet(ctx context.Context, fs *flag.FlagSet) (esutil.BulkI
 	return bi, nil
 }
 
+// secondaryBulkIndexerFromFlagSet returns a esutil.BulkIndexer instance, without an ingest pipeline, for indexing documents
+// in the geometry and concordances indices derived from the values in 'fs' or nil if an ingest pipeline is not defined.
+// Indices are expected to have been created by `BulkIndexerFromFlagSet`.
+func secondaryBulkIndexerFromFlagSet(ctx context.Context, fs *flag.FlagSet) (esutil.BulkIndexer, error) {
+
+	es_pipeline, err := lookup.StringVar(fs, FLAG_ES_PIPELINE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if es_pipeline == "" {
+		return nil, nil
+	}
+
+	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	workers, err := lookup.IntVar(fs, FLAG_WORKERS)
+
+	if err != nil {
+		return nil, err
+	}
+
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bi_cfg := esutil.BulkIndexerConfig{
+		Index:         es_index,
+		Client:        es_client,
+		NumWorkers:    workers,
+		FlushInterval: 30 * time.Second,
+	}
+
+	return esutil.NewBulkIndexer(bi_cfg)
+}
+
 // RunBulkIndexerOptionsFromFlagSet returns a `RunBulkIndexerOptions` instance derived from the values in 'fs'.
 func RunBulkIndexerOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunBulkIndexerOptions, error) {
 
@@ -216,26 +1020,91 @@ func RunBulkIndexerOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*R
 		return nil, err
 	}
 
+	alt_index, err := lookup.StringVar(fs, FLAG_ES_ALT_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geometry_index, err := lookup.StringVar(fs, FLAG_ES_GEOMETRY_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	concordances_index, err := lookup.StringVar(fs, FLAG_ES_CONCORDANCES_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	prune_concordances, err := lookup.BoolVar(fs, FLAG_ES_CONCORDANCES_PRUNE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if prune_concordances && concordances_index == "" {
+		return nil, fmt.Errorf("-%s requires -%s to be set", FLAG_ES_CONCORDANCES_PRUNE, FLAG_ES_CONCORDANCES_INDEX)
+	}
+
 	bi, err := BulkIndexerFromFlagSet(ctx, fs)
 
 	if err != nil {
 		return nil, err
 	}
 
+	var secondary_bi esutil.BulkIndexer
+
+	if geometry_index != "" || concordances_index != "" {
+
+		secondary_bi, err = secondaryBulkIndexerFromFlagSet(ctx, fs)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
 	prepare_funcs, err := PrepareFuncsFromFlagSet(ctx, fs)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to derive default prepare funcs from flagset, %w", err)
 	}
 
+	geometry_prepare_funcs, err := GeometryPrepareFuncsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive geometry prepare funcs from flagset, %w", err)
+	}
+
 	iterator_paths := fs.Args()
 
 	opts := &RunBulkIndexerOptions{
-		BulkIndexer:   bi,
-		PrepareFuncs:  prepare_funcs,
-		IteratorURI:   iterator_uri,
-		IteratorPaths: iterator_paths,
-		IndexAltFiles: index_alt,
+		BulkIndexer:       bi,
+		PrepareFuncs:      prepare_funcs,
+		IteratorURI:       iterator_uri,
+		IteratorPaths:     iterator_paths,
+		IndexAltFiles:     index_alt,
+		AltIndex:          alt_index,
+		GeometryIndex:     geometry_index,
+		ConcordancesIndex: concordances_index,
+		PruneConcordances: prune_concordances,
+		Client:            es_client,
+		Report:            document.NewReport(),
+	}
+
+	if secondary_bi != nil {
+		opts.SecondaryBulkIndexer = secondary_bi
+	}
+
+	if geometry_index != "" {
+		opts.GeometryPrepareFuncs = geometry_prepare_funcs
 	}
 
 	return opts, nil
@@ -261,6 +1130,32 @@ func RunBulkIndexer(ctx context.Context, opts *RunBulkIndexerOptions) (*esutil.B
 	iterator_uri := opts.IteratorURI
 	iterator_paths := opts.IteratorPaths
 	index_alt := opts.IndexAltFiles
+	alt_index := opts.AltIndex
+	geometry_index := opts.GeometryIndex
+	geometry_prepare_funcs := opts.GeometryPrepareFuncs
+	concordances_index := opts.ConcordancesIndex
+	prune_concordances := opts.PruneConcordances
+	es_client := opts.Client
+
+	secondary_bi := opts.SecondaryBulkIndexer
+
+	if secondary_bi == nil {
+		secondary_bi = bi
+	}
+
+	if prune_concordances && (concordances_index == "" || es_client == nil) {
+		return nil, errors.New("Pruning concordances requires a concordances index and an Elasticsearch client")
+	}
+
+	if opts.Report != nil {
+		ctx = document.WithReport(ctx, opts.Report)
+	}
+
+	// The identifier for this indexing run assigned to concordance documents and the set of records whose
+	// concordances were indexed, used to remove stale concordances once indexing is complete
+
+	index_run := strconv.FormatInt(time.Now().UnixNano(), 10)
+	indexed_concordances := new(sync.Map)
 
 	iter_cb := func(ctx context.Context, path string, fh io.ReadSeeker, args ...interface{}) error {
 
@@ -280,6 +1175,9 @@ func RunBulkIndexer(ctx context.Context, opts *RunBulkIndexerOptions) (*esutil.B
 		wof_id := id_rsp.Int()
 		doc_id := strconv.FormatInt(wof_id, 10)
 
+		// An empty string means use the default index for the bulk indexer
+		item_index := ""
+
 		alt_rsp := gjson.GetBytes(body, "properties.src:alt_label")
 
 		if alt_rsp.Exists() {
@@ -288,7 +1186,85 @@ func RunBulkIndexer(ctx context.Context, opts *RunBulkIndexerOptions) (*esutil.B
 				return nil
 			}
 
-			doc_id = fmt.Sprintf("%s-%s", doc_id, alt_rsp.String())
+			alt_geom, err := uri.AltGeomFromPath(path)
+
+			if err != nil {
+
+				alt_geom, err = document.AltGeomFromLabel(alt_rsp.String())
+
+				if err != nil {
+					return fmt.Errorf("Failed to derive alternate geometry details for %s, %w", path, err)
+				}
+			}
+
+			doc_id, err = document.AlternateGeometryDocumentId(wof_id, alt_geom)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive alternate geometry document ID for %s, %w", path, err)
+			}
+
+			body, err = document.AppendAlternateGeometryProperties(ctx, body, alt_geom)
+
+			if err != nil {
+				return fmt.Errorf("Failed to append alternate geometry properties for %s, %w", path, err)
+			}
+
+			item_index = alt_index
+		}
+
+		// Documents for the geometry and concordances indices are derived from the original document but
+		// are only scheduled once the main document has been prepared successfully
+
+		secondary_items := make([]esutil.BulkIndexerItem, 0)
+
+		if geometry_index != "" {
+
+			geom_body, err := document.PrepareGeometryDocument(ctx, body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to prepare geometry document for %s, %w", path, err)
+			}
+
+			for _, f := range geometry_prepare_funcs {
+
+				new_body, err := f(ctx, geom_body)
+
+				if err != nil {
+					return err
+				}
+
+				geom_body = new_body
+			}
+
+			geom_item := newBulkIndexerItem(path, geometry_index, doc_id, geom_body)
+			secondary_items = append(secondary_items, geom_item)
+		}
+
+		index_concordances := concordances_index != "" && !alt_rsp.Exists()
+
+		if index_concordances {
+
+			records, err := NewConcordanceRecords(ctx, body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive concordance records for %s, %w", path, err)
+			}
+
+			for _, r := range records {
+
+				if prune_concordances {
+					r.IndexRun = index_run
+				}
+
+				enc_r, err := json.Marshal(r)
+
+				if err != nil {
+					return fmt.Errorf("Failed to marshal concordance record for %s, %w", path, err)
+				}
+
+				concordance_item := newBulkIndexerItem(path, concordances_index, r.DocumentId(), enc_r)
+				secondary_items = append(secondary_items, concordance_item)
+			}
 		}
 
 		// START OF manipulate body here...
@@ -323,24 +1299,21 @@ func RunBulkIndexer(ctx context.Context, opts *RunBulkIndexerOptions) (*esutil.B
 
 		// log.Println(string(enc_f))
 
-		bulk_item := esutil.BulkIndexerItem{
-			Action:     "index",
-			DocumentID: doc_id,
-			Body:       bytes.NewReader(enc_f),
+		for _, item := range secondary_items {
 
-			OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
-				// log.Printf("Indexed %s\n", path)
-			},
+			err = secondary_bi.Add(ctx, item)
 
-			OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
-				if err != nil {
-					log.Printf("ERROR: Failed to index %s, %s", path, err)
-				} else {
-					log.Printf("ERROR: Failed to index %s, %s: %s", path, res.Error.Type, res.Error.Reason)
-				}
-			},
+			if err != nil {
+				log.Printf("Failed to schedule %s document (%s) for %s, %v", item.Index, item.DocumentID, path, err)
+			}
+		}
+
+		if index_concordances {
+			indexed_concordances.Store(wof_id, true)
 		}
 
+		bulk_item := newBulkIndexerItem(path, item_index, doc_id, enc_f)
+
 		err = bi.Add(ctx, bulk_item)
 
 		if err != nil {
@@ -371,8 +1344,93 @@ func RunBulkIndexer(ctx context.Context, opts *RunBulkIndexerOptions) (*esutil.B
 		return nil, err
 	}
 
+	if secondary_bi != bi {
+
+		err = secondary_bi.Close(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	log.Printf("Processed %d files in %v\n", iter.Seen, time.Since(t1))
 
+	if prune_concordances {
+
+		wof_ids := make([]int64, 0)
+
+		indexed_concordances.Range(func(k interface{}, v interface{}) bool {
+			wof_ids = append(wof_ids, k.(int64))
+			return true
+		})
+
+		sort.Slice(wof_ids, func(i, j int) bool {
+			return wof_ids[i] < wof_ids[j]
+		})
+
+		t2 := time.Now()
+
+		err = DeleteStaleConcordances(ctx, es_client, concordances_index, index_run, wof_ids)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to remove stale concordances, %w", err)
+		}
+
+		log.Printf("Removed stale concordances for %d records in %v\n", len(wof_ids), time.Since(t2))
+	}
+
+	if opts.Report != nil {
+
+		enc_report, err := json.Marshal(opts.Report)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal report, %w", err)
+		}
+
+		log.Printf("Report %s\n", string(enc_report))
+	}
+
 	stats := bi.Stats()
+
+	if secondary_bi != bi {
+
+		secondary_stats := secondary_bi.Stats()
+
+		stats.NumAdded += secondary_stats.NumAdded
+		stats.NumFlushed += secondary_stats.NumFlushed
+		stats.NumFailed += secondary_stats.NumFailed
+		stats.NumIndexed += secondary_stats.NumIndexed
+		stats.NumCreated += secondary_stats.NumCreated
+		stats.NumUpdated += secondary_stats.NumUpdated
+		stats.NumDeleted += secondary_stats.NumDeleted
+		stats.NumRequests += secondary_stats.NumRequests
+	}
+
 	return &stats, nil
 }
+
+// newBulkIndexerItem returns a new `esutil.BulkIndexerItem` to index 'body' (derived from 'path') in 'index' with document ID 'doc_id'.
+// An empty 'index' means use the default index for the bulk indexer.
+func newBulkIndexerItem(path string, index string, doc_id string, body []byte) esutil.BulkIndexerItem {
+
+	bulk_item := esutil.BulkIndexerItem{
+		Index:      index,
+		Action:     "index",
+		DocumentID: doc_id,
+		Body:       bytes.NewReader(body),
+
+		OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+			// log.Printf("Indexed %s\n", path)
+		},
+
+		OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			if err != nil {
+				log.Printf("ERROR: Failed to index %s, %s", path, err)
+			} else {
+				log.Printf("ERROR: Failed to index %s, %s: %s", path, res.Error.Type, res.Error.Reason)
+			}
+		},
+	}
+
+	return bulk_item
+}
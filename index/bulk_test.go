@@ -0,0 +1,123 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/document"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type recordingBulkIndexer struct {
+	esutil.BulkIndexer
+	mu    sync.Mutex
+	items []esutil.BulkIndexerItem
+}
+
+func (bi *recordingBulkIndexer) Add(ctx context.Context, item esutil.BulkIndexerItem) error {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	bi.items = append(bi.items, item)
+	return nil
+}
+
+func (bi *recordingBulkIndexer) Close(ctx context.Context) error {
+	return nil
+}
+
+func (bi *recordingBulkIndexer) Stats() esutil.BulkIndexerStats {
+	return esutil.BulkIndexerStats{NumAdded: uint64(len(bi.items))}
+}
+
+func TestRunBulkIndexerSecondaryItems(t *testing.T) {
+
+	ctx := context.Background()
+
+	root := t.TempDir()
+
+	feature := `{"type": "Feature", "properties": {"wof:id": 85922583, "wof:name": "San Francisco", "wof:placetype": "locality", "wof:concordances": {"gn:id": 5391959, "wd:id": "Q62"}}, "geometry": {"type": "Point", "coordinates": [-122.4, 37.8]}}`
+
+	err := os.WriteFile(filepath.Join(root, "85922583.geojson"), []byte(feature), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write feature, %v", err)
+	}
+
+	newOptions := func(prepare_funcs ...document.PrepareDocumentFunc) (*RunBulkIndexerOptions, *recordingBulkIndexer, *recordingBulkIndexer) {
+
+		bi := &recordingBulkIndexer{}
+		secondary_bi := &recordingBulkIndexer{}
+
+		opts := &RunBulkIndexerOptions{
+			BulkIndexer:          bi,
+			SecondaryBulkIndexer: secondary_bi,
+			PrepareFuncs:         prepare_funcs,
+			IteratorURI:          "directory://",
+			IteratorPaths:        []string{root},
+			GeometryIndex:        "geometries",
+			ConcordancesIndex:    "concordances",
+		}
+
+		return opts, bi, secondary_bi
+	}
+
+	// Geometry and concordance documents are indexed using the secondary bulk indexer
+
+	opts, bi, secondary_bi := newOptions(document.ExtractProperties)
+
+	_, err = RunBulkIndexer(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to run bulk indexer, %v", err)
+	}
+
+	if len(bi.items) != 1 || bi.items[0].DocumentID != "85922583" {
+		t.Fatalf("Unexpected items for bulk indexer: %v", bi.items)
+	}
+
+	if len(secondary_bi.items) != 3 {
+		t.Fatalf("Unexpected number of items for secondary bulk indexer: %d", len(secondary_bi.items))
+	}
+
+	indices := map[string]int{}
+
+	for _, item := range secondary_bi.items {
+		indices[item.Index] += 1
+	}
+
+	if indices["geometries"] != 1 || indices["concordances"] != 2 {
+		t.Fatalf("Unexpected secondary items: %v", indices)
+	}
+
+	// Nothing is scheduled if the main document can not be prepared
+
+	failing := func(ctx context.Context, body []byte) ([]byte, error) {
+		return nil, errors.New("Failed to prepare document")
+	}
+
+	opts, bi, secondary_bi = newOptions(failing)
+
+	_, err = RunBulkIndexer(ctx, opts)
+
+	if err == nil {
+		t.Fatalf("Expected bulk indexer to fail")
+	}
+
+	if len(bi.items) != 0 || len(secondary_bi.items) != 0 {
+		t.Fatalf("Unexpected items scheduled for document that failed to prepare: %d, %d", len(bi.items), len(secondary_bi.items))
+	}
+
+	// Pruning concordances requires a client
+
+	opts, _, _ = newOptions()
+	opts.PruneConcordances = true
+
+	_, err = RunBulkIndexer(ctx, opts)
+
+	if err == nil {
+		t.Fatalf("Expected pruning concordances without a client to fail")
+	}
+}
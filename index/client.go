@@ -0,0 +1,59 @@
+package index
+
+import (
+	"context"
+	"flag"
+	"github.com/cenkalti/backoff/v4"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/sfomuseum/go-flags/lookup"
+	"time"
+)
+
+// NewClient returns a new `es.Client` instance for 'es_endpoint' configured to retry failed requests
+// using an exponential backoff.
+func NewClient(ctx context.Context, es_endpoint string) (*es.Client, error) {
+
+	retry := backoff.NewExponentialBackOff()
+
+	es_cfg := es.Config{
+		Addresses: []string{es_endpoint},
+
+		RetryOnStatus: []int{502, 503, 504, 429},
+		RetryBackoff: func(i int) time.Duration {
+			if i == 1 {
+				retry.Reset()
+			}
+			return retry.NextBackOff()
+		},
+		MaxRetries: 5,
+	}
+
+	/*
+
+		if debug {
+
+			es_logger := &estransport.ColorLogger{
+				Output:             os.Stdout,
+				EnableRequestBody:  true,
+				EnableResponseBody: true,
+			}
+
+			es_cfg.Logger = es_logger
+		}
+
+	*/
+
+	return es.NewClient(es_cfg)
+}
+
+// ClientFromFlagSet returns a new `es.Client` instance derived from the values in 'fs'.
+func ClientFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*es.Client, error) {
+
+	es_endpoint, err := lookup.StringVar(fs, FLAG_ES_ENDPOINT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(ctx, es_endpoint)
+}
@@ -0,0 +1,517 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/document"
+	"github.com/tidwall/gjson"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CONCORDANCES_MAPPINGS are the Elasticsearch mappings for indices of concordance documents created by `RunBulkIndexer`
+// when the `ConcordancesIndex` option is set.
+const CONCORDANCES_MAPPINGS string = `{
+  "mappings": {
+    "properties": {
+      "wof:id": { "type": "long" },
+      "wof:name": { "type": "keyword" },
+      "wof:placetype": { "type": "keyword" },
+      "source": { "type": "keyword" },
+      "key": { "type": "keyword" },
+      "id": { "type": "keyword" },
+      "concordance": { "type": "keyword" },
+      "index_run": { "type": "keyword" }
+    }
+  }
+}`
+
+// concordances_lookup_size is the number of concordance documents returned by each page of a lookup. Lookups page
+// through all the matching documents (using `search_after`) so this does not limit the number of results.
+const concordances_lookup_size int = 1000
+
+// concordances_prune_batch_size is the maximum number of Who's On First IDs included in a single request to remove stale concordances.
+const concordances_prune_batch_size int = 1000
+
+// type ConcordanceRecord defines a single (source, external ID) to Who's On First ID pair, as indexed in a concordances index.
+type ConcordanceRecord struct {
+	// WhosOnFirstId is the Who's On First ID of the record with the concordance.
+	WhosOnFirstId int64 `json:"wof:id"`
+	// Name is the name of the record with the concordance.
+	Name string `json:"wof:name,omitempty"`
+	// Placetype is the placetype of the record with the concordance.
+	Placetype string `json:"wof:placetype,omitempty"`
+	// Source is the source prefix, for example "gn".
+	Source string `json:"source"`
+	// Key is the complete concordance key, for example "gn:id".
+	Key string `json:"key"`
+	// Id is the normalized (string) external identifier, for example "5391959".
+	Id string `json:"id"`
+	// Concordance is the "{KEY}={ID}" pair, for example "gn:id=5391959".
+	Concordance string `json:"concordance"`
+	// IndexRun is the optional identifier of the indexing run that indexed the record, used to remove stale concordances.
+	IndexRun string `json:"index_run,omitempty"`
+}
+
+// type ConcordanceLookup contains the results of a concordances lookup.
+type ConcordanceLookup struct {
+	// Query is the value that was looked up.
+	Query string `json:"query"`
+	// Records are the concordance records matching the query.
+	Records []*ConcordanceRecord `json:"records"`
+	// Conflicts maps "{KEY}={ID}" pairs that belong to more than one Who's On First record to the (sorted) list of those records.
+	Conflicts map[string][]int64 `json:"conflicts,omitempty"`
+}
+
+// NewConcordanceRecords returns the list of `ConcordanceRecord` instances, one per (source, external ID) pair, derived from
+// the `wof:concordances` property of a Who's On First document.
+func NewConcordanceRecords(ctx context.Context, body []byte) ([]*ConcordanceRecord, error) {
+
+	root := gjson.ParseBytes(body)
+
+	props_rsp := gjson.GetBytes(body, "properties")
+
+	if props_rsp.Exists() {
+		root = props_rsp
+	}
+
+	id_rsp := root.Get("wof:id")
+
+	if !id_rsp.Exists() {
+		return nil, errors.New("Missing wof:id property")
+	}
+
+	concordances, err := document.DeriveConcordances(ctx, body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive concordances, %w", err)
+	}
+
+	records := make([]*ConcordanceRecord, len(concordances))
+
+	for idx, c := range concordances {
+
+		records[idx] = &ConcordanceRecord{
+			WhosOnFirstId: id_rsp.Int(),
+			Name:          root.Get("wof:name").String(),
+			Placetype:     root.Get("wof:placetype").String(),
+			Source:        c.Source,
+			Key:           c.Key,
+			Id:            c.Id,
+			Concordance:   c.String(),
+		}
+	}
+
+	return records, nil
+}
+
+// DocumentId returns the unique document ID for 'r' in a concordances index, for example "gn:id=5391959#85922583".
+func (r *ConcordanceRecord) DocumentId() string {
+	return fmt.Sprintf("%s#%d", r.Concordance, r.WhosOnFirstId)
+}
+
+// DeleteStaleConcordances removes the documents for the Who's On First records 'wof_ids' from 'index', a concordances index
+// created by `RunBulkIndexer`, that were not indexed by the indexing run 'run' (see `ConcordanceRecord.IndexRun`). This ensures
+// that concordances which have been removed from, or corrected in, a record are not returned by `LookupConcordance` once the
+// record has been reindexed. The index is refreshed first so that it must be called after all the documents for 'run' have
+// been flushed (for example after the bulk indexer has been closed). Records are processed in batches of `concordances_prune_batch_size`.
+func DeleteStaleConcordances(ctx context.Context, es_client *es.Client, index string, run string, wof_ids []int64) error {
+
+	if index == "" {
+		return errors.New("Missing Elasticsearch index")
+	}
+
+	if run == "" {
+		return errors.New("Missing index run")
+	}
+
+	if len(wof_ids) == 0 {
+		return nil
+	}
+
+	refresh_rsp, err := es_client.Indices.Refresh(
+		es_client.Indices.Refresh.WithContext(ctx),
+		es_client.Indices.Refresh.WithIndex(index),
+	)
+
+	if err != nil {
+		return fmt.Errorf("Failed to refresh index '%s', %w", index, err)
+	}
+
+	defer refresh_rsp.Body.Close()
+
+	if refresh_rsp.IsError() {
+		return fmt.Errorf("Failed to refresh index '%s', %s", index, refresh_rsp.String())
+	}
+
+	for start := 0; start < len(wof_ids); start += concordances_prune_batch_size {
+
+		end := start + concordances_prune_batch_size
+
+		if end > len(wof_ids) {
+			end = len(wof_ids)
+		}
+
+		enc_q, err := json.Marshal(map[string]interface{}{
+			"query": staleConcordancesQuery(run, wof_ids[start:end]),
+		})
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal query, %w", err)
+		}
+
+		rsp, err := es_client.DeleteByQuery(
+			[]string{index},
+			bytes.NewReader(enc_q),
+			es_client.DeleteByQuery.WithContext(ctx),
+			es_client.DeleteByQuery.WithConflicts("proceed"),
+		)
+
+		if err != nil {
+			return fmt.Errorf("Failed to delete stale concordances, %w", err)
+		}
+
+		rsp_body, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to read delete response, %w", err)
+		}
+
+		if rsp.IsError() {
+			return fmt.Errorf("Failed to delete stale concordances, %s", string(rsp_body))
+		}
+	}
+
+	return nil
+}
+
+// staleConcordancesQuery returns a query matching the concordance documents for 'wof_ids' that were not indexed by the indexing run 'run'.
+func staleConcordancesQuery(run string, wof_ids []int64) map[string]interface{} {
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{
+					"terms": map[string]interface{}{"wof:id": wof_ids},
+				},
+			},
+			"must_not": []interface{}{
+				map[string]interface{}{
+					"term": map[string]interface{}{"index_run": run},
+				},
+			},
+		},
+	}
+}
+
+// LookupConcordance returns the Who's On First records with the external identifier 'id' in 'index', a concordances index
+// created by `RunBulkIndexer`. 'source' may be a source prefix (for example "gn") or a complete concordance key (for example
+// "gn:id"). If the identifier belongs to more than one record the records are listed in the `Conflicts` property of the result.
+func LookupConcordance(ctx context.Context, es_client *es.Client, index string, source string, id string) (*ConcordanceLookup, error) {
+
+	source = strings.TrimSpace(source)
+	id = strings.TrimSpace(id)
+
+	if source == "" {
+		return nil, errors.New("Missing source")
+	}
+
+	if id == "" {
+		return nil, errors.New("Missing id")
+	}
+
+	source_field := "source"
+
+	if strings.Contains(source, ":") {
+		source_field = "key"
+	}
+
+	q := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{
+					"term": map[string]interface{}{source_field: source},
+				},
+				map[string]interface{}{
+					"term": map[string]interface{}{"id": id},
+				},
+			},
+		},
+	}
+
+	records, err := searchConcordances(ctx, es_client, index, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := &ConcordanceLookup{
+		Query:     fmt.Sprintf("%s=%s", source, id),
+		Records:   records,
+		Conflicts: concordanceConflicts(records),
+	}
+
+	return lookup, nil
+}
+
+// LookupWhosOnFirstId returns the concordances for the Who's On First record 'wof_id' in 'index', a concordances index
+// created by `RunBulkIndexer`. Concordances that also belong to other records are listed in the `Conflicts` property of the result.
+func LookupWhosOnFirstId(ctx context.Context, es_client *es.Client, index string, wof_id int64) (*ConcordanceLookup, error) {
+
+	q := map[string]interface{}{
+		"term": map[string]interface{}{"wof:id": wof_id},
+	}
+
+	records, err := searchConcordances(ctx, es_client, index, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := &ConcordanceLookup{
+		Query:   strconv.FormatInt(wof_id, 10),
+		Records: records,
+	}
+
+	if len(records) == 0 {
+		return lookup, nil
+	}
+
+	pairs := make([]string, len(records))
+
+	for idx, r := range records {
+		pairs[idx] = r.Concordance
+	}
+
+	q = map[string]interface{}{
+		"terms": map[string]interface{}{"concordance": pairs},
+	}
+
+	shared, err := searchConcordances(ctx, es_client, index, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lookup.Conflicts = concordanceConflicts(shared)
+	return lookup, nil
+}
+
+// searchConcordances returns all the concordance records in 'index' matching the query 'q', sorted by key, identifier and Who's On First ID.
+// Results are retrieved in pages of `concordances_lookup_size` documents.
+func searchConcordances(ctx context.Context, es_client *es.Client, index string, q interface{}) ([]*ConcordanceRecord, error) {
+
+	if index == "" {
+		return nil, errors.New("Missing Elasticsearch index")
+	}
+
+	records := make([]*ConcordanceRecord, 0)
+
+	var search_after json.RawMessage
+
+	for {
+
+		enc_q, err := json.Marshal(concordancesSearchBody(q, search_after))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal query, %w", err)
+		}
+
+		rsp, err := es_client.Search(
+			es_client.Search.WithContext(ctx),
+			es_client.Search.WithIndex(index),
+			es_client.Search.WithBody(bytes.NewReader(enc_q)),
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to search index '%s', %w", index, err)
+		}
+
+		body, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read search results, %w", err)
+		}
+
+		if rsp.IsError() {
+			return nil, fmt.Errorf("Failed to search index '%s', %s", index, string(body))
+		}
+
+		hits := gjson.GetBytes(body, "hits.hits").Array()
+
+		for _, hit := range hits {
+
+			var r *ConcordanceRecord
+
+			err := json.Unmarshal([]byte(hit.Get("_source").Raw), &r)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to unmarshal concordance record, %w", err)
+			}
+
+			records = append(records, r)
+		}
+
+		if len(hits) < concordances_lookup_size {
+			break
+		}
+
+		last_sort := hits[len(hits)-1].Get("sort")
+
+		if !last_sort.Exists() {
+			return nil, fmt.Errorf("Search results for index '%s' are missing sort values", index)
+		}
+
+		search_after = json.RawMessage(last_sort.Raw)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+
+		if records[i].Concordance != records[j].Concordance {
+			return records[i].Concordance < records[j].Concordance
+		}
+
+		return records[i].WhosOnFirstId < records[j].WhosOnFirstId
+	})
+
+	return records, nil
+}
+
+// concordancesSearchBody returns the body of a search request for a page of concordance documents matching the query 'q'.
+// Documents are sorted by their (unique) "{KEY}={ID}" pair and Who's On First ID so that 'search_after', the sort values of
+// the last document of the previous page, can be used to retrieve the next page.
+func concordancesSearchBody(q interface{}, search_after json.RawMessage) map[string]interface{} {
+
+	body := map[string]interface{}{
+		"query": q,
+		"size":  concordances_lookup_size,
+		"sort": []interface{}{
+			map[string]interface{}{"concordance": "asc"},
+			map[string]interface{}{"wof:id": "asc"},
+		},
+	}
+
+	if len(search_after) > 0 {
+		body["search_after"] = search_after
+	}
+
+	return body
+}
+
+// concordanceConflicts returns a map of the "{KEY}={ID}" pairs in 'records' that belong to more than one Who's On First record
+// to the sorted list of those records. Returns nil if there are no conflicts.
+func concordanceConflicts(records []*ConcordanceRecord) map[string][]int64 {
+
+	ids := make(map[string]map[int64]bool)
+
+	for _, r := range records {
+
+		_, ok := ids[r.Concordance]
+
+		if !ok {
+			ids[r.Concordance] = make(map[int64]bool)
+		}
+
+		ids[r.Concordance][r.WhosOnFirstId] = true
+	}
+
+	var conflicts map[string][]int64
+
+	for pair, wof_ids := range ids {
+
+		if len(wof_ids) < 2 {
+			continue
+		}
+
+		if conflicts == nil {
+			conflicts = make(map[string][]int64)
+		}
+
+		list := make([]int64, 0, len(wof_ids))
+
+		for id, _ := range wof_ids {
+			list = append(list, id)
+		}
+
+		sort.Slice(list, func(i, j int) bool {
+			return list[i] < list[j]
+		})
+
+		conflicts[pair] = list
+	}
+
+	return conflicts
+}
+
+// NewConcordancesFlagSet creates a new `flag.FlagSet` instance with command-line flags required by the `es-whosonfirst-concordances` tool.
+func NewConcordancesFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("concordances")
+
+	fs.String(FLAG_ES_ENDPOINT, "http://localhost:9200", "A fully-qualified Elasticsearch endpoint.")
+	fs.String(FLAG_ES_INDEX, "millsfield_concordances", "A valid Elasticsearch concordances index, as created by the -elasticsearch-concordances-index flag of the es-whosonfirst-index tool.")
+
+	return fs, nil
+}
+
+// LookupConcordancesWithFlagSet resolves each of the (non-flag) arguments in 'fs' using the concordances index defined in 'fs'.
+// Arguments in the form of "{SOURCE}={ID}" or "{SOURCE}:{KEY}={ID}" (for example "gn=5391959" or "wd:id=Q62") are resolved to
+// Who's On First records using `LookupConcordance`. Numeric arguments are assumed to be Who's On First IDs and are resolved to
+// concordances using `LookupWhosOnFirstId`.
+func LookupConcordancesWithFlagSet(ctx context.Context, fs *flag.FlagSet) ([]*ConcordanceLookup, error) {
+
+	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ConcordanceLookup, 0)
+
+	for _, arg := range fs.Args() {
+
+		var r *ConcordanceLookup
+
+		parts := strings.SplitN(arg, "=", 2)
+
+		if len(parts) == 2 {
+
+			r, err = LookupConcordance(ctx, es_client, es_index, parts[0], parts[1])
+
+		} else {
+
+			wof_id, parse_err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+
+			if parse_err != nil {
+				return nil, fmt.Errorf("Invalid argument '%s', expected {SOURCE}={ID} or a Who's On First ID", arg)
+			}
+
+			r, err = LookupWhosOnFirstId(ctx, es_client, es_index, wof_id)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to look up '%s', %w", arg, err)
+		}
+
+		results = append(results, r)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,272 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/tidwall/gjson"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewConcordanceRecords(t *testing.T) {
+
+	ctx := context.Background()
+
+	feature := []byte(`{"type": "Feature", "properties": {"wof:id": 85922583, "wof:name": "San Francisco", "wof:placetype": "locality", "wof:concordances": {"wd:id": "Q62", "gn:id": 5391959}}, "geometry": null}`)
+
+	records, err := NewConcordanceRecords(ctx, feature)
+
+	if err != nil {
+		t.Fatalf("Failed to derive concordance records, %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Unexpected number of concordance records: %d", len(records))
+	}
+
+	gn := records[0]
+
+	if gn.WhosOnFirstId != 85922583 || gn.Name != "San Francisco" || gn.Placetype != "locality" {
+		t.Fatalf("Unexpected record details: %v", gn)
+	}
+
+	if gn.Source != "gn" || gn.Key != "gn:id" || gn.Id != "5391959" || gn.Concordance != "gn:id=5391959" {
+		t.Fatalf("Unexpected concordance details: %v", gn)
+	}
+
+	if gn.DocumentId() != "gn:id=5391959#85922583" {
+		t.Fatalf("Unexpected document ID: %s", gn.DocumentId())
+	}
+
+	if records[1].Concordance != "wd:id=Q62" {
+		t.Fatalf("Unexpected concordance: %s", records[1].Concordance)
+	}
+
+	// Properties-only documents without concordances
+
+	records, err = NewConcordanceRecords(ctx, []byte(`{"wof:id": 85922583}`))
+
+	if err != nil {
+		t.Fatalf("Failed to derive concordance records for properties-only document, %v", err)
+	}
+
+	if len(records) != 0 {
+		t.Fatalf("Expected no concordance records, got %d", len(records))
+	}
+
+	_, err = NewConcordanceRecords(ctx, []byte(`{"properties": {"wof:concordances": {"gn:id": 5391959}}}`))
+
+	if err == nil {
+		t.Fatalf("Expected document without wof:id to fail")
+	}
+}
+
+func TestConcordanceConflicts(t *testing.T) {
+
+	records := []*ConcordanceRecord{
+		&ConcordanceRecord{WhosOnFirstId: 85922583, Concordance: "gn:id=5391959"},
+		&ConcordanceRecord{WhosOnFirstId: 1108830809, Concordance: "gn:id=5391959"},
+		&ConcordanceRecord{WhosOnFirstId: 85922583, Concordance: "gn:id=5391959"},
+		&ConcordanceRecord{WhosOnFirstId: 85922583, Concordance: "wd:id=Q62"},
+	}
+
+	conflicts := concordanceConflicts(records)
+
+	if len(conflicts) != 1 {
+		t.Fatalf("Unexpected conflicts: %v", conflicts)
+	}
+
+	ids := conflicts["gn:id=5391959"]
+
+	if len(ids) != 2 || ids[0] != 85922583 || ids[1] != 1108830809 {
+		t.Fatalf("Unexpected conflicting IDs: %v", ids)
+	}
+
+	if concordanceConflicts(records[2:]) != nil {
+		t.Fatalf("Expected no conflicts")
+	}
+
+	if concordanceConflicts(nil) != nil {
+		t.Fatalf("Expected no conflicts for empty records")
+	}
+}
+
+func TestStaleConcordancesQuery(t *testing.T) {
+
+	enc_q, err := json.Marshal(staleConcordancesQuery("1234", []int64{85922583, 85688637}))
+
+	if err != nil {
+		t.Fatalf("Failed to marshal query, %v", err)
+	}
+
+	expected := `{"bool":{"filter":[{"terms":{"wof:id":[85922583,85688637]}}],"must_not":[{"term":{"index_run":"1234"}}]}}`
+
+	if string(enc_q) != expected {
+		t.Fatalf("Unexpected query: %s", string(enc_q))
+	}
+}
+
+func TestDeleteStaleConcordances(t *testing.T) {
+
+	ctx := context.Background()
+
+	paths := make([]string, 0)
+	batches := make([]int, 0)
+
+	handler := func(rsp http.ResponseWriter, req *http.Request) {
+
+		paths = append(paths, req.URL.Path)
+
+		if strings.HasSuffix(req.URL.Path, "/_delete_by_query") {
+
+			var q map[string]interface{}
+
+			err := json.NewDecoder(req.Body).Decode(&q)
+
+			if err != nil {
+				http.Error(rsp, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			ids := gjson.Get(string(mustMarshal(t, q)), `query.bool.filter.0.terms.wof:id`).Array()
+			batches = append(batches, len(ids))
+		}
+
+		rsp.Header().Set("Content-Type", "application/json")
+		rsp.Write([]byte(`{}`))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	es_client, err := es.NewClient(es.Config{
+		Addresses: []string{server.URL},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create client, %v", err)
+	}
+
+	wof_ids := make([]int64, concordances_prune_batch_size+1)
+
+	for idx := range wof_ids {
+		wof_ids[idx] = int64(idx + 1)
+	}
+
+	err = DeleteStaleConcordances(ctx, es_client, "concordances", "1234", wof_ids)
+
+	if err != nil {
+		t.Fatalf("Failed to delete stale concordances, %v", err)
+	}
+
+	// The index is refreshed once and then records are removed in batches
+
+	if len(paths) != 3 || paths[0] != "/concordances/_refresh" {
+		t.Fatalf("Unexpected requests: %v", paths)
+	}
+
+	if len(batches) != 2 || batches[0] != concordances_prune_batch_size || batches[1] != 1 {
+		t.Fatalf("Unexpected batches: %v", batches)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+
+	enc, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatalf("Failed to marshal %v, %v", v, err)
+	}
+
+	return enc
+}
+
+func TestSearchConcordancesPaging(t *testing.T) {
+
+	ctx := context.Background()
+
+	// The first page is full (concordances_lookup_size hits) and the second page has one hit
+
+	requests := make([]map[string]interface{}, 0)
+
+	handler := func(rsp http.ResponseWriter, req *http.Request) {
+
+		var q map[string]interface{}
+
+		err := json.NewDecoder(req.Body).Decode(&q)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requests = append(requests, q)
+
+		count := concordances_lookup_size
+
+		if len(requests) > 1 {
+			count = 1
+		}
+
+		hits := make([]interface{}, count)
+
+		for idx := 0; idx < count; idx++ {
+
+			wof_id := int64((len(requests)-1)*concordances_lookup_size + idx)
+
+			hits[idx] = map[string]interface{}{
+				"_source": &ConcordanceRecord{WhosOnFirstId: wof_id, Source: "gn", Key: "gn:id", Id: "1", Concordance: "gn:id=1"},
+				"sort":    []interface{}{"gn:id=1", wof_id},
+			}
+		}
+
+		rsp.Header().Set("Content-Type", "application/json")
+
+		json.NewEncoder(rsp).Encode(map[string]interface{}{
+			"hits": map[string]interface{}{"hits": hits},
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	es_client, err := es.NewClient(es.Config{
+		Addresses: []string{server.URL},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create client, %v", err)
+	}
+
+	lookup, err := LookupConcordance(ctx, es_client, "concordances", "gn", "1")
+
+	if err != nil {
+		t.Fatalf("Failed to lookup concordance, %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 search requests, got %d", len(requests))
+	}
+
+	if _, ok := requests[0]["search_after"]; ok {
+		t.Fatalf("Unexpected search_after for first page")
+	}
+
+	enc_after, _ := json.Marshal(requests[1]["search_after"])
+
+	if string(enc_after) != fmt.Sprintf(`["gn:id=1",%d]`, concordances_lookup_size-1) {
+		t.Fatalf("Unexpected search_after for second page: %s", string(enc_after))
+	}
+
+	if len(lookup.Records) != concordances_lookup_size+1 {
+		t.Fatalf("Unexpected number of records: %d", len(lookup.Records))
+	}
+
+	if len(lookup.Conflicts["gn:id=1"]) != concordances_lookup_size+1 {
+		t.Fatalf("Unexpected number of conflicts: %d", len(lookup.Conflicts["gn:id=1"]))
+	}
+}
@@ -0,0 +1,72 @@
+package index
+
+import (
+	"fmt"
+	"time"
+)
+
+// DEFAULT_EXISTENCE_RANGE_FIELD is the default name of the `date_range` field, assigned by `document.NewAppendEDTFRangesFunc`,
+// used by `ExtantAtQuery` and `ExtantDuringQuery`.
+const DEFAULT_EXISTENCE_RANGE_FIELD string = "date:existence_range"
+
+const (
+	// RANGE_RELATION_INTERSECTS matches documents whose range intersects the query range.
+	RANGE_RELATION_INTERSECTS string = "intersects"
+	// RANGE_RELATION_CONTAINS matches documents whose range entirely contains the query range.
+	RANGE_RELATION_CONTAINS string = "contains"
+	// RANGE_RELATION_WITHIN matches documents whose range is entirely within the query range.
+	RANGE_RELATION_WITHIN string = "within"
+)
+
+// ExtantAtQuery returns an Elasticsearch query (suitable for encoding as JSON) matching records that existed at 't'.
+// 'field' is the name of a `date_range` field mapped with the `epoch_second` format. If empty `DEFAULT_EXISTENCE_RANGE_FIELD`
+// is used. For indices of complete GeoJSON Features this will be `properties.date:existence_range`. If 't' is the zero time
+// (unknown) the query is unbounded and matches all records with an existence range.
+func ExtantAtQuery(field string, t time.Time) map[string]interface{} {
+	return ExtantDuringQuery(field, t, t, RANGE_RELATION_CONTAINS)
+}
+
+// ExtantDuringQuery returns an Elasticsearch query (suitable for encoding as JSON) matching records that existed
+// between 'start' and 'end'. 'relation' defines how record and query ranges are compared: `RANGE_RELATION_INTERSECTS`
+// (records that existed at any time during the interval), `RANGE_RELATION_CONTAINS` (records that existed for the entire
+// interval) or `RANGE_RELATION_WITHIN` (records that both began and ceased during the interval). If empty
+// `RANGE_RELATION_INTERSECTS` is used. 'field' is the name of a `date_range` field mapped with the `epoch_second` format.
+// If empty `DEFAULT_EXISTENCE_RANGE_FIELD` is used. If either 'start' or 'end' is the zero time that side of the interval is
+// unbounded (open-ended), matching the way missing dates are assigned by `document.NewAppendEDTFRangesFunc`.
+func ExtantDuringQuery(field string, start time.Time, end time.Time, relation string) map[string]interface{} {
+
+	if field == "" {
+		field = DEFAULT_EXISTENCE_RANGE_FIELD
+	}
+
+	if relation == "" {
+		relation = RANGE_RELATION_INTERSECTS
+	}
+
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		start, end = end, start
+	}
+
+	r := map[string]interface{}{
+		"format":   "epoch_second",
+		"relation": relation,
+	}
+
+	if !start.IsZero() {
+		r["gte"] = fmt.Sprintf("%d", start.Unix())
+	}
+
+	if !end.IsZero() {
+		r["lte"] = fmt.Sprintf("%d", end.Unix())
+	}
+
+	q := map[string]interface{}{
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				field: r,
+			},
+		},
+	}
+
+	return q
+}
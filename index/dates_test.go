@@ -0,0 +1,81 @@
+package index
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtantDuringQuery(t *testing.T) {
+
+	start := time.Date(1906, 4, 18, 0, 0, 0, 0, time.UTC)
+	end := time.Date(1915, 2, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		field    string
+		start    time.Time
+		end      time.Time
+		relation string
+		expected string
+	}{
+		"bounded": {
+			start:    start,
+			end:      end,
+			expected: `{"query":{"range":{"date:existence_range":{"format":"epoch_second","gte":"-2010441600","lte":"-1731369600","relation":"intersects"}}}}`,
+		},
+		"bounded reversed": {
+			field:    "properties.date:existence_range",
+			start:    end,
+			end:      start,
+			relation: RANGE_RELATION_WITHIN,
+			expected: `{"query":{"range":{"properties.date:existence_range":{"format":"epoch_second","gte":"-2010441600","lte":"-1731369600","relation":"within"}}}}`,
+		},
+		"open start": {
+			end:      end,
+			expected: `{"query":{"range":{"date:existence_range":{"format":"epoch_second","lte":"-1731369600","relation":"intersects"}}}}`,
+		},
+		"open end": {
+			start:    start,
+			relation: RANGE_RELATION_CONTAINS,
+			expected: `{"query":{"range":{"date:existence_range":{"format":"epoch_second","gte":"-2010441600","relation":"contains"}}}}`,
+		},
+		"unknown": {
+			expected: `{"query":{"range":{"date:existence_range":{"format":"epoch_second","relation":"intersects"}}}}`,
+		},
+	}
+
+	for label, test := range tests {
+
+		q := ExtantDuringQuery(test.field, test.start, test.end, test.relation)
+		enc_q := mustMarshal(t, q)
+
+		if string(enc_q) != test.expected {
+			t.Fatalf("Unexpected query for '%s': %s", label, string(enc_q))
+		}
+	}
+}
+
+func TestExtantAtQuery(t *testing.T) {
+
+	tests := map[string]struct {
+		t        time.Time
+		expected string
+	}{
+		"bounded": {
+			t:        time.Date(1906, 4, 18, 0, 0, 0, 0, time.UTC),
+			expected: `{"query":{"range":{"date:existence_range":{"format":"epoch_second","gte":"-2010441600","lte":"-2010441600","relation":"contains"}}}}`,
+		},
+		"unknown": {
+			expected: `{"query":{"range":{"date:existence_range":{"format":"epoch_second","relation":"contains"}}}}`,
+		},
+	}
+
+	for label, test := range tests {
+
+		q := ExtantAtQuery("", test.t)
+		enc_q := mustMarshal(t, q)
+
+		if string(enc_q) != test.expected {
+			t.Fatalf("Unexpected query for '%s': %s", label, string(enc_q))
+		}
+	}
+}
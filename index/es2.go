@@ -13,7 +13,6 @@ import (
 	"github.com/sfomuseum/go-flags/lookup"
 	"github.com/sfomuseum/go-whosonfirst-elasticsearch/document"
 	"github.com/tidwall/gjson"
-	"github.com/whosonfirst/go-whosonfirst-edtf"
 	"github.com/whosonfirst/go-whosonfirst-iterate/v2/iterator"
 	"github.com/whosonfirst/go-whosonfirst-uri"
 	es "gopkg.in/olivere/elastic.v3"
@@ -50,13 +49,21 @@ func RunES2BulkIndexerWithFlagSet(ctx context.Context, fs *flag.FlagSet) (*es.Bu
 		return nil, err
 	}
 
-	/*
-		index_alt, err := lookup.BoolVar(fs, FLAG_INDEX_ALT)
+	index_alt, err := lookup.BoolVar(fs, FLAG_INDEX_ALT)
 
-		if err != nil {
-			return nil, err
-		}
-	*/
+	if err != nil {
+		return nil, err
+	}
+
+	alt_index, err := lookup.StringVar(fs, FLAG_ES_ALT_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if alt_index == "" {
+		alt_index = es_index
+	}
 
 	index_only_props, err := lookup.BoolVar(fs, FLAG_INDEX_PROPS)
 
@@ -89,6 +96,75 @@ func RunES2BulkIndexerWithFlagSet(ctx context.Context, fs *flag.FlagSet) (*es.Bu
 		}
 	}
 
+	// The Spelunker v1 functions apply EDTF updates and append placetype details themselves so make sure they are only applied once
+
+	edtf_opts, err := edtfOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	placetypes_opts, err := placetypeDetailsOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spelunker_opts := &document.SpelunkerV1Options{
+		EDTF:       edtf_opts,
+		Placetypes: placetypes_opts,
+	}
+
+	prepare_funcs := make([]document.PrepareDocumentFunc, 0)
+
+	if index_spelunker_v1 {
+
+		spelunker_func, err := document.NewPrepareSpelunkerV1DocumentFunc(ctx, spelunker_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, spelunker_func)
+	}
+
+	if index_only_props {
+		prepare_funcs = append(prepare_funcs, document.ExtractProperties)
+	}
+
+	if append_spelunker_v1 {
+
+		spelunker_func, err := document.NewAppendSpelunkerV1PropertiesFunc(ctx, spelunker_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, spelunker_func)
+	}
+
+	if placetypes_opts != nil && !index_spelunker_v1 && !append_spelunker_v1 {
+
+		placetypes_func, err := document.NewAppendPlacetypeDetailsFunc(ctx, placetypes_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, placetypes_func)
+	}
+
+	if !index_spelunker_v1 && !append_spelunker_v1 {
+
+		edtf_func, err := document.NewPrepareEDTFFunc(ctx, edtf_opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		prepare_funcs = append(prepare_funcs, edtf_func)
+	}
+
 	es_client, err := es.NewClient(es.SetURL(es_endpoint))
 
 	if err != nil {
@@ -137,7 +213,7 @@ func RunES2BulkIndexerWithFlagSet(ctx context.Context, fs *flag.FlagSet) (*es.Bu
 			return nil
 		}
 
-		if uri_args.IsAlternate {
+		if uri_args.IsAlternate && !index_alt {
 			return nil
 		}
 
@@ -165,31 +241,31 @@ func RunES2BulkIndexerWithFlagSet(ctx context.Context, fs *flag.FlagSet) (*es.Bu
 		wof_id := id_rsp.Int()
 		doc_id := strconv.FormatInt(wof_id, 10)
 
-		// TO DO: move this in to the relevant document.Prepare method
-		// https://github.com/whosonfirst/go-whosonfirst-edtf
+		item_index := es_index
 
-		_, body, err = edtf.UpdateBytes(body)
+		if uri_args.IsAlternate {
 
-		if err != nil {
-			log.Printf("Failed to apply EDTF updates for %s, %v\n", path, err)
-		}
+			alt_doc_id, err := document.AlternateGeometryDocumentId(wof_id, uri_args.AltGeom)
 
-		// START OF manipulate body here...
+			if err != nil {
+				log.Printf("Failed to derive alternate geometry document ID for %s, %v\n", path, err)
+				return nil
+			}
 
-		prepare_funcs := make([]document.PrepareDocumentFunc, 0)
+			doc_id = alt_doc_id
 
-		if index_spelunker_v1 {
-			prepare_funcs = append(prepare_funcs, document.PrepareSpelunkerV1Document)
-		}
+			body, err = document.AppendAlternateGeometryProperties(ctx, body, uri_args.AltGeom)
 
-		if index_only_props {
-			prepare_funcs = append(prepare_funcs, document.ExtractProperties)
-		}
+			if err != nil {
+				log.Printf("Failed to append alternate geometry properties for %s, %v\n", path, err)
+				return nil
+			}
 
-		if append_spelunker_v1 {
-			prepare_funcs = append(prepare_funcs, document.AppendSpelunkerV1Properties)
+			item_index = alt_index
 		}
 
+		// START OF manipulate body here...
+
 		for _, f := range prepare_funcs {
 
 			new_body, err := f(ctx, body)
@@ -216,7 +292,7 @@ func RunES2BulkIndexerWithFlagSet(ctx context.Context, fs *flag.FlagSet) (*es.Bu
 
 		bulk_item := es.NewBulkIndexRequest().
 			Id(doc_id).
-			Index(es_index).
+			Index(item_index).
 			Type(pt_rsp.String()).
 			Doc(f)
 
@@ -0,0 +1,87 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// GetRecordWithGeometry returns a GeoJSON Feature for the document with ID 'doc_id' stored in 'index' joined with the
+// geometry of the document with the same ID stored in 'geometry_index'. This is meant to be used with indices created
+// by `RunBulkIndexer` when the `GeometryIndex` option is set. 'doc_id' is typically a Who's On First ID but may also be
+// the "{ID}-{ALT_LABEL}" document ID of an alternate geometry. If the record does not have a corresponding geometry
+// document the Feature's geometry is null.
+func GetRecordWithGeometry(ctx context.Context, es_client *es.Client, index string, geometry_index string, doc_id string) ([]byte, error) {
+
+	if index == "" {
+		return nil, errors.New("Missing Elasticsearch index")
+	}
+
+	if geometry_index == "" {
+		return nil, errors.New("Missing Elasticsearch geometry index")
+	}
+
+	record, ok, err := getDocumentSource(ctx, es_client, index, doc_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("Record %s not found", doc_id)
+	}
+
+	geom_doc, ok, err := getDocumentSource(ctx, es_client, geometry_index, doc_id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geom := []byte("null")
+
+	if ok {
+
+		geom_rsp := gjson.GetBytes(geom_doc, "geometry")
+
+		if geom_rsp.Exists() {
+			geom = []byte(geom_rsp.Raw)
+		}
+	}
+
+	// Account for both complete (but geometry-less) GeoJSON Features and properties-only documents
+
+	f := record
+
+	if !gjson.GetBytes(record, "properties").Exists() {
+
+		f = []byte(`{"type": "Feature"}`)
+
+		id_rsp := gjson.GetBytes(record, "wof:id")
+
+		if id_rsp.Exists() {
+
+			f, err = sjson.SetBytes(f, "id", id_rsp.Int())
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to assign id, %w", err)
+			}
+		}
+
+		f, err = sjson.SetRawBytes(f, "properties", record)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign properties, %w", err)
+		}
+	}
+
+	f, err = sjson.SetRawBytes(f, "geometry", geom)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to assign geometry, %w", err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,157 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/sfomuseum/go-flags/multi"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/pipelines"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const FLAG_PIPELINE string = "pipeline"
+
+// NewPipelinesFlagSet creates a new `flag.FlagSet` instance with command-line flags required by the `es-whosonfirst-pipelines` tool.
+func NewPipelinesFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("pipelines")
+
+	names, err := pipelines.Names()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive bundled pipeline names, %w", err)
+	}
+
+	pipeline_desc := fmt.Sprintf("Zero or more bundled ingest pipelines to install. If no pipelines or paths are specified all the bundled pipelines will be installed. Valid options are: %s", strings.Join(names, ","))
+
+	var pipeline_names multi.MultiString
+
+	fs.String(FLAG_ES_ENDPOINT, "http://localhost:9200", "A fully-qualified Elasticsearch endpoint.")
+	fs.Var(&pipeline_names, FLAG_PIPELINE, pipeline_desc)
+
+	return fs, nil
+}
+
+// InstallPipelinesWithFlagSet installs one or more ingest pipelines with configuration details defined in 'fs'. Bundled
+// pipelines are specified using the -pipeline flag. Any remaining arguments are assumed to be the paths to JSON-encoded
+// pipeline definitions whose name is the filename minus its extension. Returns the list of pipeline names installed.
+func InstallPipelinesWithFlagSet(ctx context.Context, fs *flag.FlagSet) ([]string, error) {
+
+	pipeline_names, err := lookup.MultiStringVar(fs, FLAG_PIPELINE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := fs.Args()
+
+	if len(pipeline_names) == 0 && len(paths) == 0 {
+
+		pipeline_names, err = pipelines.Names()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive bundled pipeline names, %w", err)
+		}
+	}
+
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make([]string, 0)
+
+	for _, name := range pipeline_names {
+
+		body, err := pipelines.Definition(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = InstallPipeline(ctx, es_client, name, body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		installed = append(installed, name)
+	}
+
+	for _, path := range paths {
+
+		body, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		err = InstallPipeline(ctx, es_client, name, body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		installed = append(installed, name)
+	}
+
+	return installed, nil
+}
+
+// InstallPipeline creates (or replaces) the ingest pipeline 'name' defined by 'body'.
+func InstallPipeline(ctx context.Context, es_client *es.Client, name string, body []byte) error {
+
+	rsp, err := es_client.Ingest.PutPipeline(name, bytes.NewReader(body), es_client.Ingest.PutPipeline.WithContext(ctx))
+
+	if err != nil {
+		return fmt.Errorf("Failed to install pipeline '%s', %w", name, err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return fmt.Errorf("Failed to install pipeline '%s', %s", name, rsp.String())
+	}
+
+	return nil
+}
+
+// EnsurePipeline returns an error if the ingest pipeline 'name' has not been installed.
+func EnsurePipeline(ctx context.Context, es_client *es.Client, name string) error {
+
+	if name == "" {
+		return errors.New("Missing pipeline name")
+	}
+
+	rsp, err := es_client.Ingest.GetPipeline(
+		es_client.Ingest.GetPipeline.WithContext(ctx),
+		es_client.Ingest.GetPipeline.WithPipelineID(name),
+	)
+
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve pipeline '%s', %w", name, err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("Pipeline '%s' does not exist", name)
+	}
+
+	if rsp.IsError() {
+		return fmt.Errorf("Failed to retrieve pipeline '%s', %s", name, rsp.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"io"
+	"net/http"
+)
+
+// getDocumentSource returns the `_source` property of the document with ID 'doc_id' stored in 'index' and a boolean
+// value indicating whether the document exists.
+func getDocumentSource(ctx context.Context, es_client *es.Client, index string, doc_id string) ([]byte, bool, error) {
+
+	rsp, err := es_client.GetSource(index, doc_id, es_client.GetSource.WithContext(ctx))
+
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to retrieve %s, %w", doc_id, err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if rsp.IsError() {
+		return nil, false, fmt.Errorf("Failed to retrieve %s, %s", doc_id, rsp.String())
+	}
+
+	body, err := io.ReadAll(rsp.Body)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to read %s, %w", doc_id, err)
+	}
+
+	return body, true, nil
+}
@@ -0,0 +1,583 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/document"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/iterator"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const FLAG_SYNONYMS_OUTPUT string = "output"
+const FLAG_SYNONYMS_PER_LANGUAGE string = "per-language"
+const FLAG_SYNONYMS_LANGUAGES string = "languages"
+const FLAG_SYNONYMS_MIN_LENGTH string = "min-length"
+const FLAG_SYNONYMS_EQUIVALENT string = "equivalent"
+const FLAG_SYNONYMS_INSTALL string = "install"
+const FLAG_SYNONYMS_FILTER string = "filter-name"
+const FLAG_SYNONYMS_PATH string = "synonyms-path"
+const FLAG_SYNONYMS_UPDATEABLE string = "updateable"
+const FLAG_SYNONYMS_RELOAD string = "reload"
+const FLAG_SYNONYMS_MAX_INLINE_RULES string = "max-inline-rules"
+
+// DEFAULT_SYNONYMS_FILTER is the default name of the synonym token filter (and analyzer) installed in index settings.
+const DEFAULT_SYNONYMS_FILTER string = "whosonfirst_synonyms"
+
+// DEFAULT_MAX_INLINE_SYNONYMS is the default maximum number of synonym rules that can be installed inline, in index settings
+// (and therefore in the cluster state). Larger sets of rules should be installed using synonym files (see `SynonymFilter.Path`).
+const DEFAULT_MAX_INLINE_SYNONYMS int = 10000
+
+// type RunSynonymsOptions contains runtime configurations for exporting synonym rules derived from Who's On First records.
+type RunSynonymsOptions struct {
+	// IteratorURI is a valid `whosonfirst/go-whosonfirst-iterate/v2` URI
+	IteratorURI string
+	// IteratorPaths is the list of paths to iterate
+	IteratorPaths []string
+	// Output is the directory that synonym files are written to. If empty no files are written.
+	Output string
+	// PerLanguage is a boolean value indicating whether synonyms should be written to, and installed as, one set per language.
+	PerLanguage bool
+	// Equivalent is a boolean value indicating whether rules should be lists of equivalent names rather than explicit mappings.
+	Equivalent bool
+	// DeriveOptions are the options used to derive synonym rules from each record.
+	DeriveOptions *document.DeriveSynonymsOptions
+	// Client is an optional `es.Client` instance used to install synonyms in the settings of `Index`.
+	Client *es.Client
+	// Index is the name of the Elasticsearch index to install synonyms in.
+	Index string
+	// FilterName is the name of the synonym token filter (and analyzer) to install. If `PerLanguage` is true the language
+	// is appended, for example "whosonfirst_synonyms_eng".
+	FilterName string
+	// SynonymsPath is the optional path, relative to the Elasticsearch config directory, that the files in `Output` have been
+	// copied to on every node. If set installed filters refer to those files (using `synonyms_path`) rather than inlining rules.
+	SynonymsPath string
+	// Updateable is a boolean value indicating whether installed filters are "updateable" (search-time only) filters whose
+	// synonym files can be reloaded without closing the index. Requires `SynonymsPath`.
+	Updateable bool
+	// Reload is a boolean value indicating whether to reload the search analyzers of `Index` (see `ReloadSynonyms`), rather
+	// than installing filters, once synonym files have been written. Requires filters to have been installed with `Updateable`.
+	Reload bool
+	// MaxInlineRules is the maximum number of rules that can be installed inline. Default is `DEFAULT_MAX_INLINE_SYNONYMS`.
+	MaxInlineRules int
+}
+
+// NewSynonymsFlagSet creates a new `flag.FlagSet` instance with command-line flags required by the `es-whosonfirst-synonyms` tool.
+func NewSynonymsFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("synonyms")
+
+	valid_schemes := strings.Join(emitter.Schemes(), ",")
+	iterator_desc := fmt.Sprintf("A valid whosonfirst/go-whosonfirst-iterator/emitter URI. Supported emitter URI schemes are: %s", valid_schemes)
+
+	fs.String(FLAG_ITERATOR_URI, "repo://", iterator_desc)
+	fs.String(FLAG_SYNONYMS_OUTPUT, ".", "The directory to write synonym files to. Synonyms are written to synonyms.txt or, if -per-language is enabled, synonyms_{LANGUAGE}.txt. If empty no files are written.")
+	fs.Bool(FLAG_SYNONYMS_PER_LANGUAGE, false, "Write, and install, one set of synonyms per language rather than a single global set.")
+	fs.String(FLAG_SYNONYMS_LANGUAGES, "", "An optional comma-separated list of (ISO 639-3) languages to derive synonyms for. If empty all languages are used.")
+	fs.Int(FLAG_SYNONYMS_MIN_LENGTH, document.DEFAULT_SYNONYM_MIN_LENGTH, "The minimum length, in characters, of names used as synonyms.")
+	fs.Bool(FLAG_SYNONYMS_EQUIVALENT, false, "Write rules as lists of equivalent names (\"San Francisco, SF, Frisco\") rather than explicit mappings (\"SF, Frisco => San Francisco\").")
+	fs.Bool(FLAG_SYNONYMS_INSTALL, false, "Install the synonyms as token filters, and analyzers, in the settings of the -elasticsearch-index index. WARNING: the index is closed, and unavailable for reads and writes, while its settings are updated and then reopened.")
+	fs.String(FLAG_SYNONYMS_FILTER, DEFAULT_SYNONYMS_FILTER, "The name of the synonym token filter, and analyzer, to install. If -per-language is enabled the language is appended, for example whosonfirst_synonyms_eng.")
+	fs.String(FLAG_SYNONYMS_PATH, "", "The path, relative to the Elasticsearch config directory, that the files written to -output have been copied to on every node (for example \"analysis\"). If set installed token filters refer to those files rather than inlining the rules in index settings.")
+	fs.Bool(FLAG_SYNONYMS_UPDATEABLE, false, "Install \"updateable\" (search-time only) token filters whose synonym files can be reloaded, using -reload, without closing the index. Requires -synonyms-path.")
+	fs.Bool(FLAG_SYNONYMS_RELOAD, false, "Reload the search analyzers of the -elasticsearch-index index, rather than installing token filters, once synonym files have been written (and copied to every node). Requires token filters to have been installed with -updateable.")
+	fs.Int(FLAG_SYNONYMS_MAX_INLINE_RULES, DEFAULT_MAX_INLINE_SYNONYMS, "The maximum number of synonym rules that can be inlined in index settings, and therefore the cluster state. Use -synonyms-path for larger sets of rules.")
+	fs.String(FLAG_ES_ENDPOINT, "http://localhost:9200", "A fully-qualified Elasticsearch endpoint.")
+	fs.String(FLAG_ES_INDEX, "millsfield", "A valid Elasticsearch index.")
+
+	return fs, nil
+}
+
+// RunSynonymsOptionsFromFlagSet returns a `RunSynonymsOptions` instance derived from the values in 'fs'.
+func RunSynonymsOptionsFromFlagSet(ctx context.Context, fs *flag.FlagSet) (*RunSynonymsOptions, error) {
+
+	iterator_uri, err := lookup.StringVar(fs, FLAG_ITERATOR_URI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := lookup.StringVar(fs, FLAG_SYNONYMS_OUTPUT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	per_language, err := lookup.BoolVar(fs, FLAG_SYNONYMS_PER_LANGUAGE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	str_languages, err := lookup.StringVar(fs, FLAG_SYNONYMS_LANGUAGES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	min_length, err := lookup.IntVar(fs, FLAG_SYNONYMS_MIN_LENGTH)
+
+	if err != nil {
+		return nil, err
+	}
+
+	equivalent, err := lookup.BoolVar(fs, FLAG_SYNONYMS_EQUIVALENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	install, err := lookup.BoolVar(fs, FLAG_SYNONYMS_INSTALL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter_name, err := lookup.StringVar(fs, FLAG_SYNONYMS_FILTER)
+
+	if err != nil {
+		return nil, err
+	}
+
+	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
+
+	if err != nil {
+		return nil, err
+	}
+
+	synonyms_path, err := lookup.StringVar(fs, FLAG_SYNONYMS_PATH)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updateable, err := lookup.BoolVar(fs, FLAG_SYNONYMS_UPDATEABLE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reload, err := lookup.BoolVar(fs, FLAG_SYNONYMS_RELOAD)
+
+	if err != nil {
+		return nil, err
+	}
+
+	max_inline_rules, err := lookup.IntVar(fs, FLAG_SYNONYMS_MAX_INLINE_RULES)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if install && reload {
+		return nil, fmt.Errorf("-%s and -%s can not be used together", FLAG_SYNONYMS_INSTALL, FLAG_SYNONYMS_RELOAD)
+	}
+
+	if updateable && synonyms_path == "" {
+		return nil, fmt.Errorf("-%s requires -%s to be set", FLAG_SYNONYMS_UPDATEABLE, FLAG_SYNONYMS_PATH)
+	}
+
+	opts := &RunSynonymsOptions{
+		IteratorURI:   iterator_uri,
+		IteratorPaths: fs.Args(),
+		Output:        output,
+		PerLanguage:   per_language,
+		Equivalent:    equivalent,
+		DeriveOptions: &document.DeriveSynonymsOptions{
+			MinLength: min_length,
+			Languages: stringsFromString(str_languages),
+		},
+		Index:          es_index,
+		FilterName:     filter_name,
+		SynonymsPath:   synonyms_path,
+		Updateable:     updateable,
+		Reload:         reload,
+		MaxInlineRules: max_inline_rules,
+	}
+
+	if install || reload {
+
+		es_client, err := ClientFromFlagSet(ctx, fs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Client = es_client
+	}
+
+	return opts, nil
+}
+
+// RunSynonymsWithFlagSet exports synonym rules derived from Who's On First records with configuration details defined in 'fs'.
+// Returns the list of synonym files written.
+func RunSynonymsWithFlagSet(ctx context.Context, fs *flag.FlagSet) ([]string, error) {
+
+	opts, err := RunSynonymsOptionsFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return RunSynonyms(ctx, opts)
+}
+
+// RunSynonyms iterates Who's On First records, derives synonym rules from their variant and colloquial names, writes
+// the unique set of rules to Solr-formatted synonym files and, if `opts.Client` is not nil, either installs them in the settings
+// of `opts.Index` (see `InstallSynonyms`) or, if `opts.Reload` is true, reloads the search analyzers of `opts.Index` (see
+// `ReloadSynonyms`). Returns the list of synonym files written.
+func RunSynonyms(ctx context.Context, opts *RunSynonymsOptions) ([]string, error) {
+
+	synonyms := document.NewSynonymSet(opts.Equivalent)
+
+	iter_cb := func(ctx context.Context, path string, fh io.ReadSeeker, args ...interface{}) error {
+
+		body, err := io.ReadAll(fh)
+
+		if err != nil {
+			return err
+		}
+
+		// Alternate geometries don't have names
+
+		if gjson.GetBytes(body, "properties.src:alt_label").Exists() {
+			return nil
+		}
+
+		rules, err := document.DeriveSynonyms(ctx, body, opts.DeriveOptions)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive synonyms for %s, %w", path, err)
+		}
+
+		synonyms.Add(rules...)
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, opts.IteratorURI, iter_cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t1 := time.Now()
+
+	err = iter.IterateURIs(ctx, opts.IteratorPaths...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Processed %d files in %v\n", iter.Seen, time.Since(t1))
+
+	// A map of synonym set labels (an empty string for the global set) to rules
+
+	sets := make(map[string][]string)
+
+	if opts.PerLanguage {
+
+		for _, lang := range synonyms.Languages() {
+			sets[lang] = synonyms.Rules(lang)
+		}
+
+	} else {
+		sets[""] = synonyms.Rules("")
+	}
+
+	written := make([]string, 0)
+
+	if opts.Output != "" {
+
+		for label, rules := range sets {
+
+			path := filepath.Join(opts.Output, synonymsFilename(label))
+
+			err := writeSynonyms(path, rules)
+
+			if err != nil {
+				return nil, err
+			}
+
+			written = append(written, path)
+		}
+	}
+
+	if opts.Client != nil && opts.Reload {
+
+		err := ReloadSynonyms(ctx, opts.Client, opts.Index)
+
+		if err != nil {
+			return nil, err
+		}
+
+	} else if opts.Client != nil {
+
+		filters := make(map[string]*SynonymFilter)
+
+		for label, rules := range sets {
+
+			name := opts.FilterName
+
+			if label != "" {
+				name = fmt.Sprintf("%s_%s", name, label)
+			}
+
+			f := &SynonymFilter{
+				Rules: rules,
+			}
+
+			if opts.SynonymsPath != "" {
+				f.Path = path.Join(opts.SynonymsPath, synonymsFilename(label))
+			}
+
+			filters[name] = f
+		}
+
+		install_opts := &InstallSynonymsOptions{
+			Filters:        filters,
+			Updateable:     opts.Updateable,
+			MaxInlineRules: opts.MaxInlineRules,
+		}
+
+		err := InstallSynonyms(ctx, opts.Client, opts.Index, install_opts)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return written, nil
+}
+
+// synonymsFilename returns the name of the file that the synonyms for the set 'label' (a language or an empty string for the
+// global set) are written to.
+func synonymsFilename(label string) string {
+
+	if label == "" {
+		return "synonyms.txt"
+	}
+
+	return fmt.Sprintf("synonyms_%s.txt", label)
+}
+
+// writeSynonyms writes 'rules', one per line, to 'path'.
+func writeSynonyms(path string, rules []string) error {
+
+	fh, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create %s, %w", path, err)
+	}
+
+	for _, r := range rules {
+
+		_, err := fmt.Fprintln(fh, r)
+
+		if err != nil {
+			fh.Close()
+			return fmt.Errorf("Failed to write %s, %w", path, err)
+		}
+	}
+
+	err = fh.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close %s, %w", path, err)
+	}
+
+	return nil
+}
+
+// type SynonymFilter defines a synonym token filter to install in index settings.
+type SynonymFilter struct {
+	// Rules are the synonym rules to inline in index settings. Ignored if `Path` is set.
+	Rules []string
+	// Path is the optional path, relative to the Elasticsearch config directory, of a synonyms file present on every node.
+	Path string
+}
+
+// type InstallSynonymsOptions defines configuration options for installing synonym token filters in index settings.
+type InstallSynonymsOptions struct {
+	// Filters is a map of token filter (and analyzer) names to the synonyms they apply.
+	Filters map[string]*SynonymFilter
+	// Updateable is a boolean value indicating whether filters are "updateable" (search-time only) filters whose synonym
+	// files can be reloaded (see `ReloadSynonyms`) without closing the index. Requires every filter to have a `Path`.
+	Updateable bool
+	// MaxInlineRules is the maximum number of rules, across all filters, that can be inlined in index settings.
+	// Default is `DEFAULT_MAX_INLINE_SYNONYMS`.
+	MaxInlineRules int
+}
+
+// InstallSynonyms installs one "synonym" token filter for each filter in 'opts' in the settings of 'es_index' and an analyzer,
+// with the same name, that applies the standard tokenizer and the lowercase and synonym filters. Analysis settings can only
+// be updated on closed indices so 'es_index' is closed, and unavailable for reads and writes, while its settings are updated
+// and is then reopened. To update synonyms without closing the index install updateable filters and use `ReloadSynonyms`.
+func InstallSynonyms(ctx context.Context, es_client *es.Client, es_index string, opts *InstallSynonymsOptions) error {
+
+	if es_index == "" {
+		return errors.New("Missing index")
+	}
+
+	settings, err := synonymsSettings(opts)
+
+	if err != nil {
+		return err
+	}
+
+	enc_settings, err := json.Marshal(settings)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal settings, %w", err)
+	}
+
+	log.Printf("Closing index '%s' to update its analysis settings\n", es_index)
+
+	close_rsp, err := es_client.Indices.Close([]string{es_index}, es_client.Indices.Close.WithContext(ctx))
+
+	if err != nil {
+		return fmt.Errorf("Failed to close index '%s', %w", es_index, err)
+	}
+
+	defer close_rsp.Body.Close()
+
+	if close_rsp.IsError() {
+		return fmt.Errorf("Failed to close index '%s', %s", es_index, close_rsp.String())
+	}
+
+	// Make sure the index is reopened even if the settings can not be updated
+
+	defer func() {
+
+		open_rsp, err := es_client.Indices.Open([]string{es_index}, es_client.Indices.Open.WithContext(ctx))
+
+		if err != nil {
+			log.Printf("Failed to reopen index '%s', %v", es_index, err)
+			return
+		}
+
+		defer open_rsp.Body.Close()
+
+		if open_rsp.IsError() {
+			log.Printf("Failed to reopen index '%s', %s", es_index, open_rsp.String())
+		}
+	}()
+
+	settings_rsp, err := es_client.Indices.PutSettings(
+		bytes.NewReader(enc_settings),
+		es_client.Indices.PutSettings.WithContext(ctx),
+		es_client.Indices.PutSettings.WithIndex(es_index),
+	)
+
+	if err != nil {
+		return fmt.Errorf("Failed to update settings for index '%s', %w", es_index, err)
+	}
+
+	defer settings_rsp.Body.Close()
+
+	if settings_rsp.IsError() {
+		return fmt.Errorf("Failed to update settings for index '%s', %s", es_index, settings_rsp.String())
+	}
+
+	return nil
+}
+
+// ReloadSynonyms reloads the search analyzers of 'es_index' so that changes to the synonym files used by updateable token
+// filters (see `InstallSynonymsOptions`) take effect. The index is not closed. Synonym files need to have been updated on
+// every node first.
+func ReloadSynonyms(ctx context.Context, es_client *es.Client, es_index string) error {
+
+	if es_index == "" {
+		return errors.New("Missing index")
+	}
+
+	rsp, err := es_client.Indices.ReloadSearchAnalyzers(
+		[]string{es_index},
+		es_client.Indices.ReloadSearchAnalyzers.WithContext(ctx),
+	)
+
+	if err != nil {
+		return fmt.Errorf("Failed to reload search analyzers for index '%s', %w", es_index, err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return fmt.Errorf("Failed to reload search analyzers for index '%s', %s", es_index, rsp.String())
+	}
+
+	return nil
+}
+
+// synonymsSettings returns the analysis settings for the synonym token filters, and analyzers, defined in 'opts'. Returns an
+// error if the number of inlined rules exceeds `opts.MaxInlineRules` or if updateable filters do not have a path.
+func synonymsSettings(opts *InstallSynonymsOptions) (map[string]interface{}, error) {
+
+	max_inline := opts.MaxInlineRules
+
+	if max_inline == 0 {
+		max_inline = DEFAULT_MAX_INLINE_SYNONYMS
+	}
+
+	token_filters := make(map[string]interface{})
+	analyzers := make(map[string]interface{})
+
+	count_inline := 0
+
+	for name, f := range opts.Filters {
+
+		token_filter := map[string]interface{}{
+			"type": "synonym",
+		}
+
+		if f.Path != "" {
+			token_filter["synonyms_path"] = f.Path
+		} else {
+
+			if opts.Updateable {
+				return nil, fmt.Errorf("Updateable filter '%s' requires a synonyms path", name)
+			}
+
+			token_filter["synonyms"] = f.Rules
+			count_inline += len(f.Rules)
+		}
+
+		if opts.Updateable {
+			token_filter["updateable"] = true
+		}
+
+		token_filters[name] = token_filter
+
+		analyzers[name] = map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    []string{"lowercase", name},
+		}
+	}
+
+	if count_inline > max_inline {
+		return nil, fmt.Errorf("Too many synonym rules (%d) to install inline, the maximum is %d. Install synonym files instead.", count_inline, max_inline)
+	}
+
+	settings := map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"filter":   token_filters,
+			"analyzer": analyzers,
+		},
+	}
+
+	return settings, nil
+}
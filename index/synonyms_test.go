@@ -0,0 +1,197 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/tidwall/gjson"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSynonymsSettings(t *testing.T) {
+
+	tests := map[string]struct {
+		opts     *InstallSynonymsOptions
+		expected map[string]string
+	}{
+		"inline": {
+			opts: &InstallSynonymsOptions{
+				Filters: map[string]*SynonymFilter{
+					"whosonfirst_synonyms": &SynonymFilter{Rules: []string{"San Francisco, SF, Frisco"}},
+				},
+			},
+			expected: map[string]string{
+				"analysis.filter.whosonfirst_synonyms.type":       `"synonym"`,
+				"analysis.filter.whosonfirst_synonyms.synonyms":   `["San Francisco, SF, Frisco"]`,
+				"analysis.filter.whosonfirst_synonyms.updateable": ``,
+				"analysis.analyzer.whosonfirst_synonyms.filter":   `["lowercase","whosonfirst_synonyms"]`,
+			},
+		},
+		"path": {
+			opts: &InstallSynonymsOptions{
+				Filters: map[string]*SynonymFilter{
+					"whosonfirst_synonyms_eng": &SynonymFilter{Rules: []string{"SF, Frisco => San Francisco"}, Path: "analysis/synonyms_eng.txt"},
+				},
+			},
+			expected: map[string]string{
+				"analysis.filter.whosonfirst_synonyms_eng.synonyms_path": `"analysis/synonyms_eng.txt"`,
+				"analysis.filter.whosonfirst_synonyms_eng.synonyms":      ``,
+				"analysis.filter.whosonfirst_synonyms_eng.updateable":    ``,
+			},
+		},
+		"updateable": {
+			opts: &InstallSynonymsOptions{
+				Filters: map[string]*SynonymFilter{
+					"whosonfirst_synonyms": &SynonymFilter{Path: "analysis/synonyms.txt"},
+				},
+				Updateable: true,
+			},
+			expected: map[string]string{
+				"analysis.filter.whosonfirst_synonyms.synonyms_path": `"analysis/synonyms.txt"`,
+				"analysis.filter.whosonfirst_synonyms.updateable":    `true`,
+			},
+		},
+	}
+
+	for label, test := range tests {
+
+		settings, err := synonymsSettings(test.opts)
+
+		if err != nil {
+			t.Fatalf("Failed to derive settings for '%s', %v", label, err)
+		}
+
+		enc_settings := mustMarshal(t, settings)
+
+		for path, expected := range test.expected {
+
+			rsp := gjson.GetBytes(enc_settings, path)
+
+			if rsp.Raw != expected {
+				t.Fatalf("Unexpected value for '%s' in '%s': %s", path, label, rsp.Raw)
+			}
+		}
+	}
+}
+
+func TestSynonymsSettingsErrors(t *testing.T) {
+
+	tests := map[string]*InstallSynonymsOptions{
+		"too many inline rules": &InstallSynonymsOptions{
+			Filters: map[string]*SynonymFilter{
+				"a": &SynonymFilter{Rules: []string{"a => b", "c => d"}},
+				"b": &SynonymFilter{Rules: []string{"e => f"}},
+			},
+			MaxInlineRules: 2,
+		},
+		"updateable without path": &InstallSynonymsOptions{
+			Filters: map[string]*SynonymFilter{
+				"a": &SynonymFilter{Rules: []string{"a => b"}},
+			},
+			Updateable: true,
+		},
+	}
+
+	for label, opts := range tests {
+
+		_, err := synonymsSettings(opts)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", label)
+		}
+	}
+
+	// Rules installed from files do not count towards the cap
+
+	opts := &InstallSynonymsOptions{
+		Filters: map[string]*SynonymFilter{
+			"a": &SynonymFilter{Rules: []string{"a => b", "c => d"}, Path: "analysis/synonyms_a.txt"},
+		},
+		MaxInlineRules: 1,
+	}
+
+	_, err := synonymsSettings(opts)
+
+	if err != nil {
+		t.Fatalf("Failed to derive settings for synonym files, %v", err)
+	}
+}
+
+func TestInstallSynonymsCapDoesNotCloseIndex(t *testing.T) {
+
+	ctx := context.Background()
+
+	requests := 0
+
+	handler := func(rsp http.ResponseWriter, req *http.Request) {
+		requests += 1
+		rsp.Header().Set("Content-Type", "application/json")
+		rsp.Write([]byte(`{}`))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	es_client, err := es.NewClient(es.Config{
+		Addresses: []string{server.URL},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create client, %v", err)
+	}
+
+	opts := &InstallSynonymsOptions{
+		Filters: map[string]*SynonymFilter{
+			"a": &SynonymFilter{Rules: []string{"a => b", "c => d"}},
+		},
+		MaxInlineRules: 1,
+	}
+
+	err = InstallSynonyms(ctx, es_client, "millsfield", opts)
+
+	if err == nil {
+		t.Fatalf("Expected install to fail")
+	}
+
+	if requests != 0 {
+		t.Fatalf("Unexpected requests: %d", requests)
+	}
+}
+
+func TestReloadSynonyms(t *testing.T) {
+
+	ctx := context.Background()
+
+	paths := make([]string, 0)
+
+	handler := func(rsp http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+		rsp.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rsp).Encode(map[string]interface{}{})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	es_client, err := es.NewClient(es.Config{
+		Addresses: []string{server.URL},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create client, %v", err)
+	}
+
+	err = ReloadSynonyms(ctx, es_client, "millsfield")
+
+	if err != nil {
+		t.Fatalf("Failed to reload synonyms, %v", err)
+	}
+
+	// The search analyzers are reloaded without closing the index
+
+	if len(paths) != 1 || paths[0] != "POST /millsfield/_reload_search_analyzers" {
+		t.Fatalf("Unexpected requests: %v", paths)
+	}
+}
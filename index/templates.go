@@ -0,0 +1,283 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	es "github.com/elastic/go-elasticsearch/v7"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/lookup"
+	"github.com/sfomuseum/go-whosonfirst-elasticsearch/document"
+	"io"
+	"sort"
+)
+
+const FLAG_TEMPLATE_NAME string = "template-name"
+const FLAG_TEMPLATE_PRIORITY string = "template-priority"
+const FLAG_PROPERTY_PREFIX string = "property-prefix"
+const FLAG_PRINT_TEMPLATE string = "print"
+
+// DEFAULT_NAMES_TEMPLATE is the default name of the index template for per-language name fields.
+const DEFAULT_NAMES_TEMPLATE string = "whosonfirst-names"
+
+// LANGUAGE_ANALYZERS maps ISO 639-3 language codes, as used by Who's On First `name:*` properties, to the names of the
+// built-in Elasticsearch (7.x) language analyzers.
+var LANGUAGE_ANALYZERS = map[string]string{
+	"ara": "arabic",
+	"ben": "bengali",
+	"bul": "bulgarian",
+	"cat": "catalan",
+	"ces": "czech",
+	"ckb": "sorani",
+	"dan": "danish",
+	"deu": "german",
+	"ell": "greek",
+	"eng": "english",
+	"eus": "basque",
+	"fas": "persian",
+	"fin": "finnish",
+	"fra": "french",
+	"gle": "irish",
+	"glg": "galician",
+	"hin": "hindi",
+	"hun": "hungarian",
+	"hye": "armenian",
+	"ind": "indonesian",
+	"ita": "italian",
+	"jpn": "cjk",
+	"kor": "cjk",
+	"lav": "latvian",
+	"lit": "lithuanian",
+	"nld": "dutch",
+	"nno": "norwegian",
+	"nob": "norwegian",
+	"nor": "norwegian",
+	"por": "portuguese",
+	"ron": "romanian",
+	"rus": "russian",
+	"spa": "spanish",
+	"swe": "swedish",
+	"tha": "thai",
+	"tur": "turkish",
+	"zho": "cjk",
+}
+
+// type NamesTemplateOptions contains runtime configurations for deriving an index template for per-language name fields.
+type NamesTemplateOptions struct {
+	// IndexPatterns is the list of index patterns the template applies to.
+	IndexPatterns []string
+	// Priority is the template's priority relative to other (composable) index templates.
+	Priority int
+	// PropertyPrefix is the string prepended to the `names` and `names:all` properties. For example "" for properties-only
+	// (Spelunker v1) documents or "properties." for complete GeoJSON Features.
+	PropertyPrefix string
+}
+
+// NewNamesTemplateFlagSet creates a new `flag.FlagSet` instance with command-line flags required by the `es-whosonfirst-names-template` tool.
+func NewNamesTemplateFlagSet(ctx context.Context) (*flag.FlagSet, error) {
+
+	fs := flagset.NewFlagSet("template")
+
+	fs.String(FLAG_ES_ENDPOINT, "http://localhost:9200", "A fully-qualified Elasticsearch endpoint.")
+	fs.String(FLAG_ES_INDEX, "millsfield", "A valid Elasticsearch index pattern for the template to apply to.")
+	fs.String(FLAG_TEMPLATE_NAME, DEFAULT_NAMES_TEMPLATE, "The name of the index template.")
+	fs.Int(FLAG_TEMPLATE_PRIORITY, 0, "The priority of the index template.")
+	fs.String(FLAG_PROPERTY_PREFIX, "", "The prefix for name properties. Use 'properties.' for indices of complete GeoJSON Features.")
+	fs.Bool(FLAG_PRINT_TEMPLATE, false, "Print the index template to STDOUT rather than installing it.")
+
+	return fs, nil
+}
+
+// InstallNamesTemplateWithFlagSet derives an index template for per-language name fields and installs it, or prints it
+// to 'wr' if the -print flag is enabled, with configuration details defined in 'fs'.
+func InstallNamesTemplateWithFlagSet(ctx context.Context, fs *flag.FlagSet, wr io.Writer) error {
+
+	es_index, err := lookup.StringVar(fs, FLAG_ES_INDEX)
+
+	if err != nil {
+		return err
+	}
+
+	name, err := lookup.StringVar(fs, FLAG_TEMPLATE_NAME)
+
+	if err != nil {
+		return err
+	}
+
+	priority, err := lookup.IntVar(fs, FLAG_TEMPLATE_PRIORITY)
+
+	if err != nil {
+		return err
+	}
+
+	prefix, err := lookup.StringVar(fs, FLAG_PROPERTY_PREFIX)
+
+	if err != nil {
+		return err
+	}
+
+	print_template, err := lookup.BoolVar(fs, FLAG_PRINT_TEMPLATE)
+
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		return errors.New("Missing template name")
+	}
+
+	opts := &NamesTemplateOptions{
+		IndexPatterns:  []string{es_index},
+		Priority:       priority,
+		PropertyPrefix: prefix,
+	}
+
+	body, err := NamesTemplate(ctx, opts)
+
+	if err != nil {
+		return err
+	}
+
+	if print_template {
+		_, err := wr.Write(body)
+		return err
+	}
+
+	es_client, err := ClientFromFlagSet(ctx, fs)
+
+	if err != nil {
+		return err
+	}
+
+	return InstallIndexTemplate(ctx, es_client, name, body)
+}
+
+// NamesTemplate returns a composable index template whose dynamic templates map the per-language name fields produced by
+// `document.AppendNameFields` (for example `names.eng.preferred`) as text fields analyzed with the matching Elasticsearch
+// language analyzer in `LANGUAGE_ANALYZERS`. Languages without a matching analyzer, and the `names:all`, `names:folded` and
+// `names:transliterated` properties, use the standard analyzer. All name fields have a "keyword" sub-field. The collation sort
+// keys produced by `document.AppendNameVariants` (for example `sort:name_deu`) are mapped as keyword fields.
+func NamesTemplate(ctx context.Context, opts *NamesTemplateOptions) ([]byte, error) {
+
+	if len(opts.IndexPatterns) == 0 {
+		return nil, errors.New("Missing index patterns")
+	}
+
+	text_mapping := func(analyzer string) map[string]interface{} {
+
+		return map[string]interface{}{
+			"type":     "text",
+			"analyzer": analyzer,
+			"fields": map[string]interface{}{
+				"keyword": map[string]interface{}{
+					"type":         "keyword",
+					"ignore_above": 256,
+				},
+			},
+		}
+	}
+
+	dynamic_template := func(path string, analyzer string) map[string]interface{} {
+
+		return map[string]interface{}{
+			"path_match":         path,
+			"match_mapping_type": "string",
+			"mapping":            text_mapping(analyzer),
+		}
+	}
+
+	languages := make([]string, 0, len(LANGUAGE_ANALYZERS))
+
+	for lang, _ := range LANGUAGE_ANALYZERS {
+		languages = append(languages, lang)
+	}
+
+	sort.Strings(languages)
+
+	// Dynamic templates are applied in order so the per-language templates need to come first
+
+	dynamic_templates := make([]map[string]interface{}, 0)
+
+	for _, lang := range languages {
+
+		path := fmt.Sprintf("%snames.%s.*", opts.PropertyPrefix, lang)
+		label := fmt.Sprintf("names_%s", lang)
+
+		dynamic_templates = append(dynamic_templates, map[string]interface{}{
+			label: dynamic_template(path, LANGUAGE_ANALYZERS[lang]),
+		})
+	}
+
+	dynamic_templates = append(dynamic_templates, map[string]interface{}{
+		"names_default": dynamic_template(fmt.Sprintf("%snames.*", opts.PropertyPrefix), "standard"),
+	})
+
+	names_properties := map[string]string{
+		"names_all":            document.NAMES_ALL_PROPERTY,
+		"names_folded":         document.NAMES_FOLDED_PROPERTY,
+		"names_transliterated": document.NAMES_TRANSLITERATED_PROPERTY,
+	}
+
+	labels := make([]string, 0, len(names_properties))
+
+	for label, _ := range names_properties {
+		labels = append(labels, label)
+	}
+
+	sort.Strings(labels)
+
+	for _, label := range labels {
+
+		path := fmt.Sprintf("%s%s", opts.PropertyPrefix, names_properties[label])
+
+		dynamic_templates = append(dynamic_templates, map[string]interface{}{
+			label: dynamic_template(path, "standard"),
+		})
+	}
+
+	// Collation keys can be longer than the "keyword" sub-field's ignore_above limit so they are mapped
+	// as keywords without a limit.
+
+	dynamic_templates = append(dynamic_templates, map[string]interface{}{
+		"names_sort": map[string]interface{}{
+			"path_match":         fmt.Sprintf("%s%s*", opts.PropertyPrefix, document.SORT_NAME_PROPERTY),
+			"match_mapping_type": "string",
+			"mapping": map[string]interface{}{
+				"type": "keyword",
+			},
+		},
+	})
+
+	template := map[string]interface{}{
+		"index_patterns": opts.IndexPatterns,
+		"priority":       opts.Priority,
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic_templates": dynamic_templates,
+			},
+		},
+	}
+
+	return json.Marshal(template)
+}
+
+// InstallIndexTemplate creates (or replaces) the composable index template 'name' defined by 'body'.
+func InstallIndexTemplate(ctx context.Context, es_client *es.Client, name string, body []byte) error {
+
+	rsp, err := es_client.Indices.PutIndexTemplate(name, bytes.NewReader(body), es_client.Indices.PutIndexTemplate.WithContext(ctx))
+
+	if err != nil {
+		return fmt.Errorf("Failed to install index template '%s', %w", name, err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.IsError() {
+		return fmt.Errorf("Failed to install index template '%s', %s", name, rsp.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+// package pipelines provides Elasticsearch ingest pipeline definitions bundled with this package.
+package pipelines
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//go:embed *.json
+var FS embed.FS
+
+// Names returns the sorted list of bundled pipeline names. A pipeline's name is the filename of its
+// definition minus the ".json" extension.
+func Names() ([]string, error) {
+
+	paths, err := fs.Glob(FS, "*.json")
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(paths))
+
+	for idx, path := range paths {
+		names[idx] = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Definition returns the body of the bundled pipeline definition for 'name'.
+func Definition(name string) ([]byte, error) {
+
+	path := fmt.Sprintf("%s.json", name)
+
+	body, err := FS.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unknown or invalid pipeline '%s', %w", name, err)
+	}
+
+	return body, nil
+}